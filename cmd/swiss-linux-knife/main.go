@@ -1,6 +1,11 @@
 package main
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
@@ -8,10 +13,14 @@ import (
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/btassone/swiss-linux-knife/internal/instance"
+	"github.com/btassone/swiss-linux-knife/internal/logger"
 	"github.com/btassone/swiss-linux-knife/internal/tools"
 )
 
-func createMainMenu(app fyne.App, window fyne.Window) *fyne.MainMenu {
+// createMainMenu builds the menu bar. Undo, Redo, Reload and Exit act on the
+// editor of whichever tool is showing, as returned by activeEditor.
+func createMainMenu(app fyne.App, window fyne.Window, activeEditor func() tools.Editor) *fyne.MainMenu {
 	// File menu items with shortcuts
 	newItem := fyne.NewMenuItem("New", func() {
 		dialog.ShowInformation("New", "Create new configuration", window)
@@ -44,6 +53,10 @@ func createMainMenu(app fyne.App, window fyne.Window) *fyne.MainMenu {
 	saveAsItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyS, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
 
 	exitItem := fyne.NewMenuItem("Exit", func() {
+		if editor := activeEditor(); editor != nil {
+			editor.PromptUnsaved(app.Quit)
+			return
+		}
 		app.Quit()
 	})
 	exitItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyQ, Modifier: fyne.KeyModifierControl}
@@ -58,6 +71,20 @@ func createMainMenu(app fyne.App, window fyne.Window) *fyne.MainMenu {
 	)
 
 	// Edit menu items with shortcuts
+	undoItem := fyne.NewMenuItem("Undo", func() {
+		if editor := activeEditor(); editor != nil {
+			editor.Undo()
+		}
+	})
+	undoItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierControl}
+
+	redoItem := fyne.NewMenuItem("Redo", func() {
+		if editor := activeEditor(); editor != nil {
+			editor.Redo()
+		}
+	})
+	redoItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
+
 	cutItem := fyne.NewMenuItem("Cut", func() {
 		dialog.ShowInformation("Cut", "Cut functionality not yet implemented", window)
 	})
@@ -79,6 +106,9 @@ func createMainMenu(app fyne.App, window fyne.Window) *fyne.MainMenu {
 	selectAllItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyA, Modifier: fyne.KeyModifierControl}
 
 	editMenu := fyne.NewMenu("Edit",
+		undoItem,
+		redoItem,
+		fyne.NewMenuItemSeparator(),
 		cutItem,
 		copyItem,
 		pasteItem,
@@ -96,7 +126,9 @@ func createMainMenu(app fyne.App, window fyne.Window) *fyne.MainMenu {
 		}),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Reload Configuration", func() {
-			dialog.ShowInformation("Reload", "Configuration reloaded", window)
+			if editor := activeEditor(); editor != nil {
+				editor.Reload()
+			}
 		}),
 	)
 
@@ -147,20 +179,56 @@ func showAbout(window fyne.Window) {
 	dialog.ShowCustom("About Swiss Linux Knife", "OK", content, window)
 }
 
+// fileArgs returns the command line arguments that name files, made
+// absolute so they still resolve when forwarded to a running instance.
+func fileArgs(args []string) []string {
+	files := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if abs, err := filepath.Abs(arg); err == nil {
+			arg = abs
+		}
+		files = append(files, arg)
+	}
+	return files
+}
+
 func main() {
-	myApp := app.New()
+	files := fileArgs(os.Args[1:])
+	if forwarded, err := instance.Forward(files); err != nil {
+		logger.Warn("Failed to reach the running instance: %v", err)
+	} else if forwarded {
+		return
+	}
+
+	// The ID lets preferences, such as the backup retention policy, persist.
+	myApp := app.NewWithID("io.github.btassone.swiss-linux-knife")
 	myApp.Settings().SetTheme(theme.DefaultTheme())
 
 	myWindow := myApp.NewWindow("Swiss Linux Knife")
 	myWindow.Resize(fyne.NewSize(1200, 700))
 
-	// Set up the menu
-	mainMenu := createMainMenu(myApp, myWindow)
-	myWindow.SetMainMenu(mainMenu)
-
 	content := container.NewStack()
 	availableTools := tools.GetAvailableTools()
 
+	// show replaces the tool on display, closing the one it replaces; the
+	// menu's Undo and Redo follow it.
+	var active tools.Editor
+	show := func(view tools.View) {
+		if active != nil {
+			active.Close()
+		}
+		active = view.Editor
+		content.Objects = []fyne.CanvasObject{view.Content}
+		content.Refresh()
+	}
+
+	// Set up the menu
+	mainMenu := createMainMenu(myApp, myWindow, func() tools.Editor { return active })
+	myWindow.SetMainMenu(mainMenu)
+
 	list := widget.NewList(
 		func() int { return len(availableTools) },
 		func() fyne.CanvasObject {
@@ -181,9 +249,45 @@ func main() {
 		},
 	)
 
+	// switchTo shows the view open returns for tool id once the tool on
+	// display has no unsaved edits. The sidebar stays on the current tool
+	// while the user decides.
+	current := -1
+	switchTo := func(id int, open func() tools.View) {
+		proceed := func() {
+			current = id
+			list.Select(id)
+			show(open())
+		}
+		if active == nil {
+			proceed()
+			return
+		}
+		if current >= 0 {
+			list.Select(current)
+		}
+		active.PromptUnsaved(proceed)
+	}
+
 	list.OnSelected = func(id widget.ListItemID) {
-		content.Objects = []fyne.CanvasObject{availableTools[id].Content(myWindow)}
-		content.Refresh()
+		if id == current {
+			return
+		}
+		switchTo(id, func() tools.View { return availableTools[id].Open(myWindow) })
+	}
+
+	// openFiles shows the first file in the first tool that can edit files.
+	openFiles := func(files []string) {
+		if len(files) == 0 {
+			return
+		}
+		for i, tool := range availableTools {
+			if tool.OpenFile == nil {
+				continue
+			}
+			switchTo(i, func() tools.View { return tool.OpenFile(myWindow, files[0]) })
+			return
+		}
 	}
 
 	split := container.NewHSplit(
@@ -201,8 +305,42 @@ func main() {
 	split.SetOffset(0.22)
 
 	myWindow.SetContent(split)
+	myWindow.SetCloseIntercept(func() {
+		if active == nil {
+			myWindow.Close()
+			return
+		}
+		active.PromptUnsaved(myWindow.Close)
+	})
 
 	list.Select(0)
+	openFiles(files)
+
+	// Later launches hand their files to this window instead of starting a
+	// second editor on the same files.
+	listener, err := instance.Listen(func(args []string) {
+		fyne.Do(func() {
+			myWindow.RequestFocus()
+			openFiles(args)
+		})
+	})
+	if errors.Is(err, instance.ErrRunning) {
+		// Another launch claimed the socket after this one looked for it, so
+		// hand the files to it rather than editing them in a second window.
+		forwarded, forwardErr := instance.Forward(files)
+		if forwarded {
+			return
+		}
+		if forwardErr != nil {
+			err = forwardErr
+		}
+		logger.Error("Another instance is running but could not be reached: %v", err)
+		os.Exit(1)
+	} else if err != nil {
+		logger.Warn("Running without single-instance support: %v", err)
+	} else {
+		defer listener.Close()
+	}
 
 	myWindow.ShowAndRun()
 }
\ No newline at end of file
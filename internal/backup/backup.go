@@ -0,0 +1,170 @@
+// Package backup keeps timestamped snapshots of files before they are
+// overwritten and restores them on request.
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+	"github.com/btassone/swiss-linux-knife/internal/safefile"
+)
+
+// Policy limits how many snapshots are kept for each file. Zero values do
+// not limit.
+type Policy struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+// DefaultPolicy keeps the last 20 snapshots of a file for up to 90 days.
+var DefaultPolicy = Policy{MaxCount: 20, MaxAge: 90 * 24 * time.Hour}
+
+// timeFormat names snapshot files so they sort by age.
+const timeFormat = "20060102T150405.000000000Z"
+
+// Store keeps snapshots under Dir, one directory per backed up file.
+type Store struct {
+	Dir    string
+	Policy Policy
+}
+
+// Snapshot is one saved copy of the file at Path.
+type Snapshot struct {
+	Path string
+	File string
+	Time time.Time
+}
+
+// Content returns the saved copy.
+func (s Snapshot) Content() (string, error) {
+	content, err := os.ReadFile(s.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return string(content), nil
+}
+
+// DefaultDir returns $XDG_STATE_HOME/swiss-linux-knife/backups, falling back
+// to ~/.local/state when XDG_STATE_HOME is unset.
+func DefaultDir() string {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		homeDir, _ := os.UserHomeDir()
+		state = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(state, "swiss-linux-knife", "backups")
+}
+
+// NewStore returns a store in the default directory with the default policy.
+func NewStore() *Store {
+	return &Store{Dir: DefaultDir(), Policy: DefaultPolicy}
+}
+
+// dirFor returns the directory holding the snapshots of path, named after
+// its absolute path with slashes replaced by percent signs.
+func (s *Store) dirFor(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return filepath.Join(s.Dir, strings.ReplaceAll(abs, string(filepath.Separator), "%"))
+}
+
+// Take snapshots the current content of path and prunes old snapshots. A
+// missing file has nothing to snapshot and returns nil.
+func (s *Store) Take(path string) (*Snapshot, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file for snapshot: %w", err)
+	}
+
+	dir := s.dirFor(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	now := time.Now().UTC()
+	snap := &Snapshot{Path: path, File: filepath.Join(dir, now.Format(timeFormat)), Time: now}
+	if err := os.WriteFile(snap.File, content, 0600); err != nil {
+		logger.Error("Failed to write snapshot: %v", err)
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	logger.Debug("Snapshot of %s saved to %s", path, snap.File)
+
+	if err := s.Prune(path); err != nil {
+		logger.Warn("Failed to prune snapshots: %v", err)
+	}
+	return snap, nil
+}
+
+// List returns the snapshots of path, newest first.
+func (s *Store) List(path string) ([]Snapshot, error) {
+	dir := s.dirFor(path)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		t, err := time.Parse(timeFormat, entry.Name())
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Path: path, File: filepath.Join(dir, entry.Name()), Time: t})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+// Prune removes the snapshots of path that the policy no longer keeps. The
+// newest snapshot is always kept.
+func (s *Store) Prune(path string) error {
+	snapshots, err := s.List(path)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-s.Policy.MaxAge)
+	for i, snap := range snapshots {
+		if i == 0 {
+			continue
+		}
+		tooMany := s.Policy.MaxCount > 0 && i >= s.Policy.MaxCount
+		tooOld := s.Policy.MaxAge > 0 && snap.Time.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(snap.File); err != nil {
+				return fmt.Errorf("failed to remove snapshot: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore snapshots the current file and then replaces it with the content
+// of snap. It does not lock the file; shellconfig.Config.RestoreSnapshot
+// locks it and checks it is unchanged first.
+func (s *Store) Restore(snap Snapshot) error {
+	content, err := snap.Content()
+	if err != nil {
+		return err
+	}
+	if _, err := s.Take(snap.Path); err != nil {
+		return err
+	}
+
+	if err := safefile.Write(snap.Path, []byte(content), nil); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	logger.Info("Restored %s from snapshot %s", snap.Path, snap.Time.Local().Format(time.DateTime))
+	return nil
+}
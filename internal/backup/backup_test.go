@@ -0,0 +1,77 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTakeAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".zshrc")
+	store := &Store{Dir: filepath.Join(dir, "backups"), Policy: DefaultPolicy}
+
+	if snap, err := store.Take(path); err != nil || snap != nil {
+		t.Errorf("Expected no snapshot of a missing file, got %v, %v", snap, err)
+	}
+
+	os.WriteFile(path, []byte("first\n"), 0644)
+	first, err := store.Take(path)
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	os.WriteFile(path, []byte("second\n"), 0644)
+
+	if err := store.Restore(*first); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "first\n" {
+		t.Errorf("Expected restored content, got %q", content)
+	}
+
+	snapshots, err := store.List(path)
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d (%v)", len(snapshots), err)
+	}
+	if content, _ := snapshots[0].Content(); content != "second\n" {
+		t.Errorf("Expected restore to snapshot the current file first, got %q", content)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".bashrc")
+	os.WriteFile(path, []byte("x\n"), 0644)
+	store := &Store{Dir: filepath.Join(dir, "backups"), Policy: Policy{MaxCount: 3}}
+
+	for i := 0; i < 5; i++ {
+		if _, err := store.Take(path); err != nil {
+			t.Fatalf("Failed to take snapshot: %v", err)
+		}
+	}
+	if snapshots, _ := store.List(path); len(snapshots) != 3 {
+		t.Errorf("Expected 3 snapshots after pruning by count, got %d", len(snapshots))
+	}
+
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	stale := filepath.Join(store.dirFor(path), old.Format(timeFormat))
+	os.WriteFile(stale, []byte("old\n"), 0600)
+	store.Policy = Policy{MaxAge: 24 * time.Hour}
+	if err := store.Prune(path); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected snapshot older than MaxAge to be removed")
+	}
+	if snapshots, _ := store.List(path); len(snapshots) != 3 {
+		t.Errorf("Expected recent snapshots to be kept, got %d", len(snapshots))
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	if got := DefaultDir(); got != "/state/swiss-linux-knife/backups" {
+		t.Errorf("Unexpected default directory: %s", got)
+	}
+}
@@ -0,0 +1,346 @@
+// Package diff computes line-based differences between two texts, formats
+// them as unified diffs and applies a chosen subset of their hunks.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op says what happens to a line of a diff.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is one line of a diff. Text keeps its trailing newline, so the last
+// line of a file without one round trips unchanged.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Hunk is a run of nearby changes with the context lines around it.
+// OldStart and NewStart are 1-based, as in a unified diff header.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+
+	first, last int
+}
+
+// Header returns the "@@ -a,b +c,d @@" line of the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// String returns the hunk in unified format.
+func (h Hunk) String() string {
+	var b strings.Builder
+	b.WriteString(h.Header() + "\n")
+	for _, line := range h.Lines {
+		b.WriteString(line.String())
+	}
+	return b.String()
+}
+
+func (l Line) String() string {
+	prefix := " "
+	switch l.Op {
+	case Delete:
+		prefix = "-"
+	case Insert:
+		prefix = "+"
+	}
+	if !strings.HasSuffix(l.Text, "\n") {
+		return prefix + l.Text + "\n\\ No newline at end of file\n"
+	}
+	return prefix + l.Text
+}
+
+// Context is the number of unchanged lines shown around each hunk.
+const Context = 3
+
+// Diff is the difference between an old and a new text.
+type Diff struct {
+	Hunks []Hunk
+
+	lines []Line
+}
+
+// Compute diffs old against new with the default context.
+func Compute(old, new string) *Diff {
+	return ComputeContext(old, new, Context)
+}
+
+// ComputeContext diffs old against new, keeping context unchanged lines
+// around each hunk. Changes closer together than twice the context share a
+// hunk.
+func ComputeContext(old, new string, context int) *Diff {
+	d := &Diff{lines: lineDiff(splitLines(old), splitLines(new))}
+
+	for i := 0; i < len(d.lines); {
+		if d.lines[i].Op == Equal {
+			i++
+			continue
+		}
+		end := i
+		for j := i; j < len(d.lines); j++ {
+			if d.lines[j].Op != Equal {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		d.Hunks = append(d.Hunks, d.hunk(max(0, i-context), min(len(d.lines), end+1+context)))
+		i = end + 1
+	}
+	return d
+}
+
+// hunk builds the hunk covering lines[first:last].
+func (d *Diff) hunk(first, last int) Hunk {
+	h := Hunk{first: first, last: last, Lines: d.lines[first:last]}
+	for _, line := range d.lines[:first] {
+		if line.Op != Insert {
+			h.OldStart++
+		}
+		if line.Op != Delete {
+			h.NewStart++
+		}
+	}
+	for _, line := range h.Lines {
+		if line.Op != Insert {
+			h.OldLines++
+		}
+		if line.Op != Delete {
+			h.NewLines++
+		}
+	}
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+// Empty reports whether the texts are identical.
+func (d *Diff) Empty() bool {
+	return len(d.Hunks) == 0
+}
+
+// Unified returns the diff in unified format with the given file names.
+func (d *Diff) Unified(oldName, newName string) string {
+	if d.Empty() {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("--- " + oldName + "\n")
+	b.WriteString("+++ " + newName + "\n")
+	for _, h := range d.Hunks {
+		b.WriteString(h.String())
+	}
+	return b.String()
+}
+
+// Apply returns the old text with the hunks marked in accepted changed to
+// the new text. Hunks past the end of accepted are rejected, so Apply(nil)
+// returns the old text.
+func (d *Diff) Apply(accepted []bool) string {
+	var b strings.Builder
+	hunk := 0
+	for i, line := range d.lines {
+		for hunk < len(d.Hunks) && d.Hunks[hunk].last <= i {
+			hunk++
+		}
+		apply := hunk < len(d.Hunks) && hunk < len(accepted) && accepted[hunk] && d.Hunks[hunk].first <= i
+		switch {
+		case line.Op == Equal,
+			line.Op == Delete && !apply,
+			line.Op == Insert && apply:
+			b.WriteString(line.Text)
+		}
+	}
+	return b.String()
+}
+
+// All returns an accepted slice selecting every hunk of d.
+func (d *Diff) All() []bool {
+	accepted := make([]bool, len(d.Hunks))
+	for i := range accepted {
+		accepted[i] = true
+	}
+	return accepted
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineDiff returns the shortest edit script turning a into b, using the
+// linear-space variant of Myers' algorithm.
+func lineDiff(a, b []string) []Line {
+	return compact(appendDiff(make([]Line, 0, len(a)+len(b)), a, b))
+}
+
+// compact slides each run of deleted or inserted lines down past the equal
+// lines that repeat it, and lists deletions before insertions, so the script
+// does not depend on where split cut the texts.
+func compact(lines []Line) []Line {
+	out := lines[:0:0]
+	var deleted, inserted []string
+	flush := func() {
+		for _, text := range deleted {
+			out = append(out, Line{Delete, text})
+		}
+		for _, text := range inserted {
+			out = append(out, Line{Insert, text})
+		}
+		deleted, inserted = deleted[:0], inserted[:0]
+	}
+	for _, line := range lines {
+		switch line.Op {
+		case Delete:
+			deleted = append(deleted, line.Text)
+		case Insert:
+			inserted = append(inserted, line.Text)
+		default:
+			switch {
+			case len(inserted) == 0 && len(deleted) > 0 && deleted[0] == line.Text:
+				out = append(out, line)
+				deleted = append(deleted[1:], line.Text)
+			case len(deleted) == 0 && len(inserted) > 0 && inserted[0] == line.Text:
+				out = append(out, line)
+				inserted = append(inserted[1:], line.Text)
+			default:
+				flush()
+				out = append(out, line)
+			}
+		}
+	}
+	flush()
+	return out
+}
+
+// appendDiff appends the edit script turning a into b to lines. After
+// trimming the common prefix and suffix, it splits both at a point on a
+// shortest edit path and diffs the halves, so it only ever needs memory
+// proportional to the input.
+func appendDiff(lines []Line, a, b []string) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Equal, text})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch {
+	case len(midA) == 0:
+		for _, text := range midB {
+			lines = append(lines, Line{Insert, text})
+		}
+	case len(midB) == 0:
+		for _, text := range midA {
+			lines = append(lines, Line{Delete, text})
+		}
+	default:
+		x, y := split(midA, midB)
+		lines = appendDiff(lines, midA[:x], midB[:y])
+		lines = appendDiff(lines, midA[x:], midB[y:])
+	}
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Equal, text})
+	}
+	return lines
+}
+
+// split finds where a shortest edit path from a to b crosses the middle,
+// by running Myers' search from both ends until the two paths overlap. Only
+// the furthest point of each diagonal is kept, in two slices. a and b must
+// both be non-empty and differ in their first and last lines.
+func split(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	// With an odd delta the forward search finds the overlap, otherwise the
+	// backward one.
+	odd := delta%2 != 0
+	// Diagonals that run off the edge of the grid are skipped.
+	startF, endF, startB, endB := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + startF; k <= d-endF; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				endF += 2
+			case y > m:
+				startF += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < len(backward) && backward[i] != -1 && x >= n-backward[i] {
+					return x, y
+				}
+			}
+		}
+		for k := -d + startB; k <= d-endB; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				endB += 2
+			case y > m:
+				startB += 2
+			case !odd:
+				if i := offset + delta - k; i >= 0 && i < len(forward) && forward[i] != -1 && forward[i] >= n-x {
+					return forward[i], offset + forward[i] - i
+				}
+			}
+		}
+	}
+	// Not reached for valid input; fall back to replacing everything.
+	return n, 0
+}
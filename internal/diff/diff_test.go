@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func numbered(from, to int) string {
+	var b strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestUnified(t *testing.T) {
+	old := "a\nb\nc\nd\n"
+	new := "a\nB\nc\nd\ne"
+
+	want := `--- old
++++ new
+@@ -1,4 +1,5 @@
+ a
+-b
++B
+ c
+ d
++e
+\ No newline at end of file
+`
+	if got := Compute(old, new).Unified("old", "new"); got != want {
+		t.Errorf("Unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Compute(old, old).Unified("old", "new"); got != "" {
+		t.Errorf("Expected no diff for identical texts, got:\n%s", got)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	old := numbered(1, 20)
+	new := strings.Replace(strings.Replace(old, "line 2\n", "line two\n", 1), "line 18\n", "", 1)
+
+	d := Compute(old, new)
+	if len(d.Hunks) != 2 {
+		t.Fatalf("Expected 2 hunks, got %d", len(d.Hunks))
+	}
+	if got := d.Hunks[0].Header(); got != "@@ -1,5 +1,5 @@" {
+		t.Errorf("Unexpected first hunk header: %s", got)
+	}
+	if got := d.Hunks[1].Header(); got != "@@ -15,6 +15,5 @@" {
+		t.Errorf("Unexpected second hunk header: %s", got)
+	}
+
+	// Changes within twice the context of each other share a hunk.
+	near := strings.Replace(new, "line 8\n", "line eight\n", 1)
+	if hunks := Compute(old, near).Hunks; len(hunks) != 2 {
+		t.Errorf("Expected nearby changes to merge into 2 hunks, got %d", len(hunks))
+	}
+
+	if hunks := Compute("", "x\n").Hunks; len(hunks) != 1 || hunks[0].Header() != "@@ -0,0 +1,1 @@" {
+		t.Errorf("Unexpected hunk for a new file: %v", hunks)
+	}
+}
+
+func TestApply(t *testing.T) {
+	old := numbered(1, 20)
+	new := strings.Replace(strings.Replace(old, "line 2\n", "line two\n", 1), "line 18\n", "", 1) + "extra"
+
+	d := Compute(old, new)
+	if got := d.Apply(d.All()); got != new {
+		t.Errorf("Expected all hunks to give the new text, got:\n%s", got)
+	}
+	if got := d.Apply(nil); got != old {
+		t.Errorf("Expected no hunks to give the old text, got:\n%s", got)
+	}
+
+	want := strings.Replace(old, "line 2\n", "line two\n", 1)
+	if got := d.Apply([]bool{true, false}); got != want {
+		t.Errorf("Expected only the first hunk applied, got:\n%s", got)
+	}
+}
+
+func TestMinimalEdit(t *testing.T) {
+	old := "a\nb\nc\na\nb\nb\na\n"
+	new := "c\nb\na\nb\na\nc\n"
+
+	changes := 0
+	for _, line := range Compute(old, new).lines {
+		if line.Op != Equal {
+			changes++
+		}
+	}
+	if changes != 5 {
+		t.Errorf("Expected a 5 line edit script, got %d", changes)
+	}
+}
+
+func TestChangesSlideDown(t *testing.T) {
+	old := "u\nb\nl\ns\n"
+	new := "l\no\nu\nb\nb\n"
+
+	want := "@@ -1,4 +1,5 @@\n+l\n+o\n u\n b\n-l\n-s\n+b\n"
+	if got := Compute(old, new).Hunks[0].String(); got != want {
+		t.Errorf("Unexpected hunk:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMinimalEditRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.Intn(4))) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		// The shortest script keeps every line of a longest common
+		// subsequence and changes the rest.
+		lcs := make([][]int, len(a)+1)
+		for x := range lcs {
+			lcs[x] = make([]int, len(b)+1)
+		}
+		for x := len(a) - 1; x >= 0; x-- {
+			for y := len(b) - 1; y >= 0; y-- {
+				if a[x] == b[y] {
+					lcs[x][y] = lcs[x+1][y+1] + 1
+				} else {
+					lcs[x][y] = max(lcs[x+1][y], lcs[x][y+1])
+				}
+			}
+		}
+
+		d := Compute(strings.Join(a, ""), strings.Join(b, ""))
+		changes := 0
+		for _, line := range d.lines {
+			if line.Op != Equal {
+				changes++
+			}
+		}
+		if want := len(a) + len(b) - 2*lcs[0][0]; changes != want {
+			t.Fatalf("Expected a %d line edit script for %q to %q, got %d", want, a, b, changes)
+		}
+		if got := d.Apply(d.All()); got != strings.Join(b, "") {
+			t.Fatalf("Expected the diff of %q to %q to apply, got %q", a, b, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Conflict markers written around changes that both sides made differently
+// to the same lines.
+const (
+	MarkerOurs   = "<<<<<<< ours"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>> theirs"
+)
+
+// chunk replaces base lines [start, end) with lines.
+type chunk struct {
+	start, end int
+	lines      []string
+}
+
+// chunks returns the changes the diff makes to its old text.
+func (d *Diff) chunks() []chunk {
+	chunks := []chunk{}
+	old := 0
+	for i := 0; i < len(d.lines); {
+		if d.lines[i].Op == Equal {
+			old++
+			i++
+			continue
+		}
+		c := chunk{start: old}
+		for ; i < len(d.lines) && d.lines[i].Op != Equal; i++ {
+			if d.lines[i].Op == Delete {
+				old++
+			} else {
+				c.lines = append(c.lines, d.lines[i].Text)
+			}
+		}
+		c.end = old
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+// Merge combines the changes ours and theirs each made to base. Changes to
+// separate lines are both kept; changes to the same lines that differ are
+// written between conflict markers, ours first. It returns the merged text
+// and the number of conflicts.
+func Merge(base, ours, theirs string) (string, int) {
+	baseLines := splitLines(base)
+	sides := [2][]chunk{Compute(base, ours).chunks(), Compute(base, theirs).chunks()}
+
+	var b strings.Builder
+	conflicts := 0
+	pos := 0
+	next := [2]int{}
+	for next[0] < len(sides[0]) || next[1] < len(sides[1]) {
+		// Start a region at the earliest pending change and grow it while
+		// either side has a change overlapping or touching its end.
+		first := 0
+		if next[0] >= len(sides[0]) || next[1] < len(sides[1]) && sides[1][next[1]].start < sides[0][next[0]].start {
+			first = 1
+		}
+		start, end := sides[first][next[first]].start, sides[first][next[first]].end
+		lastInsert := start == end
+		region := [2][]chunk{}
+		region[first] = append(region[first], sides[first][next[first]])
+		next[first]++
+		for grown := true; grown; {
+			grown = false
+			for side := 0; side < 2; side++ {
+				for next[side] < len(sides[side]) {
+					c := sides[side][next[side]]
+					if c.start > end || c.start == end && c.start != c.end && !lastInsert {
+						break
+					}
+					region[side] = append(region[side], c)
+					next[side]++
+					end = max(end, c.end)
+					lastInsert = c.start == c.end
+					grown = true
+				}
+			}
+		}
+
+		for _, line := range baseLines[pos:start] {
+			b.WriteString(line)
+		}
+		pos = end
+		mine := apply(baseLines, start, end, region[0])
+		other := apply(baseLines, start, end, region[1])
+		switch {
+		case len(region[1]) == 0 || mine == other:
+			b.WriteString(mine)
+		case len(region[0]) == 0:
+			b.WriteString(other)
+		default:
+			conflicts++
+			b.WriteString(MarkerOurs + "\n")
+			b.WriteString(withNewline(mine))
+			b.WriteString(MarkerSep + "\n")
+			b.WriteString(withNewline(other))
+			b.WriteString(MarkerTheirs + "\n")
+		}
+	}
+	for _, line := range baseLines[pos:] {
+		b.WriteString(line)
+	}
+	return b.String(), conflicts
+}
+
+// apply returns base lines [start, end) with the chunks applied.
+func apply(base []string, start, end int, chunks []chunk) string {
+	var b strings.Builder
+	pos := start
+	for _, c := range chunks {
+		for _, line := range base[pos:c.start] {
+			b.WriteString(line)
+		}
+		for _, line := range c.lines {
+			b.WriteString(line)
+		}
+		pos = c.end
+	}
+	for _, line := range base[pos:end] {
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func withNewline(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		return text + "\n"
+	}
+	return text
+}
@@ -0,0 +1,41 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeSeparateChanges(t *testing.T) {
+	base := numbered(1, 10)
+	ours := strings.Replace(base, "line 2\n", "line two\n", 1)
+	theirs := strings.Replace(base, "line 8\n", "line 8\nline 8b\n", 1)
+
+	merged, conflicts := Merge(base, ours, theirs)
+	want := strings.Replace(ours, "line 8\n", "line 8\nline 8b\n", 1)
+	if conflicts != 0 || merged != want {
+		t.Errorf("Expected a clean merge, got %d conflicts:\n%s", conflicts, merged)
+	}
+
+	// Identical changes on both sides are not a conflict.
+	if merged, conflicts := Merge(base, ours, ours); conflicts != 0 || merged != ours {
+		t.Errorf("Expected identical changes to merge cleanly, got %d conflicts:\n%s", conflicts, merged)
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	base := "export EDITOR=vi\nalias ll='ls -l'\n"
+	ours := "export EDITOR=nvim\nalias ll='ls -l'\n"
+	theirs := "export EDITOR=emacs\nalias ll='ls -l'\nalias la='ls -A'\n"
+
+	merged, conflicts := Merge(base, ours, theirs)
+	want := MarkerOurs + "\nexport EDITOR=nvim\n" + MarkerSep + "\nexport EDITOR=emacs\n" + MarkerTheirs + "\nalias ll='ls -l'\nalias la='ls -A'\n"
+	if conflicts != 1 || merged != want {
+		t.Errorf("Expected one conflict, got %d:\n%s", conflicts, merged)
+	}
+
+	// Both sides appending at the end of the file conflict too.
+	merged, conflicts = Merge("a\n", "a\nb\n", "a\nc\n")
+	if conflicts != 1 || !strings.HasPrefix(merged, "a\n"+MarkerOurs+"\nb\n") {
+		t.Errorf("Expected appends to conflict, got %d:\n%s", conflicts, merged)
+	}
+}
@@ -0,0 +1,141 @@
+// Package filelock coordinates access to files between processes with
+// advisory flock locks held on sidecar lock files.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Timeout is how long Lock waits for another process to release a lock.
+var Timeout = 5 * time.Second
+
+// ErrLocked is returned when a lock is still held by another process after
+// Timeout.
+var ErrLocked = errors.New("file is locked by another process")
+
+// Lock is a held lock. Release it when done.
+type Lock struct {
+	file *os.File
+}
+
+// RuntimeDir returns the app's directory for locks and sockets under
+// $XDG_RUNTIME_DIR, or under the user's cache directory when that is not
+// set. It is created private to the current user and refused when another
+// user owns it or can reach into it, since a shared name in /tmp could be
+// claimed by anyone first.
+func RuntimeDir() (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find a runtime directory: %w", err)
+		}
+		base = cache
+	}
+	dir := filepath.Join(base, "swiss-linux-knife")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	if err := CheckOwner(dir); err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	if !info.IsDir() || info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("runtime directory %s must be a directory only its owner can access", dir)
+	}
+	return dir, nil
+}
+
+// CheckOwner returns an error unless path, not following a symlink, belongs
+// to the current user.
+func CheckOwner(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by another user", path)
+	}
+	return nil
+}
+
+// Dir returns the directory holding the lock files, in RuntimeDir so they do
+// not clutter the home directory or a dotfiles repository.
+func Dir() (string, error) {
+	dir, err := RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "locks"), nil
+}
+
+// lockPath returns the sidecar lock file for path in dir. Symlinks are
+// resolved so a link and its target share a lock.
+func lockPath(dir, path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	} else if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return filepath.Join(dir, strings.ReplaceAll(path, string(filepath.Separator), "%")+".lock")
+}
+
+// Shared takes a lock on path that other readers may also hold.
+func Shared(path string) (*Lock, error) {
+	return acquire(path, unix.LOCK_SH)
+}
+
+// Exclusive takes a lock on path that no other process may hold.
+func Exclusive(path string) (*Lock, error) {
+	return acquire(path, unix.LOCK_EX)
+}
+
+func acquire(path string, how int) (*Lock, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(lockPath(dir, path), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(Timeout)
+	for {
+		err := unix.Flock(int(file.Fd()), how|unix.LOCK_NB)
+		if err == nil {
+			return &Lock{file: file}, nil
+		}
+		if !errors.Is(err, unix.EWOULDBLOCK) || time.Now().After(deadline) {
+			file.Close()
+			if errors.Is(err, unix.EWOULDBLOCK) {
+				return nil, fmt.Errorf("%s: %w", path, ErrLocked)
+			}
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Release drops the lock.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	defer l.file.Close()
+	return unix.Flock(int(l.file.Fd()), unix.LOCK_UN)
+}
@@ -0,0 +1,56 @@
+package filelock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocks(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	Timeout = 100 * time.Millisecond
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".zshrc")
+	link := filepath.Join(dir, ".zshrc.link")
+	os.WriteFile(path, []byte(""), 0644)
+	os.Symlink(path, link)
+
+	first, err := Shared(path)
+	if err != nil {
+		t.Fatalf("Failed to take shared lock: %v", err)
+	}
+	second, err := Shared(link)
+	if err != nil {
+		t.Fatalf("Expected shared locks to coexist, got %v", err)
+	}
+	if _, err := Exclusive(link); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected exclusive lock through the symlink to wait for readers, got %v", err)
+	}
+
+	first.Release()
+	second.Release()
+	lock, err := Exclusive(path)
+	if err != nil {
+		t.Fatalf("Failed to take exclusive lock after release: %v", err)
+	}
+	if _, err := Shared(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected shared lock to wait for the writer, got %v", err)
+	}
+	lock.Release()
+}
+
+func TestRuntimeDirMustBePrivate(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", base)
+	os.Mkdir(filepath.Join(base, "swiss-linux-knife"), 0700)
+	os.Chmod(filepath.Join(base, "swiss-linux-knife"), 0777)
+
+	if _, err := RuntimeDir(); err == nil {
+		t.Error("Expected a runtime directory others can write to be refused")
+	}
+	if _, err := Shared(filepath.Join(base, ".zshrc")); err == nil {
+		t.Error("Expected no lock to be taken in a shared directory")
+	}
+}
@@ -0,0 +1,92 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/btassone/swiss-linux-knife/internal/diff"
+)
+
+// FileDiff is one file shown in a diff review. Accepted holds a flag per
+// hunk and is updated as hunks are ticked or unticked.
+type FileDiff struct {
+	Name     string
+	Note     string
+	Diff     *diff.Diff
+	Accepted []bool
+}
+
+// ShowDiffReview shows the pending changes to files as unified diffs with a
+// checkbox per hunk. onApply is called if the user confirms; the caller then
+// writes only the accepted hunks.
+func ShowDiffReview(title string, files []FileDiff, onApply func(), window fyne.Window) {
+	content := container.NewVBox()
+	for _, file := range files {
+		heading := file.Name
+		if file.Note != "" {
+			heading += " (" + file.Note + ")"
+		}
+		content.Add(widget.NewLabelWithStyle(heading, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+		if file.Diff.Empty() {
+			content.Add(widget.NewLabel("No content changes"))
+		}
+		for i, hunk := range file.Diff.Hunks {
+			accepted := file.Accepted
+			index := i
+			check := widget.NewCheck(fmt.Sprintf("Apply %s", hunk.Header()), func(checked bool) {
+				accepted[index] = checked
+			})
+			check.SetChecked(accepted[index])
+			content.Add(check)
+			content.Add(hunkGrid(hunk))
+		}
+		content.Add(widget.NewSeparator())
+	}
+
+	scroll := container.NewScroll(content)
+	scroll.SetMinSize(fyne.NewSize(700, 450))
+	dialog.ShowCustomConfirm(title, "Write Accepted", "Cancel", scroll, func(ok bool) {
+		if ok {
+			onApply()
+		}
+	}, window)
+}
+
+// hunkGrid renders a hunk in a monospace grid, colouring removed and added
+// lines.
+func hunkGrid(hunk diff.Hunk) *widget.TextGrid {
+	rows := []string{}
+	for _, line := range hunk.Lines {
+		rows = append(rows, strings.TrimSuffix(line.String(), "\n"))
+	}
+	grid := widget.NewTextGridFromString(strings.Join(rows, "\n"))
+	removed := &widget.CustomTextGridStyle{FGColor: theme.Color(theme.ColorNameError)}
+	added := &widget.CustomTextGridStyle{FGColor: theme.Color(theme.ColorNameSuccess)}
+	for row, line := range hunk.Lines {
+		switch line.Op {
+		case diff.Delete:
+			grid.SetRowStyle(row, removed)
+		case diff.Insert:
+			grid.SetRowStyle(row, added)
+		}
+	}
+	return grid
+}
+
+// diffView renders every hunk of d under its header, for read-only display.
+func diffView(d *diff.Diff) fyne.CanvasObject {
+	if d.Empty() {
+		return widget.NewLabel("No differences")
+	}
+	content := container.NewVBox()
+	for _, hunk := range d.Hunks {
+		content.Add(widget.NewLabelWithStyle(hunk.Header(), fyne.TextAlignLeading, fyne.TextStyle{Monospace: true}))
+		content.Add(hunkGrid(hunk))
+	}
+	return content
+}
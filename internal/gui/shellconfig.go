@@ -1,16 +1,22 @@
 package gui
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
+	"github.com/btassone/swiss-linux-knife/internal/backup"
+	"github.com/btassone/swiss-linux-knife/internal/diff"
 	"github.com/btassone/swiss-linux-knife/internal/shellconfig"
 )
 
@@ -22,6 +28,28 @@ type ShellConfigGUI struct {
 	themeSelect   *widget.Select
 	pluginsList   *widget.List
 	pluginChecks  map[string]bool
+	body          *fyne.Container
+	tabs          *container.AppTabs
+	watcher       *shellconfig.Watcher
+	// resolving is set while the user decides what to do about files
+	// changed on disk, so further notifications wait.
+	resolving bool
+	// closed is set once the GUI is no longer shown, so notifications
+	// already queued are dropped.
+	closed bool
+	// reveal switches to the tab listing entries of a kind and selects the
+	// named one. Each tab registers its own.
+	reveal map[shellconfig.NodeKind]func(name string)
+	// evaluator expands exports for the Effective Value column in the
+	// background, and effective holds the last result. evaluating is set
+	// while an evaluation runs, and evaluateAgain when the config changed
+	// since it started.
+	evaluator     *shellconfig.Evaluator
+	effective     *shellconfig.Evaluations
+	evaluating    bool
+	evaluateAgain bool
+	// graph backs the Depends On column until the next edit.
+	graph *shellconfig.VariableGraph
 }
 
 func NewShellConfigGUI(window fyne.Window) *ShellConfigGUI {
@@ -34,85 +62,647 @@ func NewShellConfigGUI(window fyne.Window) *ShellConfigGUI {
 	return gui
 }
 
+// NewShellConfigGUIForFile returns a GUI editing path instead of the login
+// shell's default startup file.
+func NewShellConfigGUIForFile(window fyne.Window, path string) *ShellConfigGUI {
+	gui := NewShellConfigGUI(window)
+	gui.config = shellconfig.NewForFile(path)
+	return gui
+}
+
 func (gui *ShellConfigGUI) CreateContent() fyne.CanvasObject {
+	gui.body = container.NewStack()
+	gui.openFile(gui.config.FilePath)
+
+	homeDir, _ := os.UserHomeDir()
+	files := shellconfig.ExistingConfigFiles(homeDir)
+	if !containsString(files, gui.config.FilePath) {
+		files = append([]string{gui.config.FilePath}, files...)
+	}
+	var fileSelect *widget.Select
+	fileSelect = widget.NewSelect(files, func(selected string) {
+		if selected == gui.config.FilePath {
+			return
+		}
+		// Stay on the current file until its edits are saved or discarded.
+		fileSelect.SetSelected(gui.config.FilePath)
+		gui.PromptUnsaved(func() {
+			gui.openFile(selected)
+			fileSelect.SetSelected(selected)
+		})
+	})
+	fileSelect.SetSelected(gui.config.FilePath)
+
+	saveButton := widget.NewButton("Save Configuration", func() {
+		gui.saveConfiguration(nil)
+	})
+	saveButton.Importance = widget.HighImportance
+
+	reloadButton := widget.NewButton("Reload", gui.Reload)
+	previewButton := widget.NewButton("Preview Environment", gui.previewEnvironment)
+
+	var modeSelect *widget.Select
+	modeSelect = widget.NewSelect(writeModeNames, func(selected string) {
+		mode := writeModeFromName(selected)
+		if mode == gui.config.Mode {
+			return
+		}
+		modeSelect.SetSelected(writeModeNames[gui.config.Mode])
+		gui.PromptUnsaved(func() {
+			saveWriteMode(mode)
+			gui.openFile(gui.config.FilePath)
+			modeSelect.SetSelected(selected)
+		})
+	})
+	modeSelect.SetSelected(writeModeNames[gui.config.Mode])
+
+	return container.NewBorder(
+		container.NewBorder(nil, nil, widget.NewLabel("Editing:"),
+			container.NewHBox(widget.NewLabel("Write to:"), modeSelect), fileSelect),
+		container.NewPadded(
+			container.NewHBox(
+				saveButton,
+				reloadButton,
+				previewButton,
+			),
+		),
+		nil,
+		nil,
+		gui.body,
+	)
+}
+
+// openFile loads path, switching dialect if needed, and rebuilds the tabs
+// so every view reflects the newly loaded file.
+func (gui *ShellConfigGUI) openFile(path string) {
+	if path != gui.config.FilePath {
+		gui.config = shellconfig.NewForFile(path)
+	}
+	gui.config.Backups.Policy = loadBackupPolicy()
+	gui.config.Mode = loadWriteMode()
+
 	if err := gui.config.Load(); err != nil {
-		return container.NewCenter(
+		gui.body.Objects = []fyne.CanvasObject{container.NewCenter(
 			widget.NewLabel(fmt.Sprintf("Error loading config: %v", err)),
-		)
+		)}
+		gui.body.Refresh()
+		return
 	}
+	gui.watch()
+	gui.showConfig()
+}
 
+// showConfig rebuilds the tabs from the config in memory.
+func (gui *ShellConfigGUI) showConfig() {
+	gui.pluginChecks = make(map[string]bool)
 	for _, plugin := range gui.config.OhMyZshPlugins {
 		gui.pluginChecks[plugin] = true
 	}
+	gui.body.Objects = []fyne.CanvasObject{gui.createTabs()}
+	gui.body.Refresh()
+}
+
+// Reload rereads the config from disk once unsaved edits are saved or
+// discarded.
+func (gui *ShellConfigGUI) Reload() {
+	gui.PromptUnsaved(func() {
+		gui.openFile(gui.config.FilePath)
+	})
+}
+
+// PromptUnsaved calls proceed once the user has saved or discarded the
+// unsaved edits, straight away if there are none. Nothing happens if the
+// user cancels.
+func (gui *ShellConfigGUI) PromptUnsaved(proceed func()) {
+	if !gui.config.Modified() {
+		proceed()
+		return
+	}
+	message := widget.NewLabel(fmt.Sprintf("%s has unsaved changes. Save them first?", shellconfig.ShortPath(gui.config.FilePath)))
+	d := dialog.NewCustomWithoutButtons("Unsaved Changes", message, gui.window)
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Cancel", d.Hide),
+		widget.NewButton("Discard", func() {
+			d.Hide()
+			proceed()
+		}),
+		&widget.Button{Text: "Save", Importance: widget.HighImportance, OnTapped: func() {
+			d.Hide()
+			// Hunks left out of the save are still pending, so ask again.
+			gui.saveConfiguration(func() {
+				gui.PromptUnsaved(proceed)
+			})
+		}},
+	})
+	d.Show()
+}
+
+// record adds the edits made since the last call to the undo history and
+// marks the tabs they belong to.
+func (gui *ShellConfigGUI) record(label string) {
+	gui.config.Record(label)
+	gui.recorded()
+}
+
+// recordTyping is record for a keystroke in a field, so that typing a value
+// is undone in one step.
+func (gui *ShellConfigGUI) recordTyping(label string) {
+	gui.config.RecordTyping(label)
+	gui.recorded()
+}
+
+func (gui *ShellConfigGUI) recorded() {
+	gui.graph = nil
+	gui.evaluate()
+	gui.markModified()
+}
+
+// modifiedMark is appended to the titles of tabs with unsaved edits.
+const modifiedMark = " •"
+
+// tabKinds lists the kinds of entries each tab edits.
+var tabKinds = map[string][]shellconfig.NodeKind{
+	"Environment": {shellconfig.NodeExport},
+	"Aliases":     {shellconfig.NodeAlias},
+	"Shell":       {shellconfig.NodeVariable, shellconfig.NodeOption},
+	"Oh My Zsh":   {shellconfig.NodeTheme, shellconfig.NodePlugins},
+	"Functions":   {shellconfig.NodeFunction},
+}
+
+// markModified marks the tabs whose entries have unsaved edits.
+func (gui *ShellConfigGUI) markModified() {
+	if gui.tabs == nil {
+		return
+	}
+	modified := gui.config.ModifiedEntries()
+	changed := false
+	for _, item := range gui.tabs.Items {
+		title := strings.TrimSuffix(item.Text, modifiedMark)
+		pending := false
+		for _, kind := range tabKinds[title] {
+			pending = pending || len(modified[kind]) > 0
+		}
+		if title == "Path" {
+			pending = containsString(modified[shellconfig.NodeExport], "PATH")
+		}
+		if pending {
+			title += modifiedMark
+		}
+		if item.Text != title {
+			item.Text = title
+			changed = true
+		}
+	}
+	if changed {
+		gui.tabs.Refresh()
+	}
+}
+
+// Undo reverts the last edit to the config.
+func (gui *ShellConfigGUI) Undo() {
+	gui.step(gui.config.Undo)
+}
+
+// Redo applies the last undone edit again.
+func (gui *ShellConfigGUI) Redo() {
+	gui.step(gui.config.Redo)
+}
+
+// step moves through the undo history and rebuilds the tabs, staying on
+// the tab that was showing.
+func (gui *ShellConfigGUI) step(move func() (string, error)) {
+	label, err := move()
+	if err != nil {
+		dialog.ShowError(err, gui.window)
+		return
+	}
+	if label != "" {
+		gui.refreshTabs()
+	}
+}
+
+// refreshTabs rebuilds the tabs after the typed fields were replaced,
+// staying on the tab that was showing.
+func (gui *ShellConfigGUI) refreshTabs() {
+	if gui.tabs == nil {
+		return
+	}
+	selected := gui.tabs.SelectedIndex()
+	gui.showConfig()
+	gui.tabs.SelectIndex(selected)
+}
+
+// Close stops watching the config's files once the GUI is replaced by
+// another view.
+func (gui *ShellConfigGUI) Close() {
+	gui.closed = true
+	if gui.watcher != nil {
+		gui.watcher.Close()
+		gui.watcher = nil
+	}
+}
+
+// watch restarts watching the files of the loaded config for changes made
+// by other programs.
+func (gui *ShellConfigGUI) watch() {
+	if gui.watcher != nil {
+		gui.watcher.Close()
+		gui.watcher = nil
+	}
+	if gui.closed {
+		return
+	}
+	watcher, err := gui.config.Watch(func(string) {
+		fyne.Do(gui.checkExternalChanges)
+	})
+	if err != nil {
+		return
+	}
+	gui.watcher = watcher
+}
+
+// checkExternalChanges reloads files changed on disk. If the config has
+// unsaved edits, the user chooses between reloading, keeping their edits and
+// merging the two.
+func (gui *ShellConfigGUI) checkExternalChanges() {
+	if gui.resolving || gui.closed {
+		return
+	}
+	changed := gui.config.ExternalChanges()
+	if len(changed) == 0 {
+		return
+	}
+	if !gui.config.Modified() {
+		gui.openFile(gui.config.FilePath)
+		return
+	}
 
+	names := []string{}
+	for _, path := range changed {
+		names = append(names, shellconfig.ShortPath(path))
+	}
+	message := widget.NewLabel(fmt.Sprintf(
+		"%s changed on disk while you have unsaved edits.\n\n"+
+			"Reload discards your edits, Keep My Edits overwrites the changes on the next save,\n"+
+			"and Merge combines both.", strings.Join(names, ", ")))
+
+	gui.resolving = true
+	d := dialog.NewCustomWithoutButtons("Files Changed on Disk", message, gui.window)
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Reload", func() {
+			d.Hide()
+			gui.resolving = false
+			gui.openFile(gui.config.FilePath)
+		}),
+		widget.NewButton("Keep My Edits", func() {
+			d.Hide()
+			gui.resolving = false
+			for _, path := range changed {
+				if err := gui.config.Overwrite(path); err != nil {
+					dialog.ShowError(err, gui.window)
+				}
+			}
+			gui.markModified()
+		}),
+		&widget.Button{Text: "Merge", Importance: widget.HighImportance, OnTapped: func() {
+			d.Hide()
+			gui.mergeExternal(changed)
+		}},
+	})
+	d.Show()
+}
+
+// mergeExternal merges the changes on disk into each path in turn. Clean
+// merges apply directly; conflicts are shown for the user to resolve.
+func (gui *ShellConfigGUI) mergeExternal(paths []string) {
+	if len(paths) == 0 {
+		gui.resolving = false
+		gui.showConfig()
+		return
+	}
+	path := paths[0]
+	merged, conflicts, err := gui.config.Merge(path)
+	if err != nil {
+		gui.resolving = false
+		dialog.ShowError(err, gui.window)
+		return
+	}
+	if conflicts == 0 {
+		if err := gui.config.ApplyMerge(path, merged); err != nil {
+			gui.resolving = false
+			dialog.ShowError(err, gui.window)
+			return
+		}
+		gui.mergeExternal(paths[1:])
+		return
+	}
+
+	editor := widget.NewMultiLineEntry()
+	editor.TextStyle = fyne.TextStyle{Monospace: true}
+	editor.SetText(merged)
+	scroll := container.NewScroll(editor)
+	scroll.SetMinSize(fyne.NewSize(700, 450))
+	help := widget.NewLabel(fmt.Sprintf("Edit the %d conflicting sections, keeping the lines you want and removing the markers.", conflicts))
+
+	dialog.ShowCustomConfirm("Resolve Conflicts in "+shellconfig.ShortPath(path), "Apply", "Cancel",
+		container.NewBorder(help, nil, nil, nil, scroll),
+		func(ok bool) {
+			if !ok {
+				gui.resolving = false
+				gui.showConfig()
+				return
+			}
+			if err := gui.config.ApplyMerge(path, editor.Text); err != nil {
+				gui.resolving = false
+				dialog.ShowError(err, gui.window)
+				return
+			}
+			gui.mergeExternal(paths[1:])
+		}, gui.window)
+}
+
+func (gui *ShellConfigGUI) createTabs() fyne.CanvasObject {
+	gui.reveal = make(map[shellconfig.NodeKind]func(string))
 	tabs := container.NewAppTabs(
 		container.NewTabItem("Environment", gui.createEnvironmentTab()),
 		container.NewTabItem("Path", gui.createPathTab()),
 		container.NewTabItem("Aliases", gui.createAliasesTab()),
-		container.NewTabItem("Oh My Zsh", gui.createOhMyZshTab()),
-		container.NewTabItem("Functions", gui.createFunctionsTab()),
-		container.NewTabItem("History", gui.createHistoryTab()),
+		container.NewTabItem("Shell", gui.createShellTab()),
 	)
+	if gui.config.OhMyZsh() {
+		tabs.Append(container.NewTabItem("Oh My Zsh", gui.createOhMyZshTab()))
+	}
+	tabs.Append(container.NewTabItem("Functions", gui.createFunctionsTab()))
+	switch gui.config.Mode {
+	case shellconfig.WriteManagedBlock:
+		tabs.Append(container.NewTabItem("Managed Block", gui.createManagedBlockTab()))
+	case shellconfig.WriteDropIn:
+		tabs.Append(container.NewTabItem("Drop-in Files", gui.createManagedBlockTab()))
+	}
+	tabs.Append(container.NewTabItem("History", gui.createHistoryTab()))
+	tabs.Append(container.NewTabItem("Files", gui.createFilesTab()))
+	tabs.Append(container.NewTabItem("Backups", gui.createBackupsTab()))
+	gui.tabs = tabs
+	gui.markModified()
+	return tabs
+}
 
-	saveButton := widget.NewButton("Save Configuration", func() {
-		gui.saveConfiguration()
+// selectTab switches to the tab with the given title.
+func (gui *ShellConfigGUI) selectTab(title string) {
+	for _, item := range gui.tabs.Items {
+		if strings.TrimSuffix(item.Text, modifiedMark) == title {
+			gui.tabs.Select(item)
+		}
+	}
+}
+
+// selectRow selects the first cell of a table row and scrolls it into view.
+func selectRow(table *widget.Table, row int) {
+	id := widget.TableCellID{Row: row, Col: 0}
+	table.Select(id)
+	table.ScrollTo(id)
+}
+
+// rowOf returns the index of the row named name, counting the guarded
+// entries listed after the plain rows.
+func rowOf(rows [][]string, guarded []*shellconfig.GuardedEntry, name string) int {
+	for i, row := range rows {
+		if row[0] == name {
+			return i
+		}
+	}
+	for i, entry := range guarded {
+		if entry.Name == name {
+			return len(rows) + i
+		}
+	}
+	return -1
+}
+
+func (gui *ShellConfigGUI) createShellTab() fyne.CanvasObject {
+	optionNames := []string{}
+	for name := range gui.config.Options {
+		optionNames = append(optionNames, name)
+	}
+	sort.Strings(optionNames)
+
+	optionsList := widget.NewList(
+		func() int { return len(optionNames) },
+		func() fyne.CanvasObject {
+			return widget.NewCheck("Option", func(bool) {})
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			name := optionNames[id]
+			check := item.(*widget.Check)
+			check.SetText(name)
+			check.OnChanged = nil
+			check.SetChecked(gui.config.Options[name])
+			check.OnChanged = func(checked bool) {
+				gui.config.Options[name] = checked
+				gui.record("Toggle option " + name)
+			}
+		},
+	)
+
+	optionEntry := widget.NewEntry()
+	optionEntry.SetPlaceHolder("Option name")
+	addOptionButton := widget.NewButton("Enable Option", func() {
+		name := strings.TrimSpace(optionEntry.Text)
+		if name == "" {
+			return
+		}
+		if _, ok := gui.config.Options[name]; !ok {
+			optionNames = append(optionNames, name)
+		}
+		gui.config.Options[name] = true
+		gui.record("Enable option " + name)
+		optionEntry.SetText("")
+		optionsList.Refresh()
 	})
-	saveButton.Importance = widget.HighImportance
 
-	reloadButton := widget.NewButton("Reload", func() {
-		gui.config.Load()
-		gui.refreshAll()
+	variableData := [][]string{}
+	for name, value := range gui.config.Variables {
+		variableData = append(variableData, []string{name, value})
+	}
+	sort.Slice(variableData, func(i, j int) bool { return variableData[i][0] < variableData[j][0] })
+
+	variablesTable := widget.NewTable(
+		func() (int, int) { return len(variableData), 2 },
+		func() fyne.CanvasObject {
+			return widget.NewEntry()
+		},
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			entry := cell.(*widget.Entry)
+			entry.OnChanged = nil
+			entry.SetText(variableData[id.Row][id.Col])
+			entry.OnChanged = func(text string) {
+				variableData[id.Row][id.Col] = text
+				gui.updateVariablesFromTable(variableData)
+				gui.recordTyping(cellLabel("variable", id))
+			}
+		},
+	)
+	variablesTable.SetColumnWidth(0, 200)
+	variablesTable.SetColumnWidth(1, 400)
+	gui.reveal[shellconfig.NodeVariable] = func(name string) {
+		gui.selectTab("Shell")
+		if row := rowOf(variableData, nil, name); row >= 0 {
+			selectRow(variablesTable, row)
+		}
+	}
+
+	addVariableButton := widget.NewButton("Add Variable", func() {
+		variableData = append(variableData, []string{"NEW_VAR", ""})
+		gui.updateVariablesFromTable(variableData)
+		gui.record("Add variable")
+		variablesTable.Refresh()
 	})
 
-	return container.NewBorder(
-		nil,
-		container.NewPadded(
-			container.NewHBox(
-				saveButton,
-				reloadButton,
+	optionsCommand := "setopt"
+	if gui.config.Dialect == shellconfig.Bash {
+		optionsCommand = "shopt"
+	}
+
+	variablesPanel := container.NewBorder(
+		widget.NewCard("Shell Variables", "Not exported to child processes", addVariableButton),
+		nil, nil, nil,
+		container.NewScroll(variablesTable),
+	)
+	if !gui.config.Dialect.Supports(shellconfig.NodeOption) {
+		return variablesPanel
+	}
+
+	return container.NewHSplit(
+		container.NewBorder(
+			widget.NewCard("Shell Options", optionsCommand,
+				container.NewBorder(nil, nil, nil, addOptionButton, optionEntry),
 			),
+			nil, nil, nil,
+			optionsList,
 		),
-		nil,
-		nil,
-		tabs,
+		variablesPanel,
 	)
 }
 
 func (gui *ShellConfigGUI) createEnvironmentTab() fyne.CanvasObject {
 	exportData := [][]string{}
-	for key, value := range gui.config.Exports {
-		exportData = append(exportData, []string{key, value})
+	for _, key := range gui.config.ExportNames() {
+		exportData = append(exportData, []string{key, gui.config.Exports[key], gui.config.Description(shellconfig.NodeExport, key)})
 	}
+	guarded := gui.guardedEntries(shellconfig.NodeExport)
+	if gui.evaluator == nil {
+		gui.evaluator = &shellconfig.Evaluator{}
+	}
+	gui.effective = nil
+	gui.graph = nil
 
-	gui.exportsTable = widget.NewTable(
-		func() (int, int) { return len(exportData), 2 },
+	gui.exportsTable = widget.NewTableWithHeaders(
+		func() (int, int) { return len(exportData) + len(guarded), len(exportColumns) },
 		func() fyne.CanvasObject {
-			return widget.NewEntry()
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return container.NewStack(widget.NewEntry(), label)
 		},
 		func(id widget.TableCellID, cell fyne.CanvasObject) {
-			entry := cell.(*widget.Entry)
+			stack := cell.(*fyne.Container)
+			entry := stack.Objects[0].(*widget.Entry)
+			label := stack.Objects[1].(*widget.Label)
+			entry.OnChanged = nil
+			if id.Col >= effectiveColumn {
+				entry.Hide()
+				label.Show()
+				name := ""
+				var entry *shellconfig.GuardedEntry
+				if id.Row < len(exportData) {
+					name = exportData[id.Row][0]
+				} else {
+					entry = guarded[id.Row-len(exportData)]
+				}
+				if id.Col == effectiveColumn {
+					gui.showEffectiveValue(label, name, entry)
+				} else {
+					gui.showDependencies(label, name)
+				}
+				return
+			}
+			label.Hide()
+			entry.Show()
+			if id.Row >= len(exportData) {
+				gui.updateGuardedCell(entry, guarded[id.Row-len(exportData)], id.Col)
+				return
+			}
+			if id.Col >= 3 {
+				entry.SetText("")
+				if id.Col == 4 {
+					entry.SetText(gui.originText(shellconfig.NodeExport, exportData[id.Row][0]))
+				}
+				entry.Disable()
+				return
+			}
+			entry.Enable()
 			entry.SetText(exportData[id.Row][id.Col])
 			entry.OnChanged = func(text string) {
 				exportData[id.Row][id.Col] = text
 				gui.updateExportsFromTable(exportData)
+				gui.recordTyping(cellLabel("export", id))
+				for row := range exportData {
+					gui.exportsTable.RefreshItem(widget.TableCellID{Row: row, Col: dependsColumn})
+				}
 			}
 		},
 	)
+	gui.exportsTable.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabel("Column")
+	}
+	gui.exportsTable.UpdateHeader = func(id widget.TableCellID, template fyne.CanvasObject) {
+		if id.Col >= 0 {
+			template.(*widget.Label).SetText(exportColumns[id.Col])
+		}
+	}
+	gui.exportsTable.ShowHeaderColumn = false
 	gui.exportsTable.SetColumnWidth(0, 200)
 	gui.exportsTable.SetColumnWidth(1, 400)
+	gui.exportsTable.SetColumnWidth(2, 250)
+	gui.exportsTable.SetColumnWidth(3, 250)
+	gui.exportsTable.SetColumnWidth(4, 250)
+	gui.exportsTable.SetColumnWidth(effectiveColumn, 400)
+	gui.exportsTable.SetColumnWidth(dependsColumn, 300)
+	gui.reveal[shellconfig.NodeExport] = func(name string) {
+		gui.selectTab("Environment")
+		if row := rowOf(exportData, guarded, name); row >= 0 {
+			selectRow(gui.exportsTable, row)
+		}
+	}
 
 	addButton := widget.NewButton("Add Variable", func() {
-		exportData = append(exportData, []string{"NEW_VAR", ""})
+		exportData = append(exportData, []string{"NEW_VAR", "", ""})
+		gui.updateExportsFromTable(exportData)
+		gui.record("Add export")
 		gui.exportsTable.Refresh()
 	})
 
+	addGuardedButton := widget.NewButton("Add Under Condition...", func() {
+		gui.showAddGuardedDialog(shellconfig.NodeExport, func() {
+			guarded = gui.guardedEntries(shellconfig.NodeExport)
+			gui.exportsTable.Refresh()
+		})
+	})
+
 	removeButton := widget.NewButton("Remove Selected", func() {
 		dialog.ShowInformation("Info", "Select a row to remove", gui.window)
 	})
 
+	runCommandsCheck := widget.NewCheck("Run command substitutions", func(on bool) {
+		gui.evaluator.RunCommands = on
+		gui.evaluator.Reset()
+		gui.evaluate()
+	})
+	runCommandsCheck.Checked = gui.evaluator.RunCommands
+	gui.evaluate()
+
 	return container.NewBorder(
 		widget.NewCard("Environment Variables", "", 
-			container.NewHBox(addButton, removeButton),
+			container.NewHBox(addButton, addGuardedButton, removeButton, runCommandsCheck),
 		),
 		nil,
 		nil,
@@ -121,50 +711,180 @@ func (gui *ShellConfigGUI) createEnvironmentTab() fyne.CanvasObject {
 	)
 }
 
+// pathRow is a row of the Path tab, either a directory or the marker for the
+// PATH inherited from the parent process.
+type pathRow struct {
+	dir       string
+	inherited bool
+}
+
 func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
-	currentPath := gui.config.Exports["PATH"]
-	if currentPath == "" {
-		currentPath = os.Getenv("PATH")
+	list := gui.config.Path()
+	pathData := []*pathRow{}
+	for _, dir := range list.Prepend {
+		pathData = append(pathData, &pathRow{dir: dir})
 	}
-	paths := strings.Split(currentPath, ":")
-	
-	filteredPaths := []string{}
-	for _, p := range paths {
-		if p != "" {
-			filteredPaths = append(filteredPaths, p)
+	if list.Inherited {
+		pathData = append(pathData, &pathRow{inherited: true})
+	}
+	for _, dir := range list.Append {
+		pathData = append(pathData, &pathRow{dir: dir})
+	}
+
+	// statuses holds the health badge of every row, the inherited PATH
+	// included so that entry numbers match the rows.
+	var statuses []shellconfig.PathStatus
+	checkPath := func() {
+		dirs := []string{}
+		for _, row := range pathData {
+			if row.inherited {
+				dirs = append(dirs, "$PATH")
+			} else {
+				dirs = append(dirs, row.dir)
+			}
 		}
+		statuses = gui.config.CheckPath(dirs)
 	}
-	paths = filteredPaths
+	checkPath()
 
-	pathData := make([][]string, len(paths))
-	for i, p := range paths {
-		pathData[i] = []string{p}
+	// applyPath writes the edited list back to the PATH assignments as one
+	// undoable edit.
+	applyPath := func(label string, typing bool) {
+		newPath := shellconfig.PathList{Unique: list.Unique}
+		for _, row := range pathData {
+			switch {
+			case row.inherited:
+				newPath.Inherited = true
+			case row.dir == "":
+			case newPath.Inherited:
+				newPath.Append = append(newPath.Append, row.dir)
+			default:
+				newPath.Prepend = append(newPath.Prepend, row.dir)
+			}
+		}
+		gui.config.SetPath(newPath)
+		if typing {
+			gui.recordTyping(label)
+		} else {
+			gui.record(label)
+		}
+		checkPath()
+		if gui.exportsTable != nil {
+			gui.exportsTable.Refresh()
+		}
+	}
+
+	// addPath puts a new directory in front of the inherited PATH, where
+	// user directories usually go.
+	addPath := func(dir string) {
+		i := len(pathData)
+		for j, row := range pathData {
+			if row.inherited {
+				i = j
+			}
+		}
+		pathData = append(pathData[:i], append([]*pathRow{{dir: dir}}, pathData[i:]...)...)
+		applyPath("Add PATH entry", false)
 	}
 
 	var pathTable *widget.Table
+
+	// fixPath applies the one-click fix for the first problem of a row.
+	fixPath := func(row int) {
+		if row >= len(statuses) || statuses[row].OK() {
+			return
+		}
+		status := statuses[row]
+		if status.Problems[0] == shellconfig.PathWorldWritable {
+			// This changes the directory on disk, which undo cannot revert.
+			mode, fixed, err := shellconfig.WorldWriteFix(status.Resolved)
+			if err != nil {
+				dialog.ShowError(err, gui.window)
+				return
+			}
+			message := fmt.Sprintf("Change the permissions of %s from %s to %s?\n\nThis changes the directory on disk and cannot be undone from here.",
+				status.Resolved, mode.Perm(), fixed.Perm())
+			dialog.ShowConfirm("Remove Write for Others", message, func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := shellconfig.RemoveWorldWrite(status.Resolved); err != nil {
+					dialog.ShowError(err, gui.window)
+					return
+				}
+				checkPath()
+				pathTable.Refresh()
+			}, gui.window)
+			return
+		}
+		pathData = append(pathData[:row], pathData[row+1:]...)
+		applyPath("Remove PATH entry", false)
+		pathTable.Refresh()
+	}
+
+	// showStatus sets a row's badge and fix button from its health.
+	showStatus := func(row int, badge *widget.Label, fixBtn *widget.Button) {
+		if row >= len(statuses) || statuses[row].OK() {
+			badge.SetText("ok")
+			badge.Importance = widget.SuccessImportance
+			badge.Refresh()
+			fixBtn.Hide()
+			return
+		}
+		status := statuses[row]
+		badge.SetText(status.Summary())
+		badge.Importance = widget.WarningImportance
+		if status.Problems[0] != shellconfig.PathDuplicate {
+			badge.Importance = widget.DangerImportance
+		}
+		badge.Refresh()
+		fixBtn.SetText(status.Problems[0].Fix())
+		fixBtn.OnTapped = func() { fixPath(row) }
+		fixBtn.Show()
+	}
+
 	pathTable = widget.NewTable(
 		func() (int, int) { return len(pathData), 1 },
 		func() fyne.CanvasObject {
 			orderLabel := widget.NewLabel("1.")
 			orderLabel.TextStyle = fyne.TextStyle{Bold: true}
 			entry := widget.NewEntry()
+			badge := widget.NewLabel("ok")
+			fixBtn := widget.NewButton("Fix", func() {})
 			btn := widget.NewButton("X", func() {})
 			btn.Resize(fyne.NewSize(40, 30))
-			return container.NewBorder(nil, nil, orderLabel, btn, entry)
+			return container.NewBorder(nil, nil, orderLabel, container.NewHBox(badge, fixBtn, btn), entry)
 		},
 		func(id widget.TableCellID, cell fyne.CanvasObject) {
 			box := cell.(*fyne.Container)
 			entry := box.Objects[0].(*widget.Entry)
 			orderLabel := box.Objects[1].(*widget.Label)
-			btn := box.Objects[2].(*widget.Button)
+			controls := box.Objects[2].(*fyne.Container)
+			badge := controls.Objects[0].(*widget.Label)
+			fixBtn := controls.Objects[1].(*widget.Button)
+			btn := controls.Objects[2].(*widget.Button)
 			
 			if id.Row < len(pathData) {
 				orderLabel.SetText(fmt.Sprintf("%d.", id.Row+1))
 				
-				entry.SetText(pathData[id.Row][0])
+				entry.OnChanged = nil
+				if pathData[id.Row].inherited {
+					entry.SetText("(inherited PATH)")
+					entry.Disable()
+					badge.SetText("")
+					fixBtn.Hide()
+					btn.Hide()
+					return
+				}
+				entry.Enable()
+				btn.Show()
+				entry.SetText(pathData[id.Row].dir)
+				showStatus(id.Row, badge, fixBtn)
 				entry.OnChanged = func(text string) {
 					if id.Row < len(pathData) {
-						pathData[id.Row][0] = text
+						pathData[id.Row].dir = text
+						applyPath(fmt.Sprintf("Edit PATH entry %d", id.Row+1), true)
+						showStatus(id.Row, badge, fixBtn)
 					}
 				}
 				
@@ -172,6 +892,7 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 				btn.OnTapped = func() {
 					if row < len(pathData) {
 						pathData = append(pathData[:row], pathData[row+1:]...)
+						applyPath("Remove PATH entry", false)
 						pathTable.Refresh()
 					}
 				}
@@ -183,7 +904,7 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 	addWithBrowserBtn := widget.NewButton("Add Directory...", func() {
 		folderDialog := dialog.NewFolderOpen(func(dir fyne.ListableURI, err error) {
 			if err == nil && dir != nil {
-				pathData = append(pathData, []string{dir.Path()})
+				addPath(dir.Path())
 				pathTable.Refresh()
 			}
 		}, gui.window)
@@ -208,7 +929,7 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 	
 	addCustomBtn := widget.NewButton("Add", func() {
 		if customPathEntry.Text != "" {
-			pathData = append(pathData, []string{customPathEntry.Text})
+			addPath(customPathEntry.Text)
 			pathTable.Refresh()
 			customPathEntry.SetText("")
 		}
@@ -227,8 +948,7 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 	quickAddSelect := widget.NewSelect([]string{}, func(selected string) {
 		for _, cp := range commonPaths {
 			if cp.name == selected {
-				expandedPath := os.ExpandEnv(cp.path)
-				pathData = append(pathData, []string{expandedPath})
+				addPath(cp.path)
 				pathTable.Refresh()
 				break
 			}
@@ -252,6 +972,7 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 		if selectedRow > 0 && selectedRow < len(pathData) {
 			pathData[selectedRow-1], pathData[selectedRow] = pathData[selectedRow], pathData[selectedRow-1]
 			selectedRow--
+			applyPath("Move PATH entry", false)
 			pathTable.Refresh()
 			pathTable.Select(widget.TableCellID{Row: selectedRow, Col: 0})
 		}
@@ -261,31 +982,20 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 		if selectedRow >= 0 && selectedRow < len(pathData)-1 {
 			pathData[selectedRow], pathData[selectedRow+1] = pathData[selectedRow+1], pathData[selectedRow]
 			selectedRow++
+			applyPath("Move PATH entry", false)
 			pathTable.Refresh()
 			pathTable.Select(widget.TableCellID{Row: selectedRow, Col: 0})
 		}
 	})
 
-	savePathBtn := widget.NewButton("Apply PATH Changes", func() {
-		newPaths := []string{}
-		for _, row := range pathData {
-			if row[0] != "" {
-				newPaths = append(newPaths, row[0])
-			}
-		}
-		gui.config.Exports["PATH"] = strings.Join(newPaths, ":")
-		if gui.exportsTable != nil {
-			gui.exportsTable.Refresh()
-		}
-		dialog.ShowInformation("Success", "PATH updated. Save configuration to make permanent.", gui.window)
-	})
-	savePathBtn.Importance = widget.HighImportance
-
-	infoCard := widget.NewCard("About PATH", "", widget.NewLabel(
-		"The PATH variable tells the system where to find executable programs.\n"+
-		"Directories are searched in order from top to bottom.\n"+
-		"Changes will be applied to your shell configuration when saved.",
-	))
+	about := "The PATH variable tells the system where to find executable programs.\n" +
+		"Directories are searched in order from top to bottom.\n" +
+		"Entries above (inherited PATH) are prepended, entries below it appended.\n" +
+		"Changes will be applied to your shell configuration when saved."
+	if list.Unique {
+		about += "\ntypeset -U path drops later duplicates."
+	}
+	infoCard := widget.NewCard("About PATH", "", widget.NewLabel(about))
 
 	topControls := container.NewVBox(
 		widget.NewCard("Add Path Entry", "", container.NewVBox(
@@ -297,43 +1007,167 @@ func (gui *ShellConfigGUI) createPathTab() fyne.CanvasObject {
 		widget.NewCard("Reorder", "", container.NewHBox(moveUpBtn, moveDownBtn)),
 	)
 
+	split := container.NewVSplit(container.NewScroll(pathTable), gui.createCommandsView())
+	split.Offset = 0.6
+
 	return container.NewBorder(
 		container.NewHBox(topControls, infoCard),
-		container.NewPadded(savePathBtn),
 		nil,
 		nil,
-		container.NewScroll(pathTable),
+		nil,
+		split,
 	)
 }
 
+// createCommandsView answers which command a name would run and lists the
+// commands that more than one PATH directory provides.
+func (gui *ShellConfigGUI) createCommandsView() fyne.CanvasObject {
+	whichEntry := widget.NewEntry()
+	whichEntry.SetPlaceHolder("Command name, e.g. python3")
+	whichResult := widget.NewLabel("")
+	whichResult.Wrapping = fyne.TextWrapWord
+	lookup := func() {
+		name := strings.TrimSpace(whichEntry.Text)
+		if name == "" {
+			return
+		}
+		resolutions := gui.config.Which(name)
+		if len(resolutions) == 0 {
+			whichResult.SetText(fmt.Sprintf("%s is not an alias, function, builtin or command in PATH", name))
+			return
+		}
+		lines := []string{}
+		found := false
+		for i, resolution := range resolutions {
+			state := "shadowed"
+			switch {
+			case !found && resolution.Conditional():
+				state = "runs when its condition holds"
+			case !found:
+				state = "runs"
+				found = true
+			}
+			lines = append(lines, fmt.Sprintf("%d. %s (%s): %s", i+1, resolution.Kind, state, resolution))
+		}
+		whichResult.SetText(strings.Join(lines, "\n"))
+	}
+	whichEntry.OnSubmitted = func(string) { lookup() }
+	whichButton := widget.NewButton("Which Would Run?", lookup)
+
+	shadowed := []shellconfig.Shadowed{}
+	shadowedList := widget.NewList(
+		func() int { return len(shadowed) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			s := shadowed[id]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s: %s shadows %s", s.Name, s.Paths[0], strings.Join(s.Paths[1:], ", ")))
+		},
+	)
+	shadowedList.OnSelected = func(id widget.ListItemID) {
+		whichEntry.SetText(shadowed[id].Name)
+		lookup()
+	}
+	scanStatus := widget.NewLabel("Scan PATH to list commands found in more than one directory.")
+	var scanButton *widget.Button
+	scanButton = widget.NewButton("Scan PATH", func() {
+		dirs := gui.config.SearchPath()
+		scanButton.Disable()
+		scanStatus.SetText(fmt.Sprintf("Scanning %d directories...", len(dirs)))
+		go func() {
+			result := shellconfig.ShadowedCommands(dirs)
+			fyne.Do(func() {
+				shadowed = result
+				shadowedList.UnselectAll()
+				shadowedList.Refresh()
+				scanStatus.SetText(fmt.Sprintf("%d commands are found in more than one of %d directories", len(result), len(dirs)))
+				scanButton.Enable()
+			})
+		}()
+	})
+
+	whichCard := widget.NewCard("Which Would Run?", "Aliases and functions come before builtins and PATH", container.NewVBox(
+		container.NewBorder(nil, nil, nil, whichButton, whichEntry),
+		whichResult,
+	))
+	shadowedCard := widget.NewCard("Shadowed Commands", "The first copy in PATH wins", container.NewBorder(
+		container.NewBorder(nil, nil, nil, scanButton, scanStatus),
+		nil, nil, nil,
+		shadowedList,
+	))
+	return container.NewHSplit(whichCard, shadowedCard)
+}
+
 func (gui *ShellConfigGUI) createAliasesTab() fyne.CanvasObject {
 	aliasData := [][]string{}
-	for name, command := range gui.config.Aliases {
-		aliasData = append(aliasData, []string{name, command})
+	for _, name := range gui.config.AliasNames() {
+		aliasData = append(aliasData, []string{name, gui.config.Aliases[name], gui.config.Description(shellconfig.NodeAlias, name)})
 	}
+	guarded := gui.guardedEntries(shellconfig.NodeAlias)
 
-	gui.aliasesTable = widget.NewTable(
-		func() (int, int) { return len(aliasData), 2 },
+	gui.aliasesTable = widget.NewTableWithHeaders(
+		func() (int, int) { return len(aliasData) + len(guarded), len(entryColumns) },
 		func() fyne.CanvasObject {
 			return widget.NewEntry()
 		},
 		func(id widget.TableCellID, cell fyne.CanvasObject) {
 			entry := cell.(*widget.Entry)
+			entry.OnChanged = nil
+			if id.Row >= len(aliasData) {
+				gui.updateGuardedCell(entry, guarded[id.Row-len(aliasData)], id.Col)
+				return
+			}
+			if id.Col >= 3 {
+				entry.SetText("")
+				if id.Col == 4 {
+					entry.SetText(gui.originText(shellconfig.NodeAlias, aliasData[id.Row][0]))
+				}
+				entry.Disable()
+				return
+			}
+			entry.Enable()
 			entry.SetText(aliasData[id.Row][id.Col])
 			entry.OnChanged = func(text string) {
 				aliasData[id.Row][id.Col] = text
 				gui.updateAliasesFromTable(aliasData)
+				gui.recordTyping(cellLabel("alias", id))
 			}
 		},
 	)
+	gui.aliasesTable.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabel("Column")
+	}
+	gui.aliasesTable.UpdateHeader = func(id widget.TableCellID, template fyne.CanvasObject) {
+		if id.Col >= 0 {
+			template.(*widget.Label).SetText(entryColumns[id.Col])
+		}
+	}
+	gui.aliasesTable.ShowHeaderColumn = false
 	gui.aliasesTable.SetColumnWidth(0, 150)
 	gui.aliasesTable.SetColumnWidth(1, 450)
+	gui.aliasesTable.SetColumnWidth(2, 250)
+	gui.aliasesTable.SetColumnWidth(3, 250)
+	gui.aliasesTable.SetColumnWidth(4, 250)
+	gui.reveal[shellconfig.NodeAlias] = func(name string) {
+		gui.selectTab("Aliases")
+		if row := rowOf(aliasData, guarded, name); row >= 0 {
+			selectRow(gui.aliasesTable, row)
+		}
+	}
 
 	addButton := widget.NewButton("Add Alias", func() {
-		aliasData = append(aliasData, []string{"newalias", "command"})
+		aliasData = append(aliasData, []string{"newalias", "command", ""})
+		gui.updateAliasesFromTable(aliasData)
+		gui.record("Add alias")
 		gui.aliasesTable.Refresh()
 	})
 
+	addGuardedButton := widget.NewButton("Add Under Condition...", func() {
+		gui.showAddGuardedDialog(shellconfig.NodeAlias, func() {
+			guarded = gui.guardedEntries(shellconfig.NodeAlias)
+			gui.aliasesTable.Refresh()
+		})
+	})
+
 	commonAliases := []struct{ name, cmd string }{
 		{"ll", "ls -alF"},
 		{"la", "ls -A"},
@@ -349,9 +1183,10 @@ func (gui *ShellConfigGUI) createAliasesTab() fyne.CanvasObject {
 	quickAdd := widget.NewSelect([]string{}, func(selected string) {
 		for _, alias := range commonAliases {
 			if fmt.Sprintf("%s: %s", alias.name, alias.cmd) == selected {
-				aliasData = append(aliasData, []string{alias.name, alias.cmd})
+				aliasData = append(aliasData, []string{alias.name, alias.cmd, ""})
 				gui.aliasesTable.Refresh()
 				gui.updateAliasesFromTable(aliasData)
+				gui.record("Add alias " + alias.name)
 				break
 			}
 		}
@@ -367,7 +1202,7 @@ func (gui *ShellConfigGUI) createAliasesTab() fyne.CanvasObject {
 	return container.NewBorder(
 		widget.NewCard("Shell Aliases", "",
 			container.NewVBox(
-				container.NewHBox(addButton, quickAdd),
+				container.NewHBox(addButton, addGuardedButton, quickAdd),
 			),
 		),
 		nil,
@@ -381,6 +1216,7 @@ func (gui *ShellConfigGUI) createOhMyZshTab() fyne.CanvasObject {
 	themes, _ := gui.config.GetAvailableThemes()
 	gui.themeSelect = widget.NewSelect(themes, func(selected string) {
 		gui.config.OhMyZshTheme = selected
+		gui.record("Set theme")
 	})
 	gui.themeSelect.SetSelected(gui.config.OhMyZshTheme)
 
@@ -401,10 +1237,12 @@ func (gui *ShellConfigGUI) createOhMyZshTab() fyne.CanvasObject {
 			label := box.Objects[1].(*widget.Label)
 			
 			label.SetText(pluginName)
+			check.OnChanged = nil
 			check.SetChecked(gui.pluginChecks[pluginName])
 			check.OnChanged = func(checked bool) {
 				gui.pluginChecks[pluginName] = checked
 				gui.updatePluginsFromChecks()
+				gui.record("Toggle plugin " + pluginName)
 			}
 		},
 	)
@@ -416,16 +1254,19 @@ func (gui *ShellConfigGUI) createOhMyZshTab() fyne.CanvasObject {
 		widget.NewButton("Enable git", func() {
 			gui.pluginChecks["git"] = true
 			gui.updatePluginsFromChecks()
+			gui.record("Toggle plugin git")
 			gui.pluginsList.Refresh()
 		}),
 		widget.NewButton("Enable docker", func() {
 			gui.pluginChecks["docker"] = true
 			gui.updatePluginsFromChecks()
+			gui.record("Toggle plugin docker")
 			gui.pluginsList.Refresh()
 		}),
 		widget.NewButton("Enable kubectl", func() {
 			gui.pluginChecks["kubectl"] = true
 			gui.updatePluginsFromChecks()
+			gui.record("Toggle plugin kubectl")
 			gui.pluginsList.Refresh()
 		}),
 	))
@@ -452,6 +1293,8 @@ func (gui *ShellConfigGUI) createOhMyZshTab() fyne.CanvasObject {
 }
 
 func (gui *ShellConfigGUI) createFunctionsTab() fyne.CanvasObject {
+	selected := ""
+
 	functionsList := widget.NewList(
 		func() int { return len(gui.config.CustomFunctions) },
 		func() fyne.CanvasObject {
@@ -460,9 +1303,10 @@ func (gui *ShellConfigGUI) createFunctionsTab() fyne.CanvasObject {
 		func(id widget.ListItemID, item fyne.CanvasObject) {
 			label := item.(*widget.Label)
 			funcText := gui.config.CustomFunctions[id]
-			lines := strings.Split(funcText, "\n")
-			if len(lines) > 0 {
-				label.SetText(lines[0])
+			name := shellconfig.FunctionName(funcText)
+			label.SetText(name)
+			if origin := gui.originText(shellconfig.NodeFunction, name); origin != "" {
+				label.SetText(label.Text + "  —  " + origin)
 			}
 		},
 	)
@@ -471,35 +1315,130 @@ func (gui *ShellConfigGUI) createFunctionsTab() fyne.CanvasObject {
 	functionEditor.SetPlaceHolder("Select a function to edit...")
 	functionEditor.Resize(fyne.NewSize(600, 400))
 
+	statusLabel := widget.NewLabel("")
+
+	// selectFunction highlights the named function in the list and loads it
+	// into the editor.
+	selectFunction := func(name string) {
+		functionsList.Refresh()
+		for i, text := range gui.config.CustomFunctions {
+			if shellconfig.FunctionName(text) == name {
+				functionsList.Select(i)
+				return
+			}
+		}
+		selected = ""
+		functionsList.UnselectAll()
+		functionEditor.SetText("")
+	}
+
+	gui.reveal[shellconfig.NodeFunction] = func(name string) {
+		gui.selectTab("Functions")
+		selectFunction(name)
+	}
+
 	functionsList.OnSelected = func(id widget.ListItemID) {
 		if id < len(gui.config.CustomFunctions) {
+			selected = shellconfig.FunctionName(gui.config.CustomFunctions[id])
 			functionEditor.SetText(gui.config.CustomFunctions[id])
+			statusLabel.SetText("")
 		}
 	}
 
 	addButton := widget.NewButton("Add Function", func() {
-		newFunc := "newfunction() {\n    # Add your code here\n    echo \"Hello from new function\"\n}"
-		gui.config.CustomFunctions = append(gui.config.CustomFunctions, newFunc)
-		functionsList.Refresh()
+		name := "newfunction"
+		for i := 2; ; i++ {
+			if _, exists := gui.config.Function(name); !exists {
+				break
+			}
+			name = fmt.Sprintf("newfunction%d", i)
+		}
+		newFunc := gui.config.Dialect.FormatFunction(name, []string{
+			"# Add your code here",
+			"echo \"Hello from new function\"",
+		})
+		if err := gui.config.SetFunction("", newFunc); err != nil {
+			dialog.ShowError(err, gui.window)
+			return
+		}
+		gui.record("Add function " + name)
+		selectFunction(name)
 	})
 
 	saveButton := widget.NewButton("Save Changes", func() {
-		// TODO: Update the selected function with editor content
+		if err := gui.config.SetFunction(selected, functionEditor.Text); err != nil {
+			statusLabel.SetText("")
+			dialog.ShowError(fmt.Errorf("function not saved: %w", err), gui.window)
+			return
+		}
+		gui.record("Edit function " + shellconfig.FunctionName(functionEditor.Text))
+		selectFunction(shellconfig.FunctionName(functionEditor.Text))
+		statusLabel.SetText("Function updated. Save configuration to make permanent.")
+	})
+	saveButton.Importance = widget.HighImportance
+
+	checkButton := widget.NewButton("Check Syntax", func() {
+		if err := gui.config.CheckFunction(functionEditor.Text); err != nil {
+			statusLabel.SetText("Syntax error: " + err.Error())
+			return
+		}
+		statusLabel.SetText("Syntax OK")
+	})
+
+	renameButton := widget.NewButton("Rename", func() {
+		if selected == "" {
+			dialog.ShowInformation("Info", "Select a function to rename", gui.window)
+			return
+		}
+		nameEntry := widget.NewEntry()
+		nameEntry.SetText(selected)
+		dialog.ShowForm("Rename Function", "Rename", "Cancel",
+			[]*widget.FormItem{widget.NewFormItem("New name", nameEntry)},
+			func(ok bool) {
+				if !ok || nameEntry.Text == selected {
+					return
+				}
+				if err := gui.config.RenameFunction(selected, nameEntry.Text); err != nil {
+					dialog.ShowError(err, gui.window)
+					return
+				}
+				gui.record("Rename function " + selected)
+				selectFunction(nameEntry.Text)
+			}, gui.window)
+	})
+
+	deleteButton := widget.NewButton("Delete", func() {
+		if selected == "" {
+			dialog.ShowInformation("Info", "Select a function to delete", gui.window)
+			return
+		}
+		name := selected
+		dialog.ShowConfirm("Delete Function", fmt.Sprintf("Delete function %s?", name), func(confirmed bool) {
+			if confirmed {
+				gui.config.RemoveFunction(name)
+				gui.record("Delete function " + name)
+				selectFunction("")
+			}
+		}, gui.window)
 	})
 
 	templateSelect := widget.NewSelect(
 		[]string{"Directory Navigation", "Git Helper", "Docker Shortcut"},
-		func(selected string) {
+		func(choice string) {
 			var template string
-			switch selected {
+			switch choice {
 			case "Directory Navigation":
-				template = "mkcd() {\n    mkdir -p \"$1\" && cd \"$1\"\n}"
+				template = gui.config.Dialect.FormatFunction("mkcd", []string{"mkdir -p \"$1\" && cd \"$1\""})
 			case "Git Helper":
-				template = "gcommit() {\n    git add . && git commit -m \"$1\"\n}"
+				template = gui.config.Dialect.FormatFunction("gcommit", []string{"git add . && git commit -m \"$1\""})
 			case "Docker Shortcut":
-				template = "dexec() {\n    docker exec -it \"$1\" /bin/bash\n}"
+				template = gui.config.Dialect.FormatFunction("dexec", []string{"docker exec -it \"$1\" /bin/bash"})
 			}
+			// Templates start a new function, added on Save Changes.
+			selected = ""
+			functionsList.UnselectAll()
 			functionEditor.SetText(template)
+			statusLabel.SetText("")
 		},
 	)
 	templateSelect.PlaceHolder = "Function templates..."
@@ -517,7 +1456,10 @@ func (gui *ShellConfigGUI) createFunctionsTab() fyne.CanvasObject {
 
 	rightPanel := container.NewBorder(
 		nil,
-		saveButton,
+		container.NewVBox(
+			statusLabel,
+			container.NewHBox(saveButton, checkButton, renameButton, deleteButton),
+		),
 		nil,
 		nil,
 		container.NewScroll(functionEditor),
@@ -526,6 +1468,312 @@ func (gui *ShellConfigGUI) createFunctionsTab() fyne.CanvasObject {
 	return container.NewHSplit(leftPanel, rightPanel)
 }
 
+// createFilesTab shows the tree of files reached by following source and .
+// commands from the file being edited.
+func (gui *ShellConfigGUI) createFilesTab() fyne.CanvasObject {
+	root := gui.config.Sources()
+	sources := make(map[string]*shellconfig.Source)
+	for _, src := range root.Files() {
+		sources[src.Path] = src
+	}
+
+	tree := widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID {
+			if id == "" {
+				return []widget.TreeNodeID{root.Path}
+			}
+			children := []widget.TreeNodeID{}
+			for _, child := range sources[id].Children {
+				children = append(children, child.Path)
+			}
+			return children
+		},
+		func(id widget.TreeNodeID) bool {
+			return id == "" || len(sources[id].Children) > 0
+		},
+		func(branch bool) fyne.CanvasObject {
+			return widget.NewLabel("File")
+		},
+		func(id widget.TreeNodeID, branch bool, item fyne.CanvasObject) {
+			src := sources[id]
+			text := shellconfig.ShortPath(src.Path)
+			if src.Parent != nil {
+				text += fmt.Sprintf("  (sourced at line %d)", src.Line)
+			}
+			if src.Guard != nil {
+				text += "  —  " + src.Guard.String()
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+	tree.OpenAllBranches()
+
+	return container.NewBorder(
+		widget.NewCard("Included Files", "Files loaded through source and . commands", nil),
+		nil,
+		nil,
+		nil,
+		tree,
+	)
+}
+
+// createManagedBlockTab lists the entries defined outside the managed block
+// or drop-in files and moves them in.
+func (gui *ShellConfigGUI) createManagedBlockTab() fyne.CanvasObject {
+	target := "managed block"
+	title, subtitle := "Outside the Managed Block",
+		fmt.Sprintf("Entries below are left alone until moved between the %s markers", shellconfig.ManagedStart)
+	if gui.config.Mode == shellconfig.WriteDropIn {
+		homeDir, _ := os.UserHomeDir()
+		target = "drop-in files"
+		title, subtitle = "Outside the Drop-in Files",
+			fmt.Sprintf("Entries below stay in %s until moved to %s",
+				shellconfig.ShortPath(gui.config.FilePath),
+				shellconfig.ShortPath(shellconfig.DropInDir(gui.config.Dialect, homeDir)))
+	}
+
+	type outsideEntry struct {
+		kind shellconfig.NodeKind
+		name string
+	}
+	entries := []outsideEntry{}
+	unmanaged := gui.config.Unmanaged()
+	for _, kind := range []shellconfig.NodeKind{shellconfig.NodeExport, shellconfig.NodeVariable, shellconfig.NodeAlias, shellconfig.NodeFunction} {
+		for _, name := range unmanaged[kind] {
+			entries = append(entries, outsideEntry{kind, name})
+		}
+	}
+
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Entry")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(fmt.Sprintf("%s %s", entries[id].kind, entries[id].name))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+	}
+
+	migrate := func(moved []outsideEntry) {
+		for _, entry := range moved {
+			if err := gui.config.Migrate(entry.kind, entry.name); err != nil {
+				dialog.ShowError(err, gui.window)
+				break
+			}
+		}
+		label := "Move entries into " + target
+		if len(moved) == 1 {
+			label = fmt.Sprintf("Move %s %s into %s", moved[0].kind, moved[0].name, target)
+		}
+		gui.record(label)
+		gui.refreshTabs()
+	}
+
+	moveButton := widget.NewButton("Move In", func() {
+		if selected < 0 || selected >= len(entries) {
+			dialog.ShowInformation("Info", "Select an entry to move", gui.window)
+			return
+		}
+		migrate(entries[selected : selected+1])
+	})
+	moveButton.Importance = widget.HighImportance
+	moveAllButton := widget.NewButton("Move All", func() {
+		migrate(entries)
+	})
+
+	return container.NewBorder(
+		widget.NewCard(title, subtitle, nil),
+		container.NewHBox(moveButton, moveAllButton),
+		nil,
+		nil,
+		list,
+	)
+}
+
+// createBackupsTab lists the snapshots taken of each file before saves,
+// shows how a snapshot differs from the file now and restores it.
+func (gui *ShellConfigGUI) createBackupsTab() fyne.CanvasObject {
+	store := gui.config.Backups
+	paths := []string{}
+	for _, src := range gui.config.Sources().Files() {
+		paths = append(paths, src.Path)
+	}
+
+	var snapshots []backup.Snapshot
+	var selected *backup.Snapshot
+	// selectedBase is the file as it was compared with the selected snapshot.
+	var selectedBase string
+	diffPanel := container.NewStack(widget.NewLabel("Select a snapshot to compare it with the current file"))
+
+	snapshotList := widget.NewList(
+		func() int { return len(snapshots) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Snapshot")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(snapshots[id].Time.Local().Format(time.DateTime))
+		},
+	)
+
+	fileSelect := widget.NewSelect(paths, nil)
+	loadSnapshots := func() {
+		var err error
+		snapshots, err = store.List(fileSelect.Selected)
+		if err != nil {
+			dialog.ShowError(err, gui.window)
+		}
+		selected = nil
+		snapshotList.UnselectAll()
+		snapshotList.Refresh()
+		diffPanel.Objects = []fyne.CanvasObject{widget.NewLabel(fmt.Sprintf("%d snapshots", len(snapshots)))}
+		diffPanel.Refresh()
+	}
+	fileSelect.OnChanged = func(string) { loadSnapshots() }
+
+	snapshotList.OnSelected = func(id widget.ListItemID) {
+		snap := snapshots[id]
+		selected = &snap
+		old, err := snap.Content()
+		if err != nil {
+			dialog.ShowError(err, gui.window)
+			return
+		}
+		current, _ := os.ReadFile(snap.Path)
+		selectedBase = string(current)
+		diffPanel.Objects = []fyne.CanvasObject{container.NewScroll(diffView(diff.Compute(old, string(current))))}
+		diffPanel.Refresh()
+	}
+
+	restoreButton := widget.NewButton("Restore", func() {
+		if selected == nil {
+			dialog.ShowInformation("Info", "Select a snapshot to restore", gui.window)
+			return
+		}
+		snap, base := *selected, selectedBase
+		message := fmt.Sprintf("Replace %s with the snapshot from %s?\nThe current file is snapshotted first and unsaved edits are discarded.",
+			shellconfig.ShortPath(snap.Path), snap.Time.Local().Format(time.DateTime))
+		dialog.ShowConfirm("Restore Snapshot", message, func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := gui.config.RestoreSnapshot(snap, base); err != nil {
+				dialog.ShowError(err, gui.window)
+				return
+			}
+			gui.openFile(gui.config.FilePath)
+		}, gui.window)
+	})
+	restoreButton.Importance = widget.HighImportance
+
+	countEntry := widget.NewEntry()
+	countEntry.SetText(strconv.Itoa(store.Policy.MaxCount))
+	daysEntry := widget.NewEntry()
+	daysEntry.SetText(strconv.Itoa(int(store.Policy.MaxAge / (24 * time.Hour))))
+	applyButton := widget.NewButton("Apply Retention", func() {
+		count, err1 := strconv.Atoi(strings.TrimSpace(countEntry.Text))
+		days, err2 := strconv.Atoi(strings.TrimSpace(daysEntry.Text))
+		if err1 != nil || err2 != nil || count < 0 || days < 0 {
+			dialog.ShowInformation("Info", "Enter whole numbers; 0 keeps snapshots without limit", gui.window)
+			return
+		}
+		store.Policy = backup.Policy{MaxCount: count, MaxAge: time.Duration(days) * 24 * time.Hour}
+		saveBackupPolicy(store.Policy)
+		for _, path := range paths {
+			if err := store.Prune(path); err != nil {
+				dialog.ShowError(err, gui.window)
+				return
+			}
+		}
+		loadSnapshots()
+	})
+
+	fileSelect.SetSelectedIndex(0)
+
+	retention := container.NewHBox(
+		widget.NewLabel("Keep last"), countEntry,
+		widget.NewLabel("snapshots for"), daysEntry,
+		widget.NewLabel("days"), applyButton,
+	)
+
+	return container.NewBorder(
+		widget.NewCard("Backups", shellconfig.ShortPath(store.Dir),
+			container.NewVBox(fileSelect, retention),
+		),
+		nil,
+		nil,
+		nil,
+		container.NewHSplit(
+			container.NewBorder(nil, restoreButton, nil, nil, snapshotList),
+			diffPanel,
+		),
+	)
+}
+
+// Preference keys for the snapshot retention policy.
+const (
+	backupCountPreference = "backups.maxCount"
+	backupDaysPreference  = "backups.maxDays"
+)
+
+// writeModePreference stores the write mode chosen for new sessions.
+const writeModePreference = "shellconfig.writeMode"
+
+// writeModeNames are the write modes as offered to the user, indexed by
+// mode.
+var writeModeNames = []string{"Whole file", "Managed block", "Drop-in files"}
+
+func writeModeFromName(name string) shellconfig.WriteMode {
+	for i, n := range writeModeNames {
+		if n == name {
+			return shellconfig.WriteMode(i)
+		}
+	}
+	return shellconfig.WriteInPlace
+}
+
+func loadWriteMode() shellconfig.WriteMode {
+	app := fyne.CurrentApp()
+	if app == nil {
+		return shellconfig.WriteInPlace
+	}
+	mode := app.Preferences().IntWithFallback(writeModePreference, int(shellconfig.WriteInPlace))
+	if mode < 0 || mode >= len(writeModeNames) {
+		return shellconfig.WriteInPlace
+	}
+	return shellconfig.WriteMode(mode)
+}
+
+func saveWriteMode(mode shellconfig.WriteMode) {
+	if app := fyne.CurrentApp(); app != nil {
+		app.Preferences().SetInt(writeModePreference, int(mode))
+	}
+}
+
+// loadBackupPolicy reads the retention policy saved in the app preferences.
+func loadBackupPolicy() backup.Policy {
+	app := fyne.CurrentApp()
+	if app == nil {
+		return backup.DefaultPolicy
+	}
+	prefs := app.Preferences()
+	days := prefs.IntWithFallback(backupDaysPreference, int(backup.DefaultPolicy.MaxAge/(24*time.Hour)))
+	return backup.Policy{
+		MaxCount: prefs.IntWithFallback(backupCountPreference, backup.DefaultPolicy.MaxCount),
+		MaxAge:   time.Duration(days) * 24 * time.Hour,
+	}
+}
+
+func saveBackupPolicy(policy backup.Policy) {
+	if app := fyne.CurrentApp(); app != nil {
+		app.Preferences().SetInt(backupCountPreference, policy.MaxCount)
+		app.Preferences().SetInt(backupDaysPreference, int(policy.MaxAge/(24*time.Hour)))
+	}
+}
+
 func (gui *ShellConfigGUI) createHistoryTab() fyne.CanvasObject {
 	historyData := []string{}
 	currentFilter := ""
@@ -667,8 +1915,18 @@ func (gui *ShellConfigGUI) createHistoryTab() fyne.CanvasObject {
 func (gui *ShellConfigGUI) updateAliasesFromTable(data [][]string) {
 	gui.config.Aliases = make(map[string]string)
 	for _, row := range data {
-		if len(row) == 2 && row[0] != "" {
+		if len(row) == 3 && row[0] != "" {
 			gui.config.Aliases[row[0]] = row[1]
+			gui.config.SetDescription(shellconfig.NodeAlias, row[0], row[2])
+		}
+	}
+}
+
+func (gui *ShellConfigGUI) updateVariablesFromTable(data [][]string) {
+	gui.config.Variables = make(map[string]string)
+	for _, row := range data {
+		if row[0] != "" {
+			gui.config.Variables[row[0]] = row[1]
 		}
 	}
 }
@@ -676,45 +1934,364 @@ func (gui *ShellConfigGUI) updateAliasesFromTable(data [][]string) {
 func (gui *ShellConfigGUI) updateExportsFromTable(data [][]string) {
 	gui.config.Exports = make(map[string]string)
 	for _, row := range data {
-		if len(row) == 2 && row[0] != "" {
+		if len(row) == 3 && row[0] != "" {
 			gui.config.Exports[row[0]] = row[1]
+			gui.config.SetDescription(shellconfig.NodeExport, row[0], row[2])
 		}
 	}
 }
 
 func (gui *ShellConfigGUI) updatePluginsFromChecks() {
-	gui.config.OhMyZshPlugins = []string{}
+	// Keep the existing plugin order so toggling one plugin doesn't reorder
+	// the whole plugins=(...) line.
+	plugins := []string{}
+	seen := make(map[string]bool)
+	for _, plugin := range gui.config.OhMyZshPlugins {
+		if gui.pluginChecks[plugin] && !seen[plugin] {
+			plugins = append(plugins, plugin)
+		}
+		seen[plugin] = true
+	}
+	added := []string{}
 	for plugin, checked := range gui.pluginChecks {
-		if checked {
-			gui.config.OhMyZshPlugins = append(gui.config.OhMyZshPlugins, plugin)
+		if checked && !seen[plugin] {
+			added = append(added, plugin)
 		}
 	}
+	sort.Strings(added)
+	gui.config.OhMyZshPlugins = append(plugins, added...)
 }
 
-func (gui *ShellConfigGUI) saveConfiguration() {
-	if err := gui.config.Save(); err != nil {
-		dialog.ShowError(err, gui.window)
+// saveConfiguration shows the pending changes to each file and writes the
+// hunks the user accepts. onSaved, if set, is called after a successful save
+// in place of the confirmation message.
+func (gui *ShellConfigGUI) saveConfiguration(onSaved func()) {
+	changes := gui.config.Changes()
+	if len(changes) == 0 {
+		if onSaved != nil {
+			onSaved()
+			return
+		}
+		dialog.ShowInformation("Info", "No changes to save", gui.window)
 		return
 	}
-	dialog.ShowInformation("Success", "Configuration saved successfully!", gui.window)
+
+	files := []FileDiff{}
+	for _, change := range changes {
+		file := FileDiff{Name: change.Path, Diff: change.Diff, Accepted: change.Accepted}
+		if change.Remove {
+			file.Note = "will be removed"
+		} else if _, err := os.Stat(change.Path); os.IsNotExist(err) {
+			file.Note = "new file"
+		}
+		files = append(files, file)
+	}
+
+	ShowDiffReview("Review Changes", files, func() {
+		if err := gui.config.SaveChanges(changes); err != nil {
+			gui.showSaveError(err)
+			return
+		}
+		gui.markModified()
+		if onSaved != nil {
+			onSaved()
+			return
+		}
+		dialog.ShowInformation("Success", "Configuration saved successfully!", gui.window)
+	}, gui.window)
 }
 
-func (gui *ShellConfigGUI) refreshAll() {
-	gui.pluginChecks = make(map[string]bool)
-	for _, plugin := range gui.config.OhMyZshPlugins {
-		gui.pluginChecks[plugin] = true
+// previewEnvironment starts the shell over the saved and the edited config
+// in the background and shows how its environment would change.
+func (gui *ShellConfigGUI) previewEnvironment() {
+	preview := gui.config.Preview()
+	progress := dialog.NewCustomWithoutButtons("Preview Environment",
+		container.NewVBox(widget.NewLabel("Starting the shell with each config..."), widget.NewProgressBarInfinite()),
+		gui.window)
+	progress.Show()
+	go func() {
+		changes, err := preview.Run()
+		fyne.Do(func() {
+			progress.Hide()
+			if err != nil {
+				dialog.ShowError(err, gui.window)
+				return
+			}
+			gui.showEnvironmentChanges(changes)
+		})
+	}()
+}
+
+// showEnvironmentChanges lists how saving would change the shell's
+// environment, with the old and new value of the selected change.
+func (gui *ShellConfigGUI) showEnvironmentChanges(changes []shellconfig.EnvChange) {
+	if len(changes) == 0 {
+		dialog.ShowInformation("Preview Environment", "Saving would not change the shell's environment", gui.window)
+		return
 	}
-	
-	if gui.aliasesTable != nil {
-		gui.aliasesTable.Refresh()
+
+	before := widget.NewLabel("")
+	before.Wrapping = fyne.TextWrapWord
+	after := widget.NewLabel("")
+	after.Wrapping = fyne.TextWrapWord
+	list := widget.NewList(
+		func() int { return len(changes) },
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Change")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(changes[id].Summary)
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		before.SetText(changes[id].Before)
+		after.SetText(changes[id].After)
 	}
-	if gui.exportsTable != nil {
-		gui.exportsTable.Refresh()
+
+	details := container.NewGridWithColumns(2,
+		widget.NewCard("Before", "", container.NewVScroll(before)),
+		widget.NewCard("After", "", container.NewVScroll(after)),
+	)
+	content := container.NewVSplit(list, details)
+	content.SetOffset(0.6)
+	d := dialog.NewCustom("Preview Environment", "Close", content, gui.window)
+	d.Resize(fyne.NewSize(800, 550))
+	d.Show()
+}
+
+// showSaveError reports a failed save. When the shell rejected the result,
+// the entry it blamed is selected in its tab.
+func (gui *ShellConfigGUI) showSaveError(err error) {
+	var syntaxErr *shellconfig.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Name != "" {
+		if reveal, ok := gui.reveal[syntaxErr.Kind]; ok {
+			reveal(syntaxErr.Name)
+		}
+	}
+	dialog.ShowError(err, gui.window)
+}
+
+// guardedEntries returns the conditional entries of a kind.
+func (gui *ShellConfigGUI) guardedEntries(kind shellconfig.NodeKind) []*shellconfig.GuardedEntry {
+	entries := []*shellconfig.GuardedEntry{}
+	for _, entry := range gui.config.Guarded {
+		if entry.Kind == kind {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// cellLabel names an edit to a table cell for the undo history, so typing
+// into one cell is undone in one step.
+func cellLabel(kind string, id widget.TableCellID) string {
+	return fmt.Sprintf("Edit %s row %d column %d", kind, id.Row+1, id.Col+1)
+}
+
+// entryColumns are the columns of the Environment and Aliases tables.
+var entryColumns = []string{"Name", "Value", "Description", "Condition", "Defined In"}
+
+// exportColumns adds the value each export evaluates to and the variables
+// it refers to for the Environment table.
+var exportColumns = append(entryColumns[:len(entryColumns):len(entryColumns)], "Effective Value", "Depends On")
+
+const (
+	effectiveColumn = 5
+	dependsColumn   = 6
+)
+
+// showEffectiveValue shows what an export, or a conditional export when
+// guarded is set, evaluates to, highlighting values that are empty or refer
+// to variables that are not set.
+func (gui *ShellConfigGUI) showEffectiveValue(label *widget.Label, name string, guarded *shellconfig.GuardedEntry) {
+	if gui.effective == nil {
+		label.Importance = widget.LowImportance
+		label.SetText("Evaluating...")
+		return
+	}
+	result, ok := gui.effective.Values[name]
+	if guarded != nil {
+		result, ok = gui.effective.Guarded[guarded]
+	}
+	if !ok {
+		label.Importance = widget.MediumImportance
+		label.SetText("")
+		return
+	}
+	text := result.Value
+	label.Importance = widget.MediumImportance
+	switch {
+	case len(result.Undefined) > 0:
+		text = fmt.Sprintf("%s (undefined: %s)", text, strings.Join(result.Undefined, ", "))
+		label.Importance = widget.DangerImportance
+	case result.Value == "":
+		text = "(empty)"
+		label.Importance = widget.WarningImportance
+	case result.Unevaluated:
+		text += " (commands not run)"
+		label.Importance = widget.LowImportance
+	}
+	if result.Conditional {
+		text += " (conditional)"
+	}
+	label.SetText(text)
+}
+
+// evaluate expands the exports in the background, since command
+// substitutions can take seconds, and fills the Effective Value column once
+// done. While one evaluation runs, edits only ask for another after it, and
+// its now stale result is not shown.
+func (gui *ShellConfigGUI) evaluate() {
+	if gui.evaluator == nil {
+		return
+	}
+	if gui.evaluating {
+		gui.evaluateAgain = true
+		return
+	}
+	gui.evaluating = true
+	assignments := gui.evaluator.Assignments(gui.config)
+	go func() {
+		results := assignments.Run()
+		fyne.Do(func() {
+			gui.evaluating = false
+			if gui.closed {
+				return
+			}
+			if gui.evaluateAgain {
+				gui.evaluateAgain = false
+				gui.evaluate()
+				return
+			}
+			gui.effective = results
+			if gui.exportsTable != nil {
+				rows, _ := gui.exportsTable.Length()
+				for row := 0; row < rows; row++ {
+					gui.exportsTable.RefreshItem(widget.TableCellID{Row: row, Col: effectiveColumn})
+				}
+			}
+		})
+	}()
+}
+
+// showDependencies lists the variables an export refers to, and flags
+// references that break because of the order of assignments or a cycle.
+func (gui *ShellConfigGUI) showDependencies(label *widget.Label, name string) {
+	if gui.graph == nil {
+		gui.graph = gui.config.VariableGraph()
+	}
+	text := strings.Join(gui.graph.Deps[name], ", ")
+	label.Importance = widget.MediumImportance
+	for _, problem := range gui.graph.Problems {
+		if name != "" && problem.Involves(name) {
+			text = strings.TrimPrefix(text+"; "+problem.String(), "; ")
+			label.Importance = widget.DangerImportance
+		}
 	}
-	if gui.themeSelect != nil {
-		gui.themeSelect.SetSelected(gui.config.OhMyZshTheme)
+	label.SetText(text)
+}
+
+// updateGuardedCell fills a table cell for a conditional entry. Name, value
+// and description are editable; the condition and origin columns are not.
+func (gui *ShellConfigGUI) updateGuardedCell(entry *widget.Entry, guarded *shellconfig.GuardedEntry, col int) {
+	label := fmt.Sprintf("Edit conditional %s %s column %d", guarded.Kind, guarded.Name, col+1)
+	switch col {
+	case 0:
+		entry.Enable()
+		entry.SetText(guarded.Name)
+		entry.OnChanged = func(text string) {
+			guarded.Name = text
+			gui.recordTyping(label)
+		}
+	case 1:
+		entry.Enable()
+		entry.SetText(guarded.Value)
+		entry.OnChanged = func(text string) {
+			guarded.Value = text
+			gui.recordTyping(label)
+		}
+	case 2:
+		entry.Enable()
+		entry.SetText(guarded.Description)
+		entry.OnChanged = func(text string) {
+			guarded.Description = text
+			gui.recordTyping(label)
+		}
+	case 3:
+		entry.SetText(guarded.Guard.String())
+		entry.Disable()
+	case 4:
+		entry.SetText(gui.config.GuardedOrigin(guarded).String())
+		entry.Disable()
 	}
-	if gui.pluginsList != nil {
-		gui.pluginsList.Refresh()
+}
+
+// showAddGuardedDialog asks for a name, value and condition, offering the
+// conditions already present in the loaded files or a new one.
+func (gui *ShellConfigGUI) showAddGuardedDialog(kind shellconfig.NodeKind, onAdded func()) {
+	const newCondition = "New condition..."
+	guards := gui.config.Guards()
+	choices := []string{}
+	for _, guard := range guards {
+		choices = append(choices, guard.String())
 	}
-}
\ No newline at end of file
+	choices = append(choices, newCondition)
+
+	nameEntry := widget.NewEntry()
+	valueEntry := widget.NewEntry()
+	conditionEntry := widget.NewEntry()
+	conditionEntry.SetPlaceHolder("[[ -d ~/go ]]")
+	conditionEntry.Disable()
+	guardSelect := widget.NewSelect(choices, func(selected string) {
+		if selected == newCondition {
+			conditionEntry.Enable()
+		} else {
+			conditionEntry.Disable()
+		}
+	})
+	guardSelect.SetSelectedIndex(0)
+
+	dialog.ShowForm("Add Under Condition", "Add", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Name", nameEntry),
+			widget.NewFormItem("Value", valueEntry),
+			widget.NewFormItem("Condition", guardSelect),
+			widget.NewFormItem("New condition", conditionEntry),
+		},
+		func(ok bool) {
+			name := strings.TrimSpace(nameEntry.Text)
+			if !ok || name == "" {
+				return
+			}
+			var guard *shellconfig.Guard
+			if index := guardSelect.SelectedIndex(); index >= 0 && index < len(guards) {
+				guard = guards[index]
+			} else if condition := strings.TrimSpace(conditionEntry.Text); condition != "" {
+				guard = shellconfig.NewGuard(condition)
+			} else {
+				dialog.ShowInformation("Info", "Enter a condition for the new entry", gui.window)
+				return
+			}
+			gui.config.AddGuarded(kind, name, valueEntry.Text, guard)
+			gui.record(fmt.Sprintf("Add conditional %s %s", kind, name))
+			onAdded()
+		}, gui.window)
+}
+
+// originText describes where an entry is defined, for display next to it.
+func (gui *ShellConfigGUI) originText(kind shellconfig.NodeKind, name string) string {
+	origin, ok := gui.config.Origin(kind, name)
+	if !ok {
+		return ""
+	}
+	return origin.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
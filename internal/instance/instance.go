@@ -0,0 +1,117 @@
+// Package instance keeps a single running copy of the app per user. A later
+// launch hands its arguments to the running one over a Unix socket.
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/btassone/swiss-linux-knife/internal/filelock"
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// SocketPath returns the socket the running instance listens on, in the
+// private runtime directory of the current user.
+func SocketPath() (string, error) {
+	dir, err := filelock.RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "instance.sock"), nil
+}
+
+// Forward sends args to the running instance. It reports false when there is
+// none, in which case the caller should start up and Listen. Arguments are
+// only sent to a socket the current user owns.
+func Forward(args []string) (bool, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	if err := filelock.CheckOwner(path); err != nil {
+		return false, fmt.Errorf("refusing to forward arguments: %w", err)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := json.NewEncoder(conn).Encode(args); err != nil {
+		return false, fmt.Errorf("failed to forward arguments: %w", err)
+	}
+	logger.Info("Forwarded %v to the running instance", args)
+	return true, nil
+}
+
+// ErrRunning is returned by Listen when another instance already holds the
+// socket, such as one started at the same time. Its arguments should be
+// forwarded to that instance instead.
+var ErrRunning = errors.New("another instance is already running")
+
+// Listener receives the arguments of later launches.
+type Listener struct {
+	listener net.Listener
+}
+
+// Listen claims the socket and calls handle, from a background goroutine,
+// with the arguments of each later launch. A socket left behind by an
+// instance that exited without cleaning up is replaced. Launches claim the
+// socket one at a time, so only a stale socket is ever removed.
+func Listen(handle func(args []string)) (*Listener, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+	lock, err := filelock.Exclusive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	listener, err := net.Listen("unix", path)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		if conn, dialErr := net.DialTimeout("unix", path, time.Second); dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: %w", path, ErrRunning)
+		}
+		os.Remove(path)
+		listener, err = net.Listen("unix", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			var args []string
+			conn.SetDeadline(time.Now().Add(time.Second))
+			if err := json.NewDecoder(conn).Decode(&args); err != nil {
+				logger.Warn("Ignoring malformed message from another launch: %v", err)
+			} else {
+				handle(args)
+			}
+			conn.Close()
+		}
+	}()
+	return &Listener{listener: listener}, nil
+}
+
+// Close stops listening and removes the socket.
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
@@ -0,0 +1,72 @@
+package instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestForwardToRunningInstance(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	if forwarded, err := Forward([]string{"x"}); forwarded || err != nil {
+		t.Fatalf("Expected nothing to forward to, got %v, %v", forwarded, err)
+	}
+
+	received := make(chan []string, 1)
+	listener, err := Listen(func(args []string) { received <- args })
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	if _, err := Listen(func([]string) {}); !errors.Is(err, ErrRunning) {
+		t.Error("Expected a second listener to be refused with ErrRunning")
+	}
+
+	if forwarded, err := Forward([]string{"/home/me/.zshrc"}); !forwarded || err != nil {
+		t.Fatalf("Expected arguments to be forwarded, got %v, %v", forwarded, err)
+	}
+	select {
+	case args := <-received:
+		if len(args) != 1 || args[0] != "/home/me/.zshrc" {
+			t.Errorf("Unexpected arguments: %v", args)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the running instance to receive the arguments")
+	}
+}
+
+func TestStaleSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	path, err := SocketPath()
+	if err != nil {
+		t.Fatalf("Failed to find the socket: %v", err)
+	}
+	os.WriteFile(path, nil, 0600)
+
+	listener, err := Listen(func([]string) {})
+	if err != nil {
+		t.Fatalf("Expected a stale socket to be replaced, got %v", err)
+	}
+	listener.Close()
+}
+
+func TestSocketWithoutRuntimeDir(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("XDG_CACHE_HOME", cache)
+
+	path, err := SocketPath()
+	if err != nil {
+		t.Fatalf("Failed to find the socket: %v", err)
+	}
+	if filepath.Dir(path) != filepath.Join(cache, "swiss-linux-knife") {
+		t.Errorf("Expected the socket in the user's cache directory, got %s", path)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected a private socket directory, got %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package safefile replaces files atomically without disturbing the
+// symlinks, permissions and ownership they were set up with.
+package safefile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+	"golang.org/x/sys/unix"
+)
+
+// Write replaces path with data through a temp file renamed over it. If
+// validate is not nil and rejects the temp file, path is left as it was.
+//
+// A symlinked path is written through to its target, so dotfiles managed by
+// stow or chezmoi stay links. The new file gets the mode, owner and extended
+// attributes, including ACLs, of the one it replaces, and is synced to disk
+// along with its directory before Write returns.
+func Write(path string, data []byte, validate func(tempFile string) error) error {
+	staged, err := Stage(path, data)
+	if err != nil {
+		return err
+	}
+	if validate != nil {
+		if err := validate(staged.Temp); err != nil {
+			staged.Discard()
+			return err
+		}
+	}
+	return staged.Commit()
+}
+
+// Staged is new content for Path waiting in Temp until it is committed.
+type Staged struct {
+	Path string
+	Temp string
+
+	target string
+}
+
+// Stage writes data to a temp file next to the file path resolves to, with
+// the metadata Write gives it, without replacing anything yet. The caller
+// must Commit or Discard the result.
+func Stage(path string, data []byte) (*Staged, error) {
+	target := path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		target = resolved
+	}
+	info, statErr := os.Stat(target)
+
+	// The temp file must be in the target's directory for the rename to be
+	// atomic.
+	file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp*")
+	if err != nil {
+		logger.Error("Failed to create temp file: %v", err)
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	staged := &Staged{Path: path, Temp: file.Name(), target: target}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		staged.Discard()
+		logger.Error("Failed to write temp file: %v", err)
+		return nil, fmt.Errorf("failed to write to temp file: %w", err)
+	}
+	if statErr == nil {
+		copyMetadata(target, file, info)
+	} else if err := file.Chmod(0644); err != nil {
+		logger.Warn("Failed to set mode of %s: %v", staged.Temp, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		staged.Discard()
+		return nil, fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		staged.Discard()
+		return nil, fmt.Errorf("failed to close temp file: %w", err)
+	}
+	return staged, nil
+}
+
+// Commit renames the temp file over the target and syncs its directory.
+func (s *Staged) Commit() error {
+	if err := os.Rename(s.Temp, s.target); err != nil {
+		logger.Error("Failed to rename temp file: %v", err)
+		s.Discard()
+		return fmt.Errorf("failed to replace %s: %w", s.Path, err)
+	}
+	if err := syncDir(filepath.Dir(s.target)); err != nil {
+		logger.Warn("Failed to sync directory of %s: %v", s.target, err)
+	}
+
+	logger.Debug("Wrote %s", s.target)
+	return nil
+}
+
+// Discard removes the temp file, leaving the target as it was.
+func (s *Staged) Discard() {
+	os.Remove(s.Temp)
+}
+
+// copyMetadata gives file the mode, owner and extended attributes of the
+// file at path. Failures are logged rather than returned, since an
+// unprivileged user cannot always set them.
+func copyMetadata(path string, file *os.File, info os.FileInfo) {
+	if err := file.Chmod(info.Mode()); err != nil {
+		logger.Warn("Failed to copy mode of %s: %v", path, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := file.Chown(int(stat.Uid), int(stat.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+			logger.Warn("Failed to copy owner of %s: %v", path, err)
+		}
+	}
+
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return
+	}
+	names := make([]byte, size)
+	size, err = unix.Listxattr(path, names)
+	if err != nil {
+		return
+	}
+	for _, name := range splitNull(names[:size]) {
+		valueSize, err := unix.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, valueSize)
+		if valueSize, err = unix.Getxattr(path, name, value); err != nil {
+			continue
+		}
+		if err := unix.Fsetxattr(int(file.Fd()), name, value[:valueSize], 0); err != nil {
+			logger.Warn("Failed to copy attribute %s of %s: %v", name, path, err)
+		}
+	}
+}
+
+// splitNull splits the NUL-terminated names returned by listxattr.
+func splitNull(buf []byte) []string {
+	names := []string{}
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
+
+// syncDir flushes a directory entry change, such as a rename, to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,75 @@
+package safefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "zshrc")
+	link := filepath.Join(dir, ".zshrc")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	if err := os.WriteFile(target, []byte("old\n"), 0600); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := Write(link, []byte("new\n"), nil); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be kept")
+	}
+	content, _ := os.ReadFile(target)
+	if string(content) != "new\n" {
+		t.Errorf("Expected the target to be written, got %q", content)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("Expected no temp files left behind, got %d entries", len(entries))
+	}
+}
+
+func TestWriteRejected(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".bashrc")
+	os.WriteFile(path, []byte("old\n"), 0644)
+
+	rejected := errors.New("rejected")
+	var checked string
+	err := Write(path, []byte("new\n"), func(tempFile string) error {
+		content, _ := os.ReadFile(tempFile)
+		checked = string(content)
+		return rejected
+	})
+	if !errors.Is(err, rejected) {
+		t.Errorf("Expected the validation error, got %v", err)
+	}
+	if checked != "new\n" {
+		t.Errorf("Expected validate to see the new content, got %q", checked)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "old\n" {
+		t.Errorf("Expected the file to be left alone, got %q", content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected the temp file to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestWriteNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.fish")
+	if err := Write(path, []byte("set -gx EDITOR nvim\n"), nil); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected a new file with mode 0644, got %v (%v)", info, err)
+	}
+}
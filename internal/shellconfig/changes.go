@@ -0,0 +1,241 @@
+package shellconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btassone/swiss-linux-knife/internal/backup"
+	"github.com/btassone/swiss-linux-knife/internal/diff"
+	"github.com/btassone/swiss-linux-knife/internal/filelock"
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// FileChange is a write Save would make to one file, diffed against the
+// file on disk. Accepted selects the hunks to write and starts with every
+// hunk selected.
+type FileChange struct {
+	Path     string
+	Diff     *diff.Diff
+	Accepted []bool
+	// Remove is set when the file is deleted, such as the file of a removed
+	// fish function.
+	Remove bool
+
+	src      *Source
+	function string
+	base     string
+}
+
+// ErrChangedOnDisk is returned by SaveChanges when a file no longer holds
+// the content its change was diffed against.
+var ErrChangedOnDisk = errors.New("file changed on disk since the changes were prepared")
+
+// Content returns what will be written: the file on disk with the accepted
+// hunks applied.
+func (f *FileChange) Content() string {
+	return f.Diff.Apply(f.Accepted)
+}
+
+// Unified returns the change as a unified diff.
+func (f *FileChange) Unified() string {
+	return f.Diff.Unified(f.Path, f.Path)
+}
+
+// newChange diffs content against the file at path. It returns nil when the
+// file already holds content.
+func newChange(path, content string) *FileChange {
+	old, err := os.ReadFile(path)
+	if err == nil && string(old) == content {
+		return nil
+	}
+	d := diff.Compute(string(old), content)
+	return &FileChange{Path: path, Diff: d, Accepted: d.All(), base: string(old)}
+}
+
+// Changes returns the writes Save would make. The root file is included when
+// it differs from disk or does not exist yet, sourced files when their
+// entries were edited.
+func (c *Config) Changes() []*FileChange {
+	c.resolveDialect()
+
+	changes := []*FileChange{}
+	root := c.Sources()
+	for _, src := range root.Files() {
+		if src != root && !src.Modified() {
+			continue
+		}
+		if change := newChange(src.Path, src.savedText()); change != nil {
+			change.src = src
+			changes = append(changes, change)
+		}
+	}
+	return append(changes, c.functionChanges()...)
+}
+
+// functionChanges returns the writes to function files for dialects that
+// keep functions in their own files.
+func (c *Config) functionChanges() []*FileChange {
+	fd, ok := c.Dialect.(functionDir)
+	if !ok {
+		return nil
+	}
+	dir := fd.FunctionDir(c.FilePath)
+	_, files := c.splitFunctions()
+
+	changes := []*FileChange{}
+	for _, name := range sortedNames(files) {
+		if c.functionFiles[name] == files[name] {
+			continue
+		}
+		path := filepath.Join(dir, name+filepath.Ext(c.FilePath))
+		if change := newChange(path, files[name]+"\n"); change != nil {
+			change.function = name
+			changes = append(changes, change)
+		}
+	}
+	for _, name := range sortedNames(c.functionFiles) {
+		if _, ok := files[name]; !ok {
+			path := filepath.Join(dir, name+filepath.Ext(c.FilePath))
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if change := newChange(path, ""); change != nil {
+				change.function = name
+				change.Remove = true
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// SaveChanges writes the accepted hunks of each change. Rejected hunks are
+// not written and stay pending for the next save.
+//
+// Every file is locked against other instances for the duration, and the
+// save is refused if one was changed on disk after its diff was computed.
+// The files are written as one transaction: all of them pass the syntax
+// check before any is replaced, and if replacing one fails, the others are
+// rolled back to their content before the save.
+func (c *Config) SaveChanges(changes []*FileChange) error {
+	logger.Debug("Saving shell config to %s", c.FilePath)
+
+	locks, err := lockUnchanged(changes)
+	for _, lock := range locks {
+		defer lock.Release()
+	}
+	if err != nil {
+		return err
+	}
+
+	tx := &transaction{}
+	defer tx.discard()
+	for _, change := range changes {
+		if err := tx.stage(c, change); err != nil {
+			return err
+		}
+	}
+	if err := tx.commit(c); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		content := change.Content()
+		switch {
+		case change.Remove && content == "":
+			delete(c.functionFiles, change.function)
+		case change.function != "":
+			c.functionFiles[change.function] = strings.TrimSuffix(content, "\n")
+		case change.src != nil:
+			change.src.original = content
+			c.orderSaved(change.src)
+		}
+	}
+
+	logger.Info("Successfully saved config to %s", c.FilePath)
+	return nil
+}
+
+// lockUnchanged locks the files of changes against other instances, in
+// path order, and checks that each still holds the content its change was
+// diffed against. The locks taken are returned even on error, for the
+// caller to release.
+func lockUnchanged(changes []*FileChange) ([]*filelock.Lock, error) {
+	paths := []string{}
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	sort.Strings(paths)
+	locks := []*filelock.Lock{}
+	for _, path := range paths {
+		lock, err := filelock.Exclusive(path)
+		if err != nil {
+			return locks, err
+		}
+		locks = append(locks, lock)
+	}
+	for _, change := range changes {
+		current, err := os.ReadFile(change.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return locks, fmt.Errorf("failed to read %s: %w", change.Path, err)
+		}
+		if string(current) != change.base {
+			return locks, fmt.Errorf("%s: %w", change.Path, ErrChangedOnDisk)
+		}
+	}
+	return locks, nil
+}
+
+// RestoreSnapshot replaces the file of snap with the snapshot. Like
+// SaveChanges it locks the file and refuses with ErrChangedOnDisk when the
+// file no longer holds base, the content it was compared against.
+func (c *Config) RestoreSnapshot(snap backup.Snapshot, base string) error {
+	if c.Backups == nil {
+		return fmt.Errorf("failed to restore %s: no backup store", snap.Path)
+	}
+	locks, err := lockUnchanged([]*FileChange{{Path: snap.Path, base: base}})
+	for _, lock := range locks {
+		defer lock.Release()
+	}
+	if err != nil {
+		return err
+	}
+	return c.Backups.Restore(snap)
+}
+
+// orderSaved moves the assignments of src into the order they were saved in,
+// once the whole file was written, so the config matches the file again.
+func (c *Config) orderSaved(src *Source) {
+	if src.Text() == src.original || src.savedText() != src.original {
+		return
+	}
+	unchanged := c.history.current.equal(c.state())
+	src.Doc.orderAssignments()
+	if unchanged {
+		c.history.current = c.state()
+	}
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// snapshot keeps a copy of path in the backup store before it is replaced.
+func (c *Config) snapshot(path string) error {
+	if c.Backups == nil {
+		return nil
+	}
+	if _, err := c.Backups.Take(path); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return nil
+}
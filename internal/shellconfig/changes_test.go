@@ -0,0 +1,107 @@
+package shellconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveAcceptedHunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	original := "export EDITOR=vim\n\n# Aliases\nalias ll='ls -la'\nalias la='ls -A'\nalias l='ls -CF'\n\n# Path setup\nexport PATH=\"$HOME/bin:$PATH\"\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	config.Exports["EDITOR"] = "nvim"
+	config.Exports["PATH"] = "$HOME/.local/bin:$PATH"
+
+	changes := config.Changes()
+	if len(changes) != 1 || len(changes[0].Diff.Hunks) != 2 {
+		t.Fatalf("Expected one file with two hunks, got %d changes", len(changes))
+	}
+	if diff := changes[0].Unified(); !strings.Contains(diff, "-export EDITOR=vim\n+export EDITOR=nvim\n") {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+
+	changes[0].Accepted[1] = false
+	if err := config.SaveChanges(changes); err != nil {
+		t.Fatalf("Failed to save changes: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	want := strings.Replace(original, "EDITOR=vim", "EDITOR=nvim", 1)
+	if string(content) != want {
+		t.Errorf("Expected only the accepted hunk written, got:\n%s", content)
+	}
+
+	// The rejected hunk is still pending.
+	changes = config.Changes()
+	if len(changes) != 1 || len(changes[0].Diff.Hunks) != 1 || !strings.Contains(changes[0].Unified(), "+export PATH=") {
+		t.Errorf("Expected the PATH change to stay pending, got %d changes", len(changes))
+	}
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if changes := config.Changes(); len(changes) != 0 {
+		t.Errorf("Expected nothing pending after saving, got:\n%s", changes[0].Unified())
+	}
+
+	snapshots, err := config.Backups.List(path)
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("Expected a snapshot per save, got %d (%v)", len(snapshots), err)
+	}
+	if content, _ := snapshots[1].Content(); content != original {
+		t.Errorf("Expected the oldest snapshot to hold the original file, got:\n%s", content)
+	}
+}
+
+func TestSaveRefusesStaleChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	os.WriteFile(path, []byte("export EDITOR=vim\n"), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	config.Exports["EDITOR"] = "nvim"
+	changes := config.Changes()
+	os.WriteFile(path, []byte("export EDITOR=emacs\n"), 0644)
+
+	if err := config.SaveChanges(changes); !errors.Is(err, ErrChangedOnDisk) {
+		t.Errorf("Expected ErrChangedOnDisk, got %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "export EDITOR=emacs\n" {
+		t.Errorf("Expected the other write to survive, got %q", content)
+	}
+}
+
+func TestRestoreSnapshotRefusesStaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	os.WriteFile(path, []byte("export EDITOR=vim\n"), 0644)
+	config := NewForFile(path)
+	snap, err := config.Backups.Take(path)
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	os.WriteFile(path, []byte("export EDITOR=nvim\n"), 0644)
+
+	if err := config.RestoreSnapshot(*snap, "export EDITOR=emacs\n"); !errors.Is(err, ErrChangedOnDisk) {
+		t.Errorf("Expected ErrChangedOnDisk, got %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "export EDITOR=nvim\n" {
+		t.Errorf("Expected the file to be left alone, got %q", content)
+	}
+
+	if err := config.RestoreSnapshot(*snap, "export EDITOR=nvim\n"); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "export EDITOR=vim\n" {
+		t.Errorf("Expected restored content, got %q", content)
+	}
+}
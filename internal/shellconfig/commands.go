@@ -0,0 +1,249 @@
+package shellconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// builtinScripts print the builtins of each shell, one per line.
+var builtinScripts = map[string]string{
+	"zsh":  `print -rl -- ${(k)builtins}`,
+	"bash": `compgen -b`,
+	"fish": `builtin -n`,
+}
+
+var (
+	builtinsMu    sync.Mutex
+	builtinsCache = make(map[string]map[string]bool)
+)
+
+// shellBuiltins asks shell for its builtins once. It returns none when the
+// shell is not installed.
+func shellBuiltins(shell string) map[string]bool {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+	if builtins, ok := builtinsCache[shell]; ok {
+		return builtins
+	}
+
+	builtins := make(map[string]bool)
+	builtinsCache[shell] = builtins
+	path, err := exec.LookPath(shell)
+	if err != nil || builtinScripts[shell] == "" {
+		return builtins
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "-c", builtinScripts[shell]).Output()
+	if err != nil {
+		logger.Warn("Failed to list %s builtins: %v", shell, err)
+		return builtins
+	}
+	for _, name := range strings.Fields(string(output)) {
+		builtins[name] = true
+	}
+	return builtins
+}
+
+// CommandKind is what a command name can run.
+type CommandKind int
+
+const (
+	CommandAlias CommandKind = iota
+	CommandFunction
+	CommandBuiltin
+	CommandFile
+)
+
+func (k CommandKind) String() string {
+	switch k {
+	case CommandAlias:
+		return "alias"
+	case CommandFunction:
+		return "function"
+	case CommandBuiltin:
+		return "builtin"
+	case CommandFile:
+		return "file"
+	}
+	return "unknown"
+}
+
+// Resolution is one thing a command name can run.
+type Resolution struct {
+	Kind CommandKind
+	// Target is the value of an alias or the path of an executable.
+	Target string
+	// Origin is where the config defines an alias or function.
+	Origin Origin
+	// Guard is the condition an alias or function is defined under, or nil
+	// when it is always defined.
+	Guard *Guard
+}
+
+// Conditional reports whether the resolution only exists when its guard
+// holds.
+func (r Resolution) Conditional() bool {
+	return r.Guard != nil
+}
+
+func (r Resolution) String() string {
+	var text string
+	switch r.Kind {
+	case CommandAlias:
+		text = fmt.Sprintf("alias for %q (%s)", r.Target, r.Origin)
+	case CommandFunction:
+		text = fmt.Sprintf("function (%s)", r.Origin)
+	case CommandBuiltin:
+		return "shell builtin"
+	default:
+		return r.Target
+	}
+	if r.Conditional() {
+		text += ", under " + r.Guard.String()
+	}
+	return text
+}
+
+// Which returns everything name could run, in the order the shell looks for
+// it: aliases and functions of the config, builtins, then executables in
+// SearchPath. Aliases and functions defined under a condition are listed
+// after those always defined. The first one that is not conditional runs
+// and those after it are shadowed.
+func (c *Config) Which(name string) []Resolution {
+	resolutions := []Resolution{}
+	if value, ok := c.Aliases[name]; ok {
+		origin, _ := c.Origin(NodeAlias, name)
+		resolutions = append(resolutions, Resolution{Kind: CommandAlias, Target: value, Origin: origin})
+	}
+	for _, entry := range c.Guarded {
+		if entry.Kind == NodeAlias && entry.Name == name {
+			resolutions = append(resolutions, Resolution{Kind: CommandAlias, Target: entry.Value, Origin: c.GuardedOrigin(entry), Guard: entry.Guard})
+		}
+	}
+	if origin, ok := c.Origin(NodeFunction, name); ok {
+		resolutions = append(resolutions, Resolution{Kind: CommandFunction, Origin: origin})
+	}
+	for _, ref := range c.find(NodeFunction) {
+		if guard := ref.guard(); guard != nil && ref.node.Name == name {
+			origin := Origin{Path: ref.src.Path, Line: ref.src.LineOf(ref.node)}
+			resolutions = append(resolutions, Resolution{Kind: CommandFunction, Origin: origin, Guard: guard})
+		}
+	}
+	if shellBuiltins(c.Dialect.Name())[name] {
+		resolutions = append(resolutions, Resolution{Kind: CommandBuiltin})
+	}
+	if strings.Contains(name, "/") {
+		return resolutions
+	}
+	for _, dir := range c.SearchPath() {
+		path := filepath.Join(dir, name)
+		if isExecutable(path) {
+			resolutions = append(resolutions, Resolution{Kind: CommandFile, Target: path})
+		}
+	}
+	return resolutions
+}
+
+// SearchPath returns the directories the shell searches for commands once
+// it has run the edited config, around the PATH it inherits. Entries that
+// are missing, relative, unresolved or repeated are left out, and so are
+// conditional assignments to PATH.
+func (c *Config) SearchPath() []string {
+	list := c.Path()
+	dirs := list.Prepend
+	if list.Inherited {
+		dirs = append(dirs, c.inheritedPath()...)
+		dirs = append(dirs, list.Append...)
+	}
+
+	search := []string{}
+	for _, status := range c.CheckPath(dirs) {
+		if status.OK() || (len(status.Problems) == 1 && (status.Problems[0] == PathWorldWritable || status.Problems[0] == PathWorldWritableSticky)) {
+			search = append(search, filepath.Clean(status.Resolved))
+		}
+	}
+	return search
+}
+
+// inheritedPath returns the PATH a shell has before it reads the config.
+// This process was most likely started from a shell that already ran the
+// saved config, so the directories that config adds are taken out of the
+// PATH of this process again.
+func (c *Config) inheritedPath() []string {
+	homeDir, _ := os.UserHomeDir()
+	added := make(map[string]bool)
+	for _, src := range c.tree().Files() {
+		for _, node := range c.Dialect.Parse(src.original).Nodes {
+			if (node.Kind != NodeExport && node.Kind != NodeVariable) || node.Name != "PATH" || node.Guard != nil {
+				continue
+			}
+			for _, dir := range strings.Split(node.Value, ":") {
+				if resolved := c.expandPathDir(dir, homeDir); resolved != "" && !isPathRef(dir) {
+					added[filepath.Clean(resolved)] = true
+				}
+			}
+		}
+	}
+
+	dirs := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if !added[filepath.Clean(dir)] {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Shadowed is a command found in more than one PATH directory.
+type Shadowed struct {
+	Name string
+	// Paths are the copies in search order. The first one runs.
+	Paths []string
+}
+
+// ShadowedCommands scans dirs, such as those of SearchPath, and returns the
+// commands found in more than one of them, sorted by name. It does not touch
+// the config, so it can run while the config is edited.
+func ShadowedCommands(dirs []string) []Shadowed {
+	found := make(map[string][]string)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			logger.Warn("Failed to read PATH directory %s: %v", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if isExecutable(path) {
+				found[entry.Name()] = append(found[entry.Name()], path)
+			}
+		}
+	}
+
+	shadowed := []Shadowed{}
+	for name, paths := range found {
+		if len(paths) > 1 {
+			shadowed = append(shadowed, Shadowed{Name: name, Paths: paths})
+		}
+	}
+	sort.Slice(shadowed, func(i, j int) bool {
+		return shadowed[i].Name < shadowed[j].Name
+	})
+	return shadowed
+}
+
+// isExecutable reports whether path, after following symlinks, is a regular
+// file that someone may execute.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,105 @@
+package shellconfig
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestShadowedCommands(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFiles(t, home, map[string]string{
+		".bashrc":          "export PATH=\"$HOME/first:$PATH:$HOME/last\"\nalias tool='tool --verbose'\ntool() {\n  command tool \"$@\"\n}\n",
+		"first/tool":       "#!/bin/sh\n",
+		"system/tool":      "#!/bin/sh\n",
+		"system/other":     "#!/bin/sh\n",
+		"last/tool":        "#!/bin/sh\n",
+		"last/other":       "#!/bin/sh\n",
+		"last/README.md":   "not a command\n",
+		"system/README.md": "not a command\n",
+	})
+	for _, file := range []string{"first/tool", "system/tool", "system/other", "last/tool", "last/other"} {
+		os.Chmod(filepath.Join(home, file), 0755)
+	}
+	// Builtins are listed once, so ask bash while it can still be found.
+	_, err := exec.LookPath("bash")
+	hasBash := err == nil
+	shellBuiltins("bash")
+	t.Setenv("PATH", filepath.Join(home, "system")+":"+filepath.Join(home, "first"))
+
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	search := config.SearchPath()
+	expected := []string{filepath.Join(home, "first"), filepath.Join(home, "system"), filepath.Join(home, "last")}
+	if !slices.Equal(search, expected) {
+		t.Errorf("Expected search path %v, got %v", expected, search)
+	}
+
+	shadowed := ShadowedCommands(search)
+	if len(shadowed) != 2 || shadowed[0].Name != "other" || shadowed[1].Name != "tool" {
+		t.Fatalf("Expected other and tool to be shadowed, got %+v", shadowed)
+	}
+	if shadowed[1].Paths[0] != filepath.Join(home, "first", "tool") || len(shadowed[1].Paths) != 3 {
+		t.Errorf("Expected the copy in the first directory to win, got %v", shadowed[1].Paths)
+	}
+
+	kinds := []CommandKind{}
+	for _, resolution := range config.Which("tool") {
+		kinds = append(kinds, resolution.Kind)
+	}
+	if !slices.Equal(kinds, []CommandKind{CommandAlias, CommandFunction, CommandFile, CommandFile, CommandFile}) {
+		t.Errorf("Expected alias, function and three files, got %v", kinds)
+	}
+	if which := config.Which("tool"); which[0].Target != "tool --verbose" || which[0].Origin.Line != 2 {
+		t.Errorf("Expected the alias to win, got %+v", which[0])
+	}
+	if which := config.Which("missing"); len(which) != 0 {
+		t.Errorf("Expected nothing to run, got %+v", which)
+	}
+
+	if hasBash {
+		if which := config.Which("cd"); len(which) == 0 || which[0].Kind != CommandBuiltin {
+			t.Errorf("Expected cd to be a builtin, got %+v", which)
+		}
+	}
+
+	config.SetPath(PathList{Prepend: []string{}, Append: []string{"$HOME/last"}, Inherited: true})
+	expected = []string{filepath.Join(home, "system"), filepath.Join(home, "last")}
+	if search := config.SearchPath(); !slices.Equal(search, expected) {
+		t.Errorf("Expected the removed directory to leave the search path, got %v", search)
+	}
+}
+
+func TestWhichConditional(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	shellBuiltins("bash")
+	t.Setenv("PATH", "")
+	writeTestFiles(t, home, map[string]string{
+		".bashrc": "if [ -n \"$SSH_TTY\" ]; then\n    alias ls='ls -F'\n    ls() {\n        command ls \"$@\"\n    }\nfi\nalias ls='ls --color'\n",
+	})
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	which := config.Which("ls")
+	if len(which) != 3 {
+		t.Fatalf("Expected three definitions of ls, got %+v", which)
+	}
+	if which[0].Conditional() || which[0].Target != "ls --color" {
+		t.Errorf("Expected the unconditional alias first, got %+v", which[0])
+	}
+	if !which[1].Conditional() || which[1].Target != "ls -F" || which[1].Origin.Line != 2 {
+		t.Errorf("Expected the conditional alias second, got %+v", which[1])
+	}
+	if which[2].Kind != CommandFunction || !which[2].Conditional() || which[2].Origin.Line != 3 {
+		t.Errorf("Expected the conditional function last, got %+v", which[2])
+	}
+}
@@ -1,218 +1,289 @@
 package shellconfig
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/btassone/swiss-linux-knife/internal/backup"
+	"github.com/btassone/swiss-linux-knife/internal/filelock"
 	"github.com/btassone/swiss-linux-knife/internal/logger"
 )
 
 type Config struct {
 	FilePath        string
+	Dialect         Dialect
 	Aliases         map[string]string
 	Exports         map[string]string
+	Variables       map[string]string
+	Options         map[string]bool
 	OhMyZshTheme    string
 	OhMyZshPlugins  []string
 	CustomFunctions []string
 	RawSections     map[string][]string
+	Guarded         []*GuardedEntry
+	Descriptions    map[NodeKind]map[string]string
+	// Backups receives a snapshot of each file before Save replaces it.
+	Backups *backup.Store
+	// Mode selects which part of the root file is read and written. Set it
+	// before Load.
+	Mode WriteMode
+
+	doc           *Document
+	root          *Source
+	block         *managedBlock
+	functionFiles map[string]string
+	history       history
 }
 
+// New returns a config for the default startup file of the user's login
+// shell.
 func New() *Config {
 	homeDir, _ := os.UserHomeDir()
-	return &Config{
-		FilePath:        filepath.Join(homeDir, ".zshrc"),
+	dialect := DetectDialect()
+	return NewWithDialect(dialect, DefaultFile(dialect, homeDir))
+}
+
+// NewForFile returns a config for path, picking the dialect from the file
+// name and falling back to the login shell's dialect.
+func NewForFile(path string) *Config {
+	dialect := DialectForFile(path)
+	if dialect == nil {
+		dialect = DetectDialect()
+	}
+	return NewWithDialect(dialect, path)
+}
+
+func NewWithDialect(dialect Dialect, path string) *Config {
+	c := &Config{
+		FilePath:        path,
+		Dialect:         dialect,
 		Aliases:         make(map[string]string),
 		Exports:         make(map[string]string),
+		Variables:       make(map[string]string),
+		Options:         make(map[string]bool),
 		OhMyZshPlugins:  []string{},
 		CustomFunctions: []string{},
 		RawSections:     make(map[string][]string),
+		Guarded:         []*GuardedEntry{},
+		Descriptions:    make(map[NodeKind]map[string]string),
+		Backups:         backup.NewStore(),
+		doc:             dialect.Parse(""),
+		functionFiles:   make(map[string]string),
 	}
+	c.resetHistory()
+	return c
 }
 
+// Load reads the config from disk, discarding unsaved edits and the undo
+// history.
 func (c *Config) Load() error {
+	err := c.load(nil)
+	c.resetHistory()
+	return err
+}
+
+// load reads the config and its sourced files. Files with an entry in texts
+// are parsed from that text instead of their content on disk, which is still
+// kept as the base for detecting changes.
+func (c *Config) load(texts map[string]string) error {
 	logger.Debug("Loading shell config from %s", c.FilePath)
+	lock, err := filelock.Shared(c.FilePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	c.resolveDialect()
 	
 	c.Aliases = make(map[string]string)
 	c.Exports = make(map[string]string)
+	c.Variables = make(map[string]string)
+	c.Options = make(map[string]bool)
 	c.OhMyZshTheme = ""
 	c.OhMyZshPlugins = []string{}
 	c.CustomFunctions = []string{}
 	c.RawSections = make(map[string][]string)
-
-	file, err := os.Open(c.FilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			logger.Info("Config file does not exist: %s", c.FilePath)
-			return nil
-		}
-		logger.Error("Failed to open config file: %v", err)
-		return fmt.Errorf("failed to open config file: %w", err)
+	c.Guarded = []*GuardedEntry{}
+	c.Descriptions = make(map[NodeKind]map[string]string)
+	c.doc = c.Dialect.Parse("")
+	c.root = nil
+	c.block = nil
+	switch c.Mode {
+	case WriteManagedBlock:
+		c.block, _ = splitManaged("")
+	case WriteDropIn:
+		c.block, _ = splitLoader("", c.Dialect, c.dropInGlob())
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	currentSection := "other"
-	inFunction := false
-	functionLines := []string{}
-
-	aliasRegex := regexp.MustCompile(`^\s*alias\s+(\w+)=['"](.+)['"]`)
-	exportRegex := regexp.MustCompile(`^\s*export\s+(\w+)=['"]?(.+?)['"]?\s*$`)
-	themeRegex := regexp.MustCompile(`^\s*ZSH_THEME=['"](.+)['"]`)
-	pluginsRegex := regexp.MustCompile(`^\s*plugins=\((.*)\)`)
-	functionStartRegex := regexp.MustCompile(`^\s*(\w+)\s*\(\)\s*{`)
-	functionEndRegex := regexp.MustCompile(`^\s*}`)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") {
-			if !inFunction {
-				c.RawSections[currentSection] = append(c.RawSections[currentSection], line)
-			}
-			continue
-		}
+	c.functionFiles = make(map[string]string)
 
-		if inFunction {
-			functionLines = append(functionLines, line)
-			if functionEndRegex.MatchString(line) {
-				inFunction = false
-				c.CustomFunctions = append(c.CustomFunctions, strings.Join(functionLines, "\n"))
-				functionLines = []string{}
-			}
-			continue
+	text, override := texts[c.FilePath]
+	content, err := os.ReadFile(c.FilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Failed to open config file: %v", err)
+			return fmt.Errorf("failed to open config file: %w", err)
 		}
-
-		if matches := functionStartRegex.FindStringSubmatch(line); matches != nil {
-			inFunction = true
-			functionLines = []string{line}
-			continue
+		logger.Info("Config file does not exist: %s", c.FilePath)
+		if !override && c.block == nil {
+			return c.loadFunctionFiles()
 		}
+	}
 
-		if matches := aliasRegex.FindStringSubmatch(line); matches != nil {
-			c.Aliases[matches[1]] = matches[2]
-			currentSection = "aliases"
-			logger.Debug("Found alias: %s = %s", matches[1], matches[2])
-		} else if matches := exportRegex.FindStringSubmatch(line); matches != nil {
-			c.Exports[matches[1]] = matches[2]
-			currentSection = "exports"
-			logger.Debug("Found export: %s = %s", matches[1], matches[2])
-		} else if matches := themeRegex.FindStringSubmatch(line); matches != nil {
-			c.OhMyZshTheme = matches[1]
-			currentSection = "ohmyzsh"
-			logger.Debug("Found theme: %s", matches[1])
-		} else if matches := pluginsRegex.FindStringSubmatch(line); matches != nil {
-			pluginsStr := matches[1]
-			plugins := strings.Fields(pluginsStr)
-			c.OhMyZshPlugins = plugins
-			currentSection = "ohmyzsh"
-			logger.Debug("Found plugins: %v", plugins)
-		} else {
-			c.RawSections[currentSection] = append(c.RawSections[currentSection], line)
+	if !override {
+		text = string(content)
+	}
+	if c.block != nil {
+		c.block, text = c.block.split(text)
+	}
+	c.doc = c.Dialect.Parse(text)
+	root := c.tree()
+	root.original = string(content)
+	locks, err := c.loadIncludes(root, map[string]bool{includeKey(c.FilePath): true}, 0, texts)
+	defer func() {
+		for _, lock := range locks {
+			lock.Release()
 		}
+	}()
+	if err != nil {
+		return err
 	}
-
-	if err := scanner.Err(); err != nil {
-		logger.Error("Error scanning file: %v", err)
-		return fmt.Errorf("error scanning file: %w", err)
+	c.loadDropIns(texts)
+	c.populate()
+	if err := c.loadFunctionFiles(); err != nil {
+		return err
 	}
 	
-	logger.Info("Successfully loaded config: %d aliases, %d exports, %d functions", 
-		len(c.Aliases), len(c.Exports), len(c.CustomFunctions))
+	logger.Info("Successfully loaded config: %d aliases, %d exports, %d functions, %d included files", 
+		len(c.Aliases), len(c.Exports), len(c.CustomFunctions), len(root.Files())-1)
 	return nil
 }
 
-func (c *Config) Save() error {
-	logger.Debug("Saving shell config to %s", c.FilePath)
-	
-	tempFile := c.FilePath + ".tmp"
-	file, err := os.Create(tempFile)
-	if err != nil {
-		logger.Error("Failed to create temp file: %v", err)
-		return fmt.Errorf("failed to create temp file: %w", err)
+// resolveDialect switches to the dialect matching FilePath, so that pointing
+// a config at ~/.bashrc parses it as bash.
+func (c *Config) resolveDialect() {
+	d := DialectForFile(c.FilePath)
+	if d == nil || d == c.Dialect {
+		return
 	}
-	defer file.Close()
-
-	writer := bufio.NewWriter(file)
+	c.Dialect = d
+	if c.doc == nil || len(c.doc.Nodes) == 0 {
+		c.doc = d.Parse("")
+	} else {
+		c.doc.dialect = d
+	}
+}
 
-	if c.OhMyZshTheme != "" || len(c.OhMyZshPlugins) > 0 {
-		writer.WriteString("# Oh My Zsh Configuration\n")
-		if c.OhMyZshTheme != "" {
-			writer.WriteString(fmt.Sprintf("ZSH_THEME=\"%s\"\n", c.OhMyZshTheme))
+// populate fills the typed fields from the include tree. Later definitions of
+// the same name win, matching what the shell does when it sources the files.
+// Entries under a condition go to Guarded instead.
+func (c *Config) populate() {
+	currentSection := "other"
+	c.tree().walk(func(src *Source, node *Node) {
+		if guard := (nodeRef{src, node}).guard(); guard != nil && (node.Kind == NodeAlias || node.Kind == NodeExport || node.Kind == NodeVariable) {
+			c.Guarded = append(c.Guarded, &GuardedEntry{
+				Kind:        node.Kind,
+				Name:        node.Name,
+				Value:       node.Value,
+				Description: src.Doc.description(node),
+				Guard:       guard,
+				node:        node,
+			})
+			logger.Debug("Found %s %s under %s", node.Kind, node.Name, guard)
+			return
 		}
-		if len(c.OhMyZshPlugins) > 0 {
-			writer.WriteString(fmt.Sprintf("plugins=(%s)\n", strings.Join(c.OhMyZshPlugins, " ")))
+		switch node.Kind {
+		case NodeAlias:
+			c.Aliases[node.Name] = node.Value
+			currentSection = "aliases"
+			logger.Debug("Found alias: %s = %s", node.Name, node.Value)
+		case NodeExport:
+			c.Exports[node.Name] = node.Value
+			currentSection = "exports"
+			logger.Debug("Found export: %s = %s", node.Name, node.Value)
+		case NodeVariable:
+			c.Variables[node.Name] = node.Value
+			logger.Debug("Found variable: %s = %s", node.Name, node.Value)
+		case NodeOption:
+			for _, name := range strings.Fields(node.Name) {
+				c.Options[name] = node.Value == "on"
+			}
+			logger.Debug("Found option: %s = %s", node.Name, node.Value)
+		case NodeTheme:
+			c.OhMyZshTheme = node.Value
+			currentSection = "ohmyzsh"
+			logger.Debug("Found theme: %s", node.Value)
+		case NodePlugins:
+			c.OhMyZshPlugins = strings.Fields(node.Value)
+			currentSection = "ohmyzsh"
+			logger.Debug("Found plugins: %v", c.OhMyZshPlugins)
+		case NodeFunction:
+			c.CustomFunctions = append(c.CustomFunctions, node.Value)
+		default:
+			c.RawSections[currentSection] = append(c.RawSections[currentSection], node.String())
 		}
-		writer.WriteString("\n")
-	}
+	})
+	c.populateDescriptions()
+}
 
-	if len(c.Exports) > 0 {
-		writer.WriteString("# Environment Variables\n")
-		for key, value := range c.Exports {
-			// Always quote values for consistency and safety
-			writer.WriteString(fmt.Sprintf("export %s=\"%s\"\n", key, value))
-		}
-		writer.WriteString("\n")
-	}
+// Document returns the document model backing the typed fields, with any
+// pending edits to those fields applied.
+func (c *Config) Document() *Document {
+	c.sync()
+	return c.doc
+}
 
-	if len(c.Aliases) > 0 {
-		writer.WriteString("# Aliases\n")
-		for name, command := range c.Aliases {
-			writer.WriteString(fmt.Sprintf("alias %s='%s'\n", name, command))
-		}
-		writer.WriteString("\n")
-	}
+// AliasNames returns alias names in file order followed by new aliases
+// sorted by name.
+func (c *Config) AliasNames() []string {
+	return orderedNames(c.unguarded(NodeAlias), c.Aliases)
+}
 
-	if len(c.CustomFunctions) > 0 {
-		writer.WriteString("# Custom Functions\n")
-		for _, function := range c.CustomFunctions {
-			writer.WriteString(function)
-			writer.WriteString("\n\n")
-		}
-	}
+// ExportNames returns exported variable names in file order followed by new
+// exports sorted by name.
+func (c *Config) ExportNames() []string {
+	return orderedNames(c.unguarded(NodeExport), c.Exports)
+}
 
-	for section, lines := range c.RawSections {
-		if section != "other" && len(lines) > 0 {
-			writer.WriteString(fmt.Sprintf("# %s\n", section))
-		}
-		for _, line := range lines {
-			writer.WriteString(line)
-			writer.WriteString("\n")
-		}
-		if len(lines) > 0 {
-			writer.WriteString("\n")
+func (c *Config) loadFunctionFiles() error {
+	fd, ok := c.Dialect.(functionDir)
+	if !ok {
+		return nil
+	}
+	dir := fd.FunctionDir(c.FilePath)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+filepath.Ext(c.FilePath)))
+	sort.Strings(paths)
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("Failed to read function file: %v", err)
+			return fmt.Errorf("failed to read function file: %w", err)
 		}
+		text := strings.TrimSuffix(string(content), "\n")
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		c.functionFiles[name] = text
+		c.CustomFunctions = append(c.CustomFunctions, text)
+		logger.Debug("Found function file: %s", path)
 	}
+	return nil
+}
 
-	if err := writer.Flush(); err != nil {
-		logger.Error("Failed to flush writer: %v", err)
-		return fmt.Errorf("failed to write to temp file: %w", err)
+// FunctionName returns the name a function definition declares.
+func FunctionName(text string) string {
+	header, _ := headerLine(text)
+	if name, _, ok := parseFunctionHeader(header); ok {
+		return name
 	}
-	
-
-	// Create backup of original file
-	backupPath := c.FilePath + ".bak"
-	if _, err := os.Stat(c.FilePath); err == nil {
-		if err := os.Rename(c.FilePath, backupPath); err != nil {
-			logger.Warn("Failed to create backup: %v", err)
-		}
+	if matches := fishFunctionStartRegex.FindStringSubmatch(header); matches != nil {
+		return matches[1]
 	}
+	return ""
+}
 
-	if err := os.Rename(tempFile, c.FilePath); err != nil {
-		logger.Error("Failed to rename temp file: %v", err)
-		// Try to restore backup
-		if _, err := os.Stat(backupPath); err == nil {
-			os.Rename(backupPath, c.FilePath)
-		}
-		return fmt.Errorf("failed to save config: %w", err)
-	}
-	
-	logger.Info("Successfully saved config to %s", c.FilePath)
-	return nil
+// Save writes the root file and any sourced file whose entries were edited.
+func (c *Config) Save() error {
+	return c.SaveChanges(c.Changes())
 }
 
 func (c *Config) GetAvailableThemes() ([]string, error) {
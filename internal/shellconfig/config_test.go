@@ -8,6 +8,7 @@ import (
 )
 
 func TestNew(t *testing.T) {
+	t.Setenv("SHELL", "/bin/zsh")
 	config := New()
 	
 	if config == nil {
@@ -34,6 +35,10 @@ func TestNew(t *testing.T) {
 		t.Error("Expected RawSections map to be initialized")
 	}
 	
+	if config.Dialect != Zsh {
+		t.Errorf("Expected zsh dialect, got %s", config.Dialect.Name())
+	}
+	
 	homeDir, _ := os.UserHomeDir()
 	expectedPath := filepath.Join(homeDir, ".zshrc")
 	if config.FilePath != expectedPath {
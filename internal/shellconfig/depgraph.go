@@ -0,0 +1,290 @@
+package shellconfig
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// references returns the variables value refers to, in order and without
+// duplicates. Escaped dollars, as in single-quoted values, are skipped.
+func references(value string) []string {
+	names := []string{}
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '$':
+			j := i + 1
+			if j < len(value) && value[j] == '{' {
+				j++
+				if j < len(value) && value[j] == '#' {
+					j++
+				}
+			}
+			start := j
+			for j < len(value) && isWordChar(value[j]) {
+				j++
+			}
+			if name := value[start:j]; identifierRegex.MatchString(name) && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+			i = j - 1
+		}
+	}
+	return names
+}
+
+// DependencyIssue is the way a reference between variables breaks.
+type DependencyIssue int
+
+const (
+	// UsedBeforeDefined is a reference to a variable the config only
+	// assigns further down, so it still has its inherited value.
+	UsedBeforeDefined DependencyIssue = iota
+	// DependencyCycle is a set of variables that refer to each other.
+	DependencyCycle
+)
+
+// DependencyProblem is a broken reference between variables of a config.
+type DependencyProblem struct {
+	Issue DependencyIssue
+	// Name is the variable whose value has the reference, or the first of
+	// a cycle.
+	Name string
+	// Refers are the variables used before they are assigned, or the
+	// variables of the cycle.
+	Refers []string
+	// Origin is where the assignment with the reference is.
+	Origin Origin
+	// Elsewhere is set when a variable it uses before it is set is assigned
+	// in another file. Saving only orders assignments within a file, so it
+	// leaves these as they are.
+	Elsewhere bool
+}
+
+func (p DependencyProblem) String() string {
+	if p.Issue == DependencyCycle {
+		return fmt.Sprintf("%s refer to each other", strings.Join(p.Refers, ", "))
+	}
+	text := fmt.Sprintf("%s uses %s before it is set (%s)", p.Name, strings.Join(p.Refers, ", "), p.Origin)
+	if p.Elsewhere {
+		text += "; it is set in another file, so saving cannot fix the order"
+	}
+	return text
+}
+
+// Involves reports whether the problem concerns the variable name.
+func (p DependencyProblem) Involves(name string) bool {
+	return p.Name == name || (p.Issue == DependencyCycle && slices.Contains(p.Refers, name))
+}
+
+// VariableGraph is how the exports and variables of a config refer to each
+// other.
+type VariableGraph struct {
+	// Deps maps each variable the config assigns to the other variables of
+	// the config its values refer to. References to itself, as in
+	// PATH=$HOME/bin:$PATH, are left out.
+	Deps map[string][]string
+	// Problems are listed in the order the shell runs the assignments,
+	// followed by cycles.
+	Problems []DependencyProblem
+}
+
+// VariableGraph builds the dependency graph of the exports and variables,
+// including those assigned under a condition, across the include tree.
+func (c *Config) VariableGraph() *VariableGraph {
+	c.sync()
+	refs := []nodeRef{}
+	assigned := make(map[string]*Source)
+	c.tree().walk(func(src *Source, node *Node) {
+		if node.Kind == NodeExport || node.Kind == NodeVariable {
+			refs = append(refs, nodeRef{src, node})
+			if assigned[node.Name] == nil {
+				assigned[node.Name] = src
+			}
+		}
+	})
+
+	graph := &VariableGraph{Deps: make(map[string][]string)}
+	defined := make(map[string]bool)
+	for _, ref := range refs {
+		name := ref.node.Name
+		if _, ok := graph.Deps[name]; !ok {
+			graph.Deps[name] = []string{}
+		}
+		early := []string{}
+		elsewhere := false
+		for _, dep := range references(ref.node.Value) {
+			if dep == name || assigned[dep] == nil {
+				continue
+			}
+			if !slices.Contains(graph.Deps[name], dep) {
+				graph.Deps[name] = append(graph.Deps[name], dep)
+			}
+			if !defined[dep] {
+				early = append(early, dep)
+				elsewhere = elsewhere || assigned[dep] != ref.src
+			}
+		}
+		if len(early) > 0 {
+			origin := Origin{Path: ref.src.Path, Line: ref.src.Doc.LineOf(ref.node)}
+			graph.Problems = append(graph.Problems, DependencyProblem{Issue: UsedBeforeDefined, Name: name, Refers: early, Origin: origin, Elsewhere: elsewhere})
+		}
+		defined[name] = true
+	}
+
+	for _, cycle := range graph.cycles() {
+		graph.Problems = append(graph.Problems, DependencyProblem{Issue: DependencyCycle, Name: cycle[0], Refers: cycle})
+	}
+	return graph
+}
+
+// cycles returns the sets of variables that refer to each other, each
+// sorted, using Tarjan's strongly connected components.
+func (g *VariableGraph) cycles() [][]string {
+	names := make([]string, 0, len(g.Deps))
+	for name := range g.Deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := []string{}
+	cycles := [][]string{}
+	var visit func(name string)
+	visit = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, dep := range g.Deps[name] {
+			if _, seen := index[dep]; !seen {
+				visit(dep)
+				low[name] = min(low[name], low[dep])
+			} else if onStack[dep] {
+				low[name] = min(low[name], index[dep])
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+		component := []string{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, name := range names {
+		if _, seen := index[name]; !seen {
+			visit(name)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+// orderAssignments moves the unconditional assignments added or edited since
+// loading so that each comes after the assignments in the same file it
+// refers to and before those that refer to it. Lines that were not edited
+// stay where they are, and cycles are left alone. Files are ordered one at a
+// time, since moving a line into another file would change what sources it.
+func (d *Document) orderAssignments() {
+	for range len(d.Nodes) {
+		if !d.moveAssignment() {
+			return
+		}
+	}
+}
+
+// moveAssignment moves the first edited assignment that is out of order and
+// reports whether it found one.
+func (d *Document) moveAssignment() bool {
+	assignments := []*Node{}
+	first := make(map[string]int)
+	users := make(map[string][]*Node)
+	for i, node := range d.Nodes {
+		if (node.Kind == NodeExport || node.Kind == NodeVariable) && node.Guard == nil {
+			assignments = append(assignments, node)
+			if _, ok := first[node.Name]; !ok {
+				first[node.Name] = i
+			}
+			for _, dep := range references(node.Value) {
+				if dep != node.Name {
+					users[dep] = append(users[dep], node)
+				}
+			}
+		}
+	}
+
+	for _, node := range assignments {
+		if node.Lines != nil || len(node.Group()) > 1 {
+			continue
+		}
+		i := d.indexOf(node)
+		// The node must follow the first assignment of everything it uses.
+		after := -1
+		for _, dep := range references(node.Value) {
+			if j, ok := first[dep]; ok && dep != node.Name && j > after {
+				after = j
+			}
+		}
+		// As the first assignment of its name, it must precede the
+		// assignments that use it, directly or through other variables.
+		before := len(d.Nodes)
+		if first[node.Name] == i {
+			seen := map[string]bool{node.Name: true}
+			for queue := []string{node.Name}; len(queue) > 0; queue = queue[1:] {
+				for _, user := range users[queue[0]] {
+					if user == node {
+						continue
+					}
+					before = min(before, d.indexOf(user.head()))
+					if !seen[user.Name] {
+						seen[user.Name] = true
+						queue = append(queue, user.Name)
+					}
+				}
+			}
+		}
+		if after >= before || (after < i && i < before) {
+			continue
+		}
+
+		moving := append(d.leadingComments(node), node)
+		var anchor *Node
+		if i <= after {
+			group := d.Nodes[after].Group()
+			anchor = group[len(group)-1]
+		} else {
+			anchor = d.Nodes[before]
+			if comments := d.leadingComments(anchor); len(comments) > 0 {
+				anchor = comments[0]
+			}
+		}
+		for _, n := range moving {
+			d.Remove(n)
+		}
+		at := d.indexOf(anchor)
+		if i <= after {
+			at++
+		}
+		d.Insert(at, moving...)
+		return true
+	}
+	return false
+}
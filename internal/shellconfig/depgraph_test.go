@@ -0,0 +1,103 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	refs := references(`${XDG_CONFIG_HOME:-$HOME/.config}/app:\$LITERAL:$GOBIN:${#GOPATH}:$HOME`)
+	if !slices.Equal(refs, []string{"XDG_CONFIG_HOME", "HOME", "GOBIN", "GOPATH"}) {
+		t.Errorf("Expected each reference once, got %v", refs)
+	}
+}
+
+func TestVariableGraph(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	content := "export PATH=\"$GOBIN:$PATH\"\nexport GOPATH=~/go\nexport GOBIN=\"$GOPATH/bin\"\nexport A=\"$B\"\nexport B=\"$A\"\n"
+	os.WriteFile(path, []byte(content), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	graph := config.VariableGraph()
+	if !slices.Equal(graph.Deps["PATH"], []string{"GOBIN"}) || !slices.Equal(graph.Deps["GOBIN"], []string{"GOPATH"}) || len(graph.Deps["GOPATH"]) != 0 {
+		t.Errorf("Expected PATH to depend on GOBIN and GOBIN on GOPATH, got %v", graph.Deps)
+	}
+	if len(graph.Problems) != 3 {
+		t.Fatalf("Expected three problems, got %v", graph.Problems)
+	}
+	if p := graph.Problems[0]; p.Issue != UsedBeforeDefined || p.Name != "PATH" || p.Origin.Line != 1 {
+		t.Errorf("Expected PATH to use GOBIN before it is set, got %v", p)
+	}
+	if p := graph.Problems[2]; p.Issue != DependencyCycle || !slices.Equal(p.Refers, []string{"A", "B"}) || !p.Involves("B") {
+		t.Errorf("Expected A and B to form a cycle, got %v", p)
+	}
+
+	if changes := config.Changes(); len(changes) != 0 {
+		t.Errorf("Expected lines that were not edited to stay in place, got:\n%s", changes[0].Unified())
+	}
+}
+
+func TestSaveOrdersDependencies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	os.WriteFile(path, []byte("export EDITOR=vim\nexport PATH=\"$GOBIN:$PATH\"\n"), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	config.Exports["GOBIN"] = "$GOPATH/bin"
+	config.Exports["GOPATH"] = "$HOME/go"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	expected := "export EDITOR=vim\nexport GOPATH=\"$HOME/go\"\nexport GOBIN=\"$GOPATH/bin\"\nexport PATH=\"$GOBIN:$PATH\"\n"
+	if string(content) != expected {
+		t.Errorf("Expected new exports before the line using them, got:\n%s", content)
+	}
+	if config.Modified() {
+		t.Error("Expected the config to match the saved order")
+	}
+	if problems := config.VariableGraph().Problems; len(problems) != 0 {
+		t.Errorf("Expected no problems after saving, got %v", problems)
+	}
+}
+
+func TestViewingDoesNotReorder(t *testing.T) {
+	config := newTestConfig("export EDITOR=vim\nexport PATH=\"$GOBIN:$PATH\"\n")
+	config.Exports["GOBIN"] = "$HOME/go/bin"
+
+	config.Path()
+	config.VariableGraph()
+	config.Changes()
+	config.Preview()
+	if origin, _ := config.Origin(NodeExport, "PATH"); origin.Line != 2 {
+		t.Errorf("Expected PATH to stay on line 2 while viewing, got %d", origin.Line)
+	}
+	if got := config.Document().String(); got != "export EDITOR=vim\nexport PATH=\"$GOBIN:$PATH\"\nexport GOBIN=\"$HOME/go/bin\"\n" {
+		t.Errorf("Expected no reordering until saved, got:\n%s", got)
+	}
+}
+
+func TestVariableGraphAcrossFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFiles(t, home, map[string]string{
+		".bashrc":  "export GOBIN=\"$GOPATH/bin\"\nsource ~/.go.bash\n",
+		".go.bash": "export GOPATH=~/go\n",
+	})
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	problems := config.VariableGraph().Problems
+	if len(problems) != 1 || problems[0].Name != "GOBIN" || !problems[0].Elsewhere {
+		t.Errorf("Expected GOBIN to use GOPATH from another file too early, got %v", problems)
+	}
+}
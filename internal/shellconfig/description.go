@@ -0,0 +1,155 @@
+package shellconfig
+
+import (
+	"strings"
+)
+
+// sectionHeaders are the comments appendSection writes above new sections.
+var sectionHeaders = map[string]bool{
+	"Environment Variables":   true,
+	"Shell Variables":         true,
+	"Shell Options":           true,
+	"Aliases":                 true,
+	"Custom Functions":        true,
+	"Oh My Zsh Configuration": true,
+}
+
+// leadingComments returns the comment lines directly above node that
+// describe it. A comment heading a paragraph of several lines, such as
+// "# Aliases" or "# Path setup", describes the section rather than its first
+// entry. Aliases, exports and variables added since loading only have inline
+// comments.
+func (d *Document) leadingComments(node *Node) []*Node {
+	node = node.head()
+	i := d.indexOf(node)
+	if i < 0 || !describable(node.Kind) || (node.Line == 0 && node.Lines == nil && node.Kind != NodeFunction) {
+		return nil
+	}
+	start := i
+	for start > 0 && d.Nodes[start-1].Kind == NodeComment && !sectionHeaders[commentText(d.Nodes[start-1].String())] {
+		start--
+	}
+	if start == i {
+		return nil
+	}
+	for j := i + 1; j < len(d.Nodes); j++ {
+		if next := d.Nodes[j]; next.head() != node {
+			if next.Kind != NodeBlank && next.Kind != NodeComment {
+				return nil
+			}
+			break
+		}
+	}
+	return append([]*Node{}, d.Nodes[start:i]...)
+}
+
+// description returns the text of the comment attached to node: its inline
+// comment if it has one, otherwise the comment lines above it.
+func (d *Document) description(node *Node) string {
+	if comment := node.head().Comment; comment != "" {
+		return commentText(comment)
+	}
+	lines := []string{}
+	for _, comment := range d.leadingComments(node) {
+		lines = append(lines, commentText(comment.String()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setDescription rewrites the comment attached to node, keeping it inline or
+// above the entry as it was. Entries without a comment get an inline one,
+// except functions, which get a comment line above.
+func (d *Document) setDescription(node *Node, text string) {
+	if d.description(node) == text {
+		return
+	}
+	head := node.head()
+	leading := d.leadingComments(head)
+	if head.Comment != "" || (len(leading) == 0 && head.Kind != NodeFunction) {
+		head.Comment = ""
+		if text != "" {
+			head.Comment = "# " + strings.ReplaceAll(text, "\n", " ")
+		}
+		head.Lines = nil
+		return
+	}
+
+	for _, comment := range leading {
+		d.Remove(comment)
+	}
+	if text == "" {
+		return
+	}
+	indent := head.Indent
+	if len(leading) > 0 {
+		indent = indentOf(leading[0].String())
+	}
+	comments := []*Node{}
+	for _, line := range strings.Split(text, "\n") {
+		comments = append(comments, &Node{Kind: NodeComment, Value: strings.TrimRight(indent+"# "+line, " ")})
+	}
+	d.Insert(d.indexOf(head), comments...)
+}
+
+func commentText(comment string) string {
+	comment = strings.TrimLeft(comment, " \t")
+	comment = strings.TrimPrefix(comment, "#")
+	return strings.TrimPrefix(comment, " ")
+}
+
+// Description returns the comment describing the effective definition of a
+// named alias, export, variable or function.
+func (c *Config) Description(kind NodeKind, name string) string {
+	return c.Descriptions[kind][name]
+}
+
+// SetDescription sets the comment describing a named entry. It is written
+// next to the entry when the config is saved.
+func (c *Config) SetDescription(kind NodeKind, name, text string) {
+	if c.Descriptions[kind] == nil {
+		c.Descriptions[kind] = make(map[string]string)
+	}
+	c.Descriptions[kind][name] = text
+}
+
+// describedKinds are the entry kinds that carry descriptions.
+var describedKinds = []NodeKind{NodeAlias, NodeExport, NodeVariable, NodeFunction}
+
+func describable(kind NodeKind) bool {
+	for _, k := range describedKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// populateDescriptions reads the descriptions of the effective definitions.
+func (c *Config) populateDescriptions() {
+	c.Descriptions = make(map[NodeKind]map[string]string)
+	for _, kind := range describedKinds {
+		for _, ref := range c.unguarded(kind) {
+			if text := ref.src.Doc.description(ref.node); text != "" {
+				c.SetDescription(kind, ref.node.Name, text)
+			} else {
+				delete(c.Descriptions[kind], ref.node.Name)
+			}
+		}
+	}
+}
+
+// syncDescriptions writes changed descriptions to the comments of the
+// effective definition of each entry.
+func (c *Config) syncDescriptions() {
+	for _, kind := range describedKinds {
+		last := make(map[string]nodeRef)
+		for _, ref := range c.unguarded(kind) {
+			last[ref.node.Name] = ref
+		}
+		for name, text := range c.Descriptions[kind] {
+			if ref, ok := last[name]; ok {
+				ref.src.Doc.setDescription(ref.node, text)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package shellconfig
+
+import (
+	"testing"
+)
+
+const describedContent = `# Aliases
+alias ll='ls -la'
+alias la='ls -A'
+
+# Show git status
+alias gs='git status'
+
+export EDITOR=vim # preferred editor
+
+# Make a directory
+# and enter it
+mkcd() {
+    mkdir -p "$1" && cd "$1"
+}
+`
+
+func TestParseDescriptions(t *testing.T) {
+	config := newTestConfig(describedContent)
+
+	cases := []struct {
+		kind NodeKind
+		name string
+		want string
+	}{
+		{NodeAlias, "ll", ""},
+		{NodeAlias, "gs", "Show git status"},
+		{NodeExport, "EDITOR", "preferred editor"},
+		{NodeFunction, "mkcd", "Make a directory\nand enter it"},
+	}
+	for _, tc := range cases {
+		if got := config.Description(tc.kind, tc.name); got != tc.want {
+			t.Errorf("Description of %s %s: expected %q, got %q", tc.kind, tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestEditDescriptions(t *testing.T) {
+	config := newTestConfig(describedContent)
+
+	config.SetDescription(NodeAlias, "gs", "Short git status")
+	config.SetDescription(NodeAlias, "ll", "Long listing")
+	config.SetDescription(NodeExport, "EDITOR", "")
+	config.SetDescription(NodeFunction, "mkcd", "mkdir and cd")
+	config.Aliases["gd"] = "git diff"
+	config.SetDescription(NodeAlias, "gd", "Show diff")
+
+	want := `# Aliases
+alias ll='ls -la' # Long listing
+alias la='ls -A'
+
+# Short git status
+alias gs='git status'
+
+alias gd='git diff' # Show diff
+
+export EDITOR=vim
+
+# mkdir and cd
+mkcd() {
+    mkdir -p "$1" && cd "$1"
+}
+`
+	if got := config.Document().String(); got != want {
+		t.Errorf("Unexpected document:\n%s\nwant:\n%s", got, want)
+	}
+
+	delete(config.Aliases, "gs")
+	if got := config.Document().String(); got != `# Aliases
+alias ll='ls -la' # Long listing
+alias la='ls -A'
+
+
+alias gd='git diff' # Show diff
+
+export EDITOR=vim
+
+# mkdir and cd
+mkcd() {
+    mkdir -p "$1" && cd "$1"
+}
+` {
+		t.Errorf("Expected the comment of a removed alias to go with it, got:\n%s", got)
+	}
+}
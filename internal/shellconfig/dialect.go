@@ -0,0 +1,117 @@
+package shellconfig
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// Dialect describes how a particular shell's startup files are located,
+// parsed and written.
+type Dialect interface {
+	Name() string
+	// ConfigFiles lists the startup files the shell reads, most commonly
+	// edited first.
+	ConfigFiles(homeDir string) []string
+	// Matches reports whether path is a startup file written in the dialect.
+	Matches(path string) bool
+	// Supports reports whether the dialect has a construct for the kind.
+	Supports(kind NodeKind) bool
+	Parse(content string) *Document
+	Render(node *Node) string
+	// FormatFunction builds a function definition from body lines written
+	// with POSIX positional parameters.
+	FormatFunction(name string, body []string) string
+	FormatGuard(condition string) (string, string)
+	// FormatSourceLoop builds a loop that sources every file matching glob.
+	FormatSourceLoop(glob string) string
+}
+
+// Dialects lists every supported shell in detection order.
+func Dialects() []Dialect {
+	return []Dialect{Zsh, Bash, Fish}
+}
+
+func DialectByName(name string) Dialect {
+	for _, d := range Dialects() {
+		if d.Name() == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// DialectForFile picks the dialect whose startup files include path.
+func DialectForFile(path string) Dialect {
+	for _, d := range Dialects() {
+		if d.Matches(path) {
+			return d
+		}
+	}
+	return nil
+}
+
+// functionDir is implemented by dialects that autoload functions from a
+// directory with one file per function.
+type functionDir interface {
+	FunctionDir(path string) string
+}
+
+// DetectDialect returns the dialect of the user's login shell, taken from
+// $SHELL or, failing that, /etc/passwd. It falls back to zsh.
+func DetectDialect() Dialect {
+	if d := DialectByName(filepath.Base(os.Getenv("SHELL"))); d != nil {
+		return d
+	}
+	if u, err := user.Current(); err == nil {
+		if file, err := os.Open("/etc/passwd"); err == nil {
+			defer file.Close()
+			if d := DialectByName(filepath.Base(passwdShell(file, u.Username))); d != nil {
+				return d
+			}
+		}
+	}
+	return Zsh
+}
+
+// passwdShell returns the login shell recorded for username in passwd(5)
+// formatted data.
+func passwdShell(r io.Reader, username string) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == username {
+			return fields[6]
+		}
+	}
+	return ""
+}
+
+// DefaultFile returns the first of the dialect's startup files that exists,
+// or the first candidate when none do.
+func DefaultFile(d Dialect, homeDir string) string {
+	files := d.ConfigFiles(homeDir)
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return files[0]
+}
+
+// ExistingConfigFiles lists the startup files of every dialect that exist
+// under homeDir.
+func ExistingConfigFiles(homeDir string) []string {
+	files := []string{}
+	for _, d := range Dialects() {
+		for _, file := range d.ConfigFiles(homeDir) {
+			if _, err := os.Stat(file); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,116 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectDialectFromShell(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/bash")
+	if d := DetectDialect(); d != Bash {
+		t.Errorf("Expected bash dialect, got %s", d.Name())
+	}
+
+	t.Setenv("SHELL", "/bin/zsh")
+	if d := DetectDialect(); d != Zsh {
+		t.Errorf("Expected zsh dialect, got %s", d.Name())
+	}
+}
+
+func TestPasswdShell(t *testing.T) {
+	passwd := "root:x:0:0:root:/root:/bin/bash\nalice:x:1000:1000:Alice:/home/alice:/usr/bin/zsh\n"
+	if shell := passwdShell(strings.NewReader(passwd), "alice"); shell != "/usr/bin/zsh" {
+		t.Errorf("Expected /usr/bin/zsh, got %q", shell)
+	}
+	if shell := passwdShell(strings.NewReader(passwd), "bob"); shell != "" {
+		t.Errorf("Expected no shell for unknown user, got %q", shell)
+	}
+}
+
+func TestDialectForFile(t *testing.T) {
+	cases := map[string]Dialect{
+		"/home/u/.bashrc":       Bash,
+		"/home/u/.bash_aliases": Bash,
+		"/home/u/.profile":      Bash,
+		"/home/u/.zshrc":        Zsh,
+		"/home/u/notes.txt":     nil,
+	}
+	for path, want := range cases {
+		if got := DialectForFile(path); got != want {
+			t.Errorf("Expected %v for %s, got %v", want, path, got)
+		}
+	}
+}
+
+const bashContent = `# ~/.bashrc
+HISTCONTROL=ignoreboth
+PROMPT_COMMAND='history -a'
+shopt -s histappend checkwinsize
+shopt -u nocaseglob
+declare -x EDITOR="vim"
+export PAGER=less
+alias ll='ls -alF'
+ZSH_THEME="agnoster"
+`
+
+func TestBashParse(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), ".bashrc")
+	if err := os.WriteFile(testFile, []byte(bashContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	config := NewForFile(testFile)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Dialect != Bash {
+		t.Fatalf("Expected bash dialect, got %s", config.Dialect.Name())
+	}
+	if config.Variables["HISTCONTROL"] != "ignoreboth" {
+		t.Errorf("Expected HISTCONTROL variable, got %q", config.Variables["HISTCONTROL"])
+	}
+	if config.Variables["PROMPT_COMMAND"] != "history -a" {
+		t.Errorf("Expected PROMPT_COMMAND variable, got %q", config.Variables["PROMPT_COMMAND"])
+	}
+	if config.Exports["EDITOR"] != "vim" || config.Exports["PAGER"] != "less" {
+		t.Errorf("Expected EDITOR and PAGER exports, got %v", config.Exports)
+	}
+	if !config.Options["histappend"] || !config.Options["checkwinsize"] || config.Options["nocaseglob"] {
+		t.Errorf("Unexpected options: %v", config.Options)
+	}
+	if config.OhMyZshTheme != "" || config.Variables["ZSH_THEME"] != "agnoster" {
+		t.Error("Expected ZSH_THEME to be a plain variable in bash")
+	}
+	if got := config.Document().String(); got != bashContent {
+		t.Errorf("Expected unedited bash document to round trip, got:\n%s", got)
+	}
+}
+
+func TestBashEdits(t *testing.T) {
+	config := NewWithDialect(Bash, filepath.Join(os.TempDir(), ".bashrc"))
+	config.doc = Bash.Parse(bashContent)
+	config.populate()
+
+	config.Exports["EDITOR"] = "nvim"
+	config.Options["checkwinsize"] = false
+	config.Options["globstar"] = true
+	config.OhMyZshTheme = "robbyrussell"
+
+	got := config.Document().String()
+	for _, want := range []string{
+		"declare -x EDITOR=\"nvim\"\n",
+		"shopt -s histappend\n",
+		"shopt -u nocaseglob\n",
+		"shopt -u nocaseglob\nshopt -u checkwinsize\nshopt -s globstar\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "robbyrussell") {
+		t.Errorf("Expected no Oh My Zsh theme in bash config:\n%s", got)
+	}
+}
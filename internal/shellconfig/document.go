@@ -0,0 +1,299 @@
+package shellconfig
+
+import (
+	"strings"
+)
+
+// NodeKind identifies what a document node represents.
+type NodeKind int
+
+const (
+	NodeRaw NodeKind = iota
+	NodeBlank
+	NodeComment
+	NodeAlias
+	NodeExport
+	NodeTheme
+	NodePlugins
+	NodeFunction
+	NodeOption
+	NodeVariable
+	NodeSource
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case NodeBlank:
+		return "blank"
+	case NodeComment:
+		return "comment"
+	case NodeAlias:
+		return "alias"
+	case NodeExport:
+		return "export"
+	case NodeTheme:
+		return "theme"
+	case NodePlugins:
+		return "plugins"
+	case NodeFunction:
+		return "function"
+	case NodeOption:
+		return "option"
+	case NodeVariable:
+		return "variable"
+	case NodeSource:
+		return "source"
+	}
+	return "raw"
+}
+
+// Node is a single line or multi-line construct of a shell config file.
+// Lines holds the original text; it is cleared when the node is edited so
+// that the document's dialect renders it from Name and Value instead.
+//
+// Lines that assign several names at once, such as "export A=1 B=2", become
+// one node per name sharing a group; the first member renders the line.
+//
+// Guard is the condition the node runs under, if any. Indent is the leading
+// whitespace kept when an edited node is rendered.
+type Node struct {
+	Kind    NodeKind
+	Name    string
+	Value   string
+	Keyword string
+	Quote   QuoteStyle
+	Comment string
+	Line    int
+	Lines   []string
+	Guard   *Guard
+	Indent  string
+
+	group   *Node
+	members []*Node
+}
+
+// String returns the original text of the node, or its value when the node
+// has no source text. Use Document.Text to render edited nodes.
+func (n *Node) String() string {
+	if n.Lines != nil {
+		return strings.Join(n.Lines, "\n")
+	}
+	return n.Value
+}
+
+// Modified reports whether the node, or any node sharing its line, differs
+// from the text it was parsed from.
+func (n *Node) Modified() bool {
+	for _, member := range n.Group() {
+		if member.Lines == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Group returns the nodes defined on the same line as n, in order.
+func (n *Node) Group() []*Node {
+	if n.group == nil {
+		return []*Node{n}
+	}
+	return n.group.members
+}
+
+func (n *Node) head() *Node {
+	if n.group == nil {
+		return n
+	}
+	return n.group
+}
+
+// groupNodes makes nodes share a single line, rendered by the first.
+func groupNodes(nodes []*Node) {
+	if len(nodes) < 2 {
+		return
+	}
+	for _, node := range nodes {
+		node.group = nodes[0]
+	}
+	nodes[0].members = nodes
+}
+
+func (n *Node) set(value string) {
+	if n.Value == value {
+		return
+	}
+	n.Value = value
+	n.Lines = nil
+}
+
+// Document is an ordered, lossless representation of a shell config file.
+// Rendering an unedited document reproduces the original bytes.
+type Document struct {
+	Nodes           []*Node
+	TrailingNewline bool
+
+	dialect Dialect
+}
+
+// ParseDocument parses zsh content. Use Dialect.Parse for other shells.
+func ParseDocument(content string) *Document {
+	return Zsh.Parse(content)
+}
+
+func (d *Document) String() string {
+	if len(d.Nodes) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for i, node := range d.Nodes {
+		if node.head() != node {
+			continue
+		}
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(d.Text(node))
+	}
+	if d.TrailingNewline {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Text renders a single node, using the original text when it is unedited.
+func (d *Document) Text(node *Node) string {
+	node = node.head()
+	if !node.Modified() || d.dialect == nil {
+		return node.String()
+	}
+	text := d.dialect.Render(node)
+	if node.Guard != nil && node.Guard.Inline() {
+		text = node.Guard.Condition + " && " + text
+	}
+	return node.Indent + text
+}
+
+// Find returns every node of the given kind in document order.
+func (d *Document) Find(kind NodeKind) []*Node {
+	nodes := []*Node{}
+	for _, node := range d.Nodes {
+		if node.Kind == kind {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// LineOf returns the 1-based line at which node starts when the document is
+// rendered, or 0 if the node is not part of the document.
+func (d *Document) LineOf(node *Node) int {
+	line := 1
+	node = node.head()
+	for _, n := range d.Nodes {
+		if n == node {
+			return line
+		}
+		if n.head() == n {
+			line += strings.Count(d.Text(n), "\n") + 1
+		}
+	}
+	return 0
+}
+
+// NodeAt returns the node whose text covers the 1-based line, or nil if
+// the line is past the end of the document.
+func (d *Document) NodeAt(line int) *Node {
+	start := 1
+	for _, n := range d.Nodes {
+		if n.head() != n {
+			continue
+		}
+		end := start + strings.Count(d.Text(n), "\n")
+		if line >= start && line <= end {
+			return n
+		}
+		start = end + 1
+	}
+	return nil
+}
+
+func (d *Document) indexOf(node *Node) int {
+	for i, n := range d.Nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// Insert places nodes at index i, clamped to the document bounds.
+func (d *Document) Insert(i int, nodes ...*Node) {
+	if i < 0 || i > len(d.Nodes) {
+		i = len(d.Nodes)
+	}
+	d.Nodes = append(d.Nodes[:i], append(nodes, d.Nodes[i:]...)...)
+}
+
+// Remove deletes node. Removing one name from a shared line rewrites the
+// line with the names that remain.
+func (d *Document) Remove(node *Node) {
+	i := d.indexOf(node)
+	if i < 0 {
+		return
+	}
+	d.Nodes = append(d.Nodes[:i], d.Nodes[i+1:]...)
+	if node.group == nil {
+		return
+	}
+
+	head := node.group
+	remaining := []*Node{}
+	for _, member := range head.members {
+		if member != node {
+			member.group = nil
+			member.members = nil
+			member.Lines = nil
+			remaining = append(remaining, member)
+		}
+	}
+	remaining[0].Comment = head.Comment
+	node.group, node.members = nil, nil
+	groupNodes(remaining)
+}
+
+// insertAfter places nodes after node. A blank line separates them from an
+// entry described by comments above it, so the comments keep describing
+// only that entry.
+func (d *Document) insertAfter(node *Node, nodes ...*Node) {
+	group := node.Group()
+	i := d.indexOf(group[len(group)-1]) + 1
+	if len(d.leadingComments(node)) > 0 {
+		nodes = append([]*Node{{Kind: NodeBlank}}, nodes...)
+	}
+	d.Insert(i, nodes...)
+}
+
+// appendSection adds nodes after the last unguarded node of the same kind,
+// or at the end of the document under a header comment when there is none
+// yet.
+func (d *Document) appendSection(header string, nodes ...*Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	existing := []*Node{}
+	for _, node := range d.Find(nodes[0].Kind) {
+		if node.Guard == nil {
+			existing = append(existing, node)
+		}
+	}
+	if len(existing) > 0 {
+		d.insertAfter(existing[len(existing)-1], nodes...)
+		return
+	}
+	section := []*Node{}
+	if len(d.Nodes) > 0 && d.Nodes[len(d.Nodes)-1].Kind != NodeBlank {
+		section = append(section, &Node{Kind: NodeBlank})
+	}
+	section = append(section, &Node{Kind: NodeComment, Value: "# " + header})
+	d.Insert(len(d.Nodes), append(section, nodes...)...)
+}
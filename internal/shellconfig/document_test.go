@@ -0,0 +1,128 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const roundTripContent = `# Path setup
+export GOPATH="$HOME/go"
+source ~/.zsh/env.zsh
+export PATH=$GOPATH/bin:$PATH
+
+alias ll='ls -la'   
+alias gs="git status"
+
+ZSH_THEME="agnoster"
+plugins=(git  docker)
+source $ZSH/oh-my-zsh.sh
+
+hello() {
+    echo "Hello"
+}
+# trailing comment`
+
+func TestParseDocumentRoundTrip(t *testing.T) {
+	for _, content := range []string{roundTripContent, roundTripContent + "\n", "", "\n\n", "export A=1\r\n"} {
+		doc := ParseDocument(content)
+		if got := doc.String(); got != content {
+			t.Errorf("Expected round trip of %q, got %q", content, got)
+		}
+	}
+}
+
+func TestParseDocumentNodes(t *testing.T) {
+	doc := ParseDocument(roundTripContent)
+
+	kinds := map[NodeKind]int{}
+	for _, node := range doc.Nodes {
+		kinds[node.Kind]++
+	}
+	if kinds[NodeExport] != 2 || kinds[NodeAlias] != 2 || kinds[NodeFunction] != 1 {
+		t.Errorf("Unexpected node counts: %v", kinds)
+	}
+
+	functions := doc.Find(NodeFunction)
+	if len(functions) == 1 && (functions[0].Name != "hello" || functions[0].Line != 13) {
+		t.Errorf("Expected hello function at line 13, got %s at %d", functions[0].Name, functions[0].Line)
+	}
+}
+
+func TestSaveUneditedIsByteIdentical(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), ".zshrc")
+	if err := os.WriteFile(testFile, []byte(roundTripContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	config := New()
+	config.FilePath = testFile
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	content, _ := os.ReadFile(testFile)
+	if string(content) != roundTripContent {
+		t.Errorf("Expected unedited save to be byte identical, got:\n%s", content)
+	}
+}
+
+func TestEditRewritesOnlyTouchedLines(t *testing.T) {
+	config := newTestConfig(roundTripContent)
+
+	config.Aliases["gs"] = "git status -sb"
+	delete(config.Exports, "GOPATH")
+	config.Aliases["gd"] = "git diff"
+
+	got := config.Document().String()
+	original := strings.Split(roundTripContent, "\n")
+	expected := append([]string{original[0]}, original[2:6]...)
+	expected = append(expected, "alias gs=\"git status -sb\"", "alias gd='git diff'")
+	expected = append(expected, original[7:]...)
+	if want := strings.Join(expected, "\n"); got != want {
+		t.Errorf("Unexpected document after edit:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNewEntriesGetSection(t *testing.T) {
+	config := newTestConfig("source ~/.profile\n")
+	config.Aliases["ll"] = "ls -la"
+	config.OhMyZshTheme = "robbyrussell"
+
+	got := config.Document().String()
+	want := "source ~/.profile\n\n# Aliases\nalias ll='ls -la'\n\n# Oh My Zsh Configuration\nZSH_THEME=\"robbyrussell\"\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestThemeInsertedBeforeOhMyZshSource(t *testing.T) {
+	config := newTestConfig("export ZSH=~/.oh-my-zsh\nsource $ZSH/oh-my-zsh.sh\n")
+	config.OhMyZshTheme = "agnoster"
+
+	got := config.Document().String()
+	want := "export ZSH=~/.oh-my-zsh\nZSH_THEME=\"agnoster\"\nsource $ZSH/oh-my-zsh.sh\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestThemeQuoted(t *testing.T) {
+	config := newTestConfig("export ZSH=~/.oh-my-zsh\nZSH_THEME=\"agnoster\"\nsource $ZSH/oh-my-zsh.sh\n")
+	config.OhMyZshTheme = `my"theme`
+
+	if got := config.Document().String(); !strings.Contains(got, `ZSH_THEME="my\"theme"`+"\n") {
+		t.Errorf("Expected the quote in the theme escaped, got %q", got)
+	}
+}
+
+func newTestConfig(content string) *Config {
+	config := NewWithDialect(Zsh, filepath.Join(os.TempDir(), ".zshrc"))
+	config.doc = config.Dialect.Parse(content)
+	config.populate()
+	return config
+}
@@ -0,0 +1,117 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dropInFiles names the drop-in file of each kind of entry. The numbers keep
+// the files sourced in an order where exports are set before anything that
+// may use them.
+var dropInFiles = map[NodeKind]string{
+	NodeExport:   "10-exports",
+	NodeAlias:    "20-aliases",
+	NodeVariable: "30-variables",
+	NodeOption:   "40-options",
+	NodeFunction: "50-functions",
+}
+
+// DropInDir returns $XDG_CONFIG_HOME/swiss-linux-knife/<shell>, falling back
+// to ~/.config when XDG_CONFIG_HOME is unset.
+func DropInDir(d Dialect, homeDir string) string {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(config, "swiss-linux-knife", d.Name())
+}
+
+// splitLoader separates text into the lines around the loop sourcing glob
+// and the loop itself. Any loop whose pattern expands to glob counts, so a
+// loader written by hand is not added a second time. A file without one gets
+// a new loader at the end.
+func splitLoader(text string, d Dialect, glob string) (*managedBlock, string) {
+	b := &managedBlock{before: text, glob: glob, dialect: d}
+	homeDir, _ := os.UserHomeDir()
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for _, node := range d.Parse(line).Find(NodeSource) {
+			if node.Keyword == "for" && node.Guard == nil && expandInclude(node.Name, homeDir) == glob {
+				b.before = text[:offset]
+				b.after = text[offset+len(line):]
+				b.found = true
+				return b, line
+			}
+		}
+		offset += len(line)
+	}
+
+	pattern := glob
+	if rel, err := filepath.Rel(homeDir, glob); err == nil && !strings.HasPrefix(rel, "..") {
+		pattern = "$HOME/" + rel
+	}
+	return b, d.FormatSourceLoop(pattern) + "\n"
+}
+
+// dropInGlob returns the pattern matching every drop-in file of the config.
+func (c *Config) dropInGlob() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(DropInDir(c.Dialect, homeDir), "*."+c.Dialect.Name())
+}
+
+// dropInPath returns the drop-in file for entries of kind.
+func (c *Config) dropInPath(kind NodeKind) string {
+	return filepath.Join(filepath.Dir(c.block.glob), dropInFiles[kind]+"."+c.Dialect.Name())
+}
+
+// target returns the document new entries of kind are added to: the kind's
+// drop-in file in WriteDropIn mode, otherwise the root document.
+func (c *Config) target(kind NodeKind) *Document {
+	if c.Mode != WriteDropIn || c.block == nil {
+		return c.doc
+	}
+	return c.dropIn(kind).Doc
+}
+
+// dropIn returns the source of the drop-in file for kind, adding an empty
+// one under the loader when the file does not exist yet.
+func (c *Config) dropIn(kind NodeKind) *Source {
+	root := c.tree()
+	path := c.dropInPath(kind)
+	if src := root.child(path); src != nil {
+		return src
+	}
+	loader := c.doc.Find(NodeSource)[0]
+	src := &Source{Path: path, Line: loader.Line, Parent: root, Doc: c.Dialect.Parse(""), include: loader}
+	root.Children = append(root.Children, src)
+	// The loader sources the files in the order of their names.
+	sort.SliceStable(root.Children, func(i, j int) bool {
+		return root.Children[i].Path < root.Children[j].Path
+	})
+	return src
+}
+
+// appendSection adds new entries of kind under header in the document that
+// target picks. A drop-in file is only created once it has entries.
+func (c *Config) appendSection(kind NodeKind, header string, nodes ...*Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	c.target(kind).appendSection(header, nodes...)
+}
+
+// loadDropIns adds the drop-in files that only exist in texts, which the
+// loader's glob cannot find on disk.
+func (c *Config) loadDropIns(texts map[string]string) {
+	if c.Mode != WriteDropIn || c.block == nil {
+		return
+	}
+	for kind := range dropInFiles {
+		path := c.dropInPath(kind)
+		if text, ok := texts[path]; ok && c.tree().child(path) == nil {
+			c.dropIn(kind).Doc = c.Dialect.Parse(text)
+		}
+	}
+}
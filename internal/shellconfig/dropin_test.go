@@ -0,0 +1,101 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDropInFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	path := filepath.Join(home, ".zshrc")
+	original := "# my setup\n\nalias ll='ls -la'\n"
+	os.WriteFile(path, []byte(original), 0644)
+
+	config := NewForFile(path)
+	config.Mode = WriteDropIn
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if changes := config.Changes(); len(changes) != 0 {
+		t.Fatalf("Expected no loader to be added without entries, got:\n%s", changes[0].Unified())
+	}
+	if unmanaged := config.Unmanaged(); len(unmanaged[NodeAlias]) != 1 {
+		t.Errorf("Expected the alias in the rc file to be listed, got %v", unmanaged)
+	}
+
+	config.Exports["EDITOR"] = "nvim"
+	if err := config.Migrate(NodeAlias, "ll"); err != nil {
+		t.Fatalf("Failed to migrate alias: %v", err)
+	}
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	dir := filepath.Join(home, ".config", "swiss-linux-knife", "zsh")
+	loader := "for f in $HOME/.config/swiss-linux-knife/zsh/*.zsh; do . \"$f\"; done; unset f\n"
+	content, _ := os.ReadFile(path)
+	if string(content) != "# my setup\n\n"+loader {
+		t.Errorf("Expected the alias replaced by the loader, got:\n%s", content)
+	}
+	exports, _ := os.ReadFile(filepath.Join(dir, "10-exports.zsh"))
+	if string(exports) != "# Environment Variables\nexport EDITOR=\"nvim\"\n" {
+		t.Errorf("Expected the export in its own file, got:\n%s", exports)
+	}
+	aliases, _ := os.ReadFile(filepath.Join(dir, "20-aliases.zsh"))
+	if !strings.Contains(string(aliases), "alias ll='ls -la'") {
+		t.Errorf("Expected the migrated alias in its own file, got:\n%s", aliases)
+	}
+
+	config = NewForFile(path)
+	config.Mode = WriteDropIn
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Exports["EDITOR"] != "nvim" || config.Aliases["ll"] != "ls -la" {
+		t.Errorf("Expected the drop-in files to be read back, got %v and %v", config.Exports, config.Aliases)
+	}
+	config.Aliases["gs"] = "git status"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	if strings.Count(string(content), "for f in") != 1 {
+		t.Errorf("Expected exactly one loader line, got:\n%s", content)
+	}
+	if origin, _ := config.Origin(NodeAlias, "gs"); origin.Path != filepath.Join(dir, "20-aliases.zsh") {
+		t.Errorf("Expected the new alias in the aliases file, got %+v", origin)
+	}
+}
+
+func TestDropInLoaderWrittenByHand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	path := filepath.Join(home, ".config", "fish", "config.fish")
+	original := "for file in ~/.config/swiss-linux-knife/fish/*.fish; source $file; end\nset -gx PAGER less\n"
+	writeTestFiles(t, home, map[string]string{
+		".config/fish/config.fish": original,
+	})
+
+	config := NewForFile(path)
+	config.Mode = WriteDropIn
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Aliases["ll"] = "ls -la"
+	changes := config.Changes()
+	if len(changes) != 1 || changes[0].Path != filepath.Join(home, ".config", "swiss-linux-knife", "fish", "20-aliases.fish") {
+		t.Fatalf("Expected only the aliases file to change, got %d changes", len(changes))
+	}
+
+	config.Record("Add alias ll")
+	config.Undo()
+	config.Redo()
+	if config.Aliases["ll"] != "ls -la" {
+		t.Errorf("Expected redo to bring back the alias in a new file, got %v", config.Aliases)
+	}
+}
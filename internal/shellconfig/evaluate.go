@@ -0,0 +1,305 @@
+package shellconfig
+
+import (
+	"context"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// Evaluation is the value a variable ends up with once the shell expands
+// its assignment.
+type Evaluation struct {
+	Value string
+	// Undefined are the variables the value refers to that are not set.
+	Undefined []string
+	// Unevaluated is set when a command substitution was not run. Value
+	// keeps it as written.
+	Unevaluated bool
+	// Conditional is set for an entry under a condition. Value is what it
+	// assigns when the condition holds.
+	Conditional bool
+}
+
+// Suspicious reports whether the value is empty or refers to variables that
+// are not set, which is rarely what was meant.
+func (e Evaluation) Suspicious() bool {
+	return e.Value == "" || len(e.Undefined) > 0
+}
+
+// Evaluator expands the exports and variables of a config in the order the
+// shell assigns them, starting from the environment of this process.
+type Evaluator struct {
+	// RunCommands runs command substitutions in the config's shell. They
+	// can have side effects, so they are left as written unless set.
+	RunCommands bool
+	// outputs caches the output of each command that ran, keyed by the
+	// command and the environment it ran in, so evaluating again after an
+	// edit only runs the commands the edit affects. mu guards it, since
+	// Run may be called from a background goroutine.
+	mu      sync.Mutex
+	outputs map[string]string
+}
+
+// Evaluations are the values of the variables of a config.
+type Evaluations struct {
+	// Values holds the variables assigned outside a condition.
+	Values map[string]Evaluation
+	// Guarded holds what each conditional entry assigns when its condition
+	// holds, given the assignments before it.
+	Guarded map[*GuardedEntry]Evaluation
+}
+
+// Reset forgets the output of the commands that ran, so that they run again
+// on the next Evaluate.
+func (e *Evaluator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.outputs = nil
+}
+
+// Evaluate returns the value of every variable the config assigns. Whether
+// an assignment under a condition runs is only known in the shell, so it is
+// evaluated on its own and later assignments do not see its value.
+func (e *Evaluator) Evaluate(c *Config) *Evaluations {
+	return e.Assignments(c).Run()
+}
+
+// Assignments are the exports and variables of a config in the order the
+// shell assigns them.
+type Assignments struct {
+	evaluator   *Evaluator
+	runCommands bool
+	shell       string
+	steps       []assignment
+}
+
+// assignment is one step of Assignments. entry is set for an assignment
+// under a condition.
+type assignment struct {
+	name, value string
+	entry       *GuardedEntry
+}
+
+// Assignments collects what Evaluate expands. Run then needs nothing from
+// the config, so it can be called while the config is edited.
+func (e *Evaluator) Assignments(c *Config) *Assignments {
+	c.sync()
+	entries := make(map[*Node]*GuardedEntry)
+	for _, entry := range c.Guarded {
+		entries[entry.node] = entry
+	}
+	a := &Assignments{evaluator: e, runCommands: e.RunCommands, shell: c.Dialect.Name()}
+	c.tree().walk(func(src *Source, node *Node) {
+		if node.Kind != NodeExport && node.Kind != NodeVariable {
+			return
+		}
+		if (nodeRef{src, node}).guard() != nil {
+			if entry, ok := entries[node]; ok {
+				a.steps = append(a.steps, assignment{name: node.Name, value: node.Value, entry: entry})
+			}
+			return
+		}
+		a.steps = append(a.steps, assignment{name: node.Name, value: node.Value})
+	})
+	return a
+}
+
+// Run expands the assignments, starting from the environment of this
+// process. Command substitutions can take up to the preview timeout each.
+func (a *Assignments) Run() *Evaluations {
+	env := make(map[string]string)
+	for _, pair := range os.Environ() {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			env[name] = value
+		}
+	}
+	if _, ok := env["HOME"]; !ok {
+		env["HOME"], _ = os.UserHomeDir()
+	}
+
+	results := &Evaluations{Values: make(map[string]Evaluation), Guarded: make(map[*GuardedEntry]Evaluation)}
+	for _, step := range a.steps {
+		if step.entry != nil {
+			x := &expander{env: maps.Clone(env), assignments: a}
+			value := x.expand(step.value)
+			results.Guarded[step.entry] = Evaluation{Value: value, Undefined: x.undefined, Unevaluated: x.unevaluated, Conditional: true}
+			continue
+		}
+		x := &expander{env: env, assignments: a}
+		value := x.expand(step.value)
+		env[step.name] = value
+		results.Values[step.name] = Evaluation{Value: value, Undefined: x.undefined, Unevaluated: x.unevaluated}
+	}
+	return results
+}
+
+// expander expands one value written in the form values are edited in: as
+// between double quotes, with ~ expanded at the start and after each colon.
+type expander struct {
+	env         map[string]string
+	assignments *Assignments
+	undefined   []string
+	unevaluated bool
+}
+
+func (x *expander) expand(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value) && strings.IndexByte("$`\\\"", value[i+1]) >= 0:
+			i++
+			sb.WriteByte(value[i])
+		case c == '~' && (i == 0 || value[i-1] == ':') && (i+1 == len(value) || value[i+1] == '/' || value[i+1] == ':'):
+			sb.WriteString(x.lookup("HOME"))
+		case c == '`' || (c == '$' && i+1 < len(value) && (value[i+1] == '(' || value[i+1] == '{')):
+			end, err := skipExpansion(value, i)
+			if err != nil {
+				sb.WriteString(value[i:])
+				return sb.String()
+			}
+			sb.WriteString(x.expansion(value[i:end]))
+			i = end - 1
+		case c == '$' && i+1 < len(value) && isWordChar(value[i+1]) && !isDigit(value[i+1]):
+			end := i + 1
+			for end < len(value) && isWordChar(value[end]) {
+				end++
+			}
+			sb.WriteString(x.lookup(value[i+1 : end]))
+			i = end - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// expansion expands a ${...}, $(...) or `...` expansion. Arithmetic and
+// forms other than the common parameter expansions are kept as written.
+func (x *expander) expansion(text string) string {
+	switch {
+	case strings.HasPrefix(text, "$(("):
+		return text
+	case strings.HasPrefix(text, "$("):
+		return x.command(text, text[2:len(text)-1])
+	case strings.HasPrefix(text, "`"):
+		return x.command(text, text[1:len(text)-1])
+	}
+
+	inner := text[2 : len(text)-1]
+	if strings.HasPrefix(inner, "#") && identifierRegex.MatchString(inner[1:]) {
+		return strconv.Itoa(len(x.lookup(inner[1:])))
+	}
+	end := 0
+	for end < len(inner) && isWordChar(inner[end]) {
+		end++
+	}
+	name, op := inner[:end], inner[end:]
+	if !identifierRegex.MatchString(name) {
+		return text
+	}
+	if op == "" {
+		return x.lookup(name)
+	}
+
+	value, set := x.env[name]
+	colon := strings.HasPrefix(op, ":")
+	op = strings.TrimPrefix(op, ":")
+	if op == "" {
+		return text
+	}
+	word := op[1:]
+	// With a colon, an empty value counts as unset.
+	missing := !set || (colon && value == "")
+	switch op[0] {
+	case '-':
+		if missing {
+			return x.expand(word)
+		}
+	case '=':
+		if missing {
+			value = x.expand(word)
+			x.env[name] = value
+		}
+	case '+':
+		if missing {
+			return ""
+		}
+		return x.expand(word)
+	case '?':
+		if missing {
+			x.undefined = append(x.undefined, name)
+		}
+	default:
+		return text
+	}
+	return value
+}
+
+// lookup returns the value of a variable, noting it when it is not set.
+func (x *expander) lookup(name string) string {
+	value, ok := x.env[name]
+	if !ok && !slices.Contains(x.undefined, name) {
+		x.undefined = append(x.undefined, name)
+	}
+	return value
+}
+
+// command returns the output of a command substitution, or text as written
+// when commands may not run.
+func (x *expander) command(text, script string) string {
+	if !x.assignments.runCommands {
+		x.unevaluated = true
+		return text
+	}
+	environ := []string{}
+	for name, value := range x.env {
+		environ = append(environ, name+"="+value)
+	}
+	sort.Strings(environ)
+	key := script + "\x00" + strings.Join(environ, "\x00")
+	e := x.assignments.evaluator
+	e.mu.Lock()
+	if e.outputs == nil {
+		e.outputs = make(map[string]string)
+	}
+	// A Reset while the command runs replaces the map, so its output is
+	// not kept.
+	outputs := e.outputs
+	output, ok := outputs[key]
+	e.mu.Unlock()
+	if ok {
+		return output
+	}
+	path, err := exec.LookPath(x.assignments.shell)
+	if err != nil {
+		x.unevaluated = true
+		return text
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "-c", script)
+	cmd.Env = environ
+	out, err := cmd.Output()
+	if err != nil {
+		logger.Warn("Command substitution %s failed: %v", text, err)
+	}
+	output = strings.TrimRight(string(out), "\n")
+	e.mu.Lock()
+	outputs[key] = output
+	e.mu.Unlock()
+	return output
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
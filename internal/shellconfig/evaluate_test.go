@@ -0,0 +1,121 @@
+package shellconfig
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	os.Unsetenv("XDG_CONFIG_HOME")
+	os.Unsetenv("SLK_UNSET_FOR_TEST")
+	path := filepath.Join(home, ".bashrc")
+	content := `export APP_DIR="${XDG_CONFIG_HOME:-$HOME/.config}/app"
+export GOPATH=~/go
+export GOBIN="$GOPATH/bin"
+export LITERAL='$HOME stays'
+export BROKEN="$SLK_UNSET_FOR_TEST/bin"
+export EMPTY=""
+export BUILT="$(echo built)"
+export LENGTH="${#GOPATH}"
+`
+	os.WriteFile(path, []byte(content), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	evaluator := &Evaluator{}
+	results := evaluator.Evaluate(config).Values
+	expected := map[string]string{
+		"APP_DIR": home + "/.config/app",
+		"GOPATH":  home + "/go",
+		"GOBIN":   home + "/go/bin",
+		"LITERAL": "$HOME stays",
+		"BROKEN":  "/bin",
+		"EMPTY":   "",
+		"BUILT":   "$(echo built)",
+	}
+	for name, value := range expected {
+		if results[name].Value != value {
+			t.Errorf("Expected %s to evaluate to %q, got %q", name, value, results[name].Value)
+		}
+	}
+	if !slices.Equal(results["BROKEN"].Undefined, []string{"SLK_UNSET_FOR_TEST"}) || !results["BROKEN"].Suspicious() {
+		t.Errorf("Expected BROKEN to refer to an undefined variable, got %+v", results["BROKEN"])
+	}
+	if !results["EMPTY"].Suspicious() || results["GOBIN"].Suspicious() || results["APP_DIR"].Suspicious() {
+		t.Errorf("Expected only empty and undefined values to be suspicious, got %+v", results)
+	}
+	if !results["BUILT"].Unevaluated {
+		t.Errorf("Expected the command substitution not to run without opt-in")
+	}
+	if results["LENGTH"].Value != strconv.Itoa(len(home+"/go")) {
+		t.Errorf("Expected the length of GOPATH, got %q", results["LENGTH"].Value)
+	}
+
+	if _, err := exec.LookPath("bash"); err == nil {
+		evaluator.RunCommands = true
+		if result := evaluator.Evaluate(config).Values["BUILT"]; result.Value != "built" || result.Unevaluated {
+			t.Errorf("Expected the command substitution to run, got %+v", result)
+		}
+	}
+}
+
+func TestEvaluateGuarded(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	config := newTestConfig("export GOPATH=~/go\nif [ -d /opt/go ]; then\n    export GOPATH=/opt/go\n    export GOBIN=\"$GOPATH/bin\"\nfi\nexport GOROOT=\"$GOPATH/root\"\n")
+
+	results := (&Evaluator{}).Evaluate(config)
+	if got := results.Guarded[config.Guarded[1]]; got.Value != "/home/test/go/bin" || !got.Conditional {
+		t.Errorf("Expected the conditional GOBIN to be evaluated, got %+v", got)
+	}
+	if got := results.Values["GOROOT"]; got.Value != "/home/test/go/root" || got.Conditional {
+		t.Errorf("Expected GOROOT not to see the conditional GOPATH, got %+v", got)
+	}
+}
+
+func TestEvaluateRunsCommandsAgain(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	stamp := filepath.Join(home, "stamp")
+	os.WriteFile(stamp, []byte("one"), 0644)
+	config := NewWithDialect(Bash, filepath.Join(home, ".bashrc"))
+	config.doc = config.Dialect.Parse("export STAMP=\"$(cat ~/stamp)\"\nexport NAME=a\nexport GREETING=\"$(echo hi $NAME)\"\n")
+	config.populate()
+
+	evaluator := &Evaluator{RunCommands: true}
+	evaluator.Evaluate(config)
+	config.Exports["NAME"] = "b"
+	os.WriteFile(stamp, []byte("two"), 0644)
+	results := evaluator.Evaluate(config).Values
+	if results["GREETING"].Value != "hi b" {
+		t.Errorf("Expected the command to run again after NAME changed, got %q", results["GREETING"].Value)
+	}
+	if results["STAMP"].Value != "one" {
+		t.Errorf("Expected the cached output until reset, got %q", results["STAMP"].Value)
+	}
+	evaluator.Reset()
+	if got := evaluator.Evaluate(config).Values["STAMP"].Value; got != "two" {
+		t.Errorf("Expected the command to run again after Reset, got %q", got)
+	}
+}
+
+func TestAssignmentsRunAfterEdit(t *testing.T) {
+	config := newTestConfig("export BASE=/opt\nexport TOOL=\"$BASE/tool\"\n")
+
+	assignments := (&Evaluator{}).Assignments(config)
+	config.Exports["BASE"] = "/usr"
+	if got := assignments.Run().Values["TOOL"].Value; got != "/opt/tool" {
+		t.Errorf("Expected the config as collected to be evaluated, got %q", got)
+	}
+}
@@ -0,0 +1,178 @@
+package shellconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btassone/swiss-linux-knife/internal/diff"
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher reports writes other programs make to the files of a config.
+type Watcher struct {
+	watcher *fsnotify.Watcher
+}
+
+// Watch watches the root file and every sourced file. onChange is called
+// from a background goroutine with the path of each file written, replaced
+// or removed. Saves made through the config trigger it too, so callers should
+// confirm with ExternalChanges on their own goroutine.
+//
+// Directories are watched rather than files, since editors such as vim
+// replace a file by renaming a new one over it.
+func (c *Config) Watch(onChange func(path string)) (*Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	files := make(map[string]string)
+	dirs := make(map[string]bool)
+	for _, src := range c.tree().Files() {
+		files[filepath.Clean(src.Path)] = src.Path
+		dirs[filepath.Dir(src.Path)] = true
+		if resolved, err := filepath.EvalSymlinks(src.Path); err == nil {
+			files[resolved] = src.Path
+			dirs[filepath.Dir(resolved)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			logger.Warn("Failed to watch %s: %v", dir, err)
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				path, watched := files[filepath.Clean(event.Name)]
+				if watched && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+					onChange(path)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("File watcher error: %v", err)
+			}
+		}
+	}()
+	return &Watcher{watcher: w}, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+// ExternalChanges returns the files whose content on disk no longer matches
+// what was loaded or last saved.
+func (c *Config) ExternalChanges() []string {
+	changed := []string{}
+	for _, src := range c.tree().Files() {
+		content, err := os.ReadFile(src.Path)
+		if err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		if string(content) != src.original {
+			changed = append(changed, src.Path)
+		}
+	}
+	return changed
+}
+
+// Modified reports whether the config has edits that have not been saved.
+func (c *Config) Modified() bool {
+	for _, src := range c.Sources().Files() {
+		if src.Modified() {
+			return true
+		}
+	}
+	_, files := c.splitFunctions()
+	if len(files) != len(c.functionFiles) {
+		return true
+	}
+	for name, text := range files {
+		if c.functionFiles[name] != text {
+			return true
+		}
+	}
+	return false
+}
+
+// source returns the file of the include tree at path.
+func (c *Config) source(path string) *Source {
+	for _, src := range c.Sources().Files() {
+		if src.Path == path {
+			return src
+		}
+	}
+	return nil
+}
+
+// Overwrite takes the current content of path on disk as the base for its
+// unsaved edits, so the next save replaces the external changes.
+func (c *Config) Overwrite(path string) error {
+	src := c.source(path)
+	if src == nil {
+		return fmt.Errorf("%s is not part of the config", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	src.original = string(content)
+	return nil
+}
+
+// Merge three-way merges the unsaved edits to path with the changes made to
+// it on disk, using the content read at Load as the common base. It returns
+// the merged text and the number of conflicts, which are written between the
+// diff package's conflict markers.
+func (c *Config) Merge(path string) (string, int, error) {
+	src := c.source(path)
+	if src == nil {
+		return "", 0, fmt.Errorf("%s is not part of the config", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	merged, conflicts := diff.Merge(src.original, src.Text(), string(content))
+	return merged, conflicts, nil
+}
+
+// ApplyMerge replaces the unsaved content of path with text, typically the
+// result of Merge, and rereads the config with the file on disk as the new
+// base. Unsaved edits to the other files are kept; those to fish function
+// files are not. The undo history starts over from the merged config.
+func (c *Config) ApplyMerge(path, text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		if line == diff.MarkerOurs || line == diff.MarkerSep || line == diff.MarkerTheirs {
+			return fmt.Errorf("resolve the conflicts in %s first", path)
+		}
+	}
+	texts := make(map[string]string)
+	bases := make(map[string]string)
+	for _, src := range c.Sources().Files() {
+		if src.Modified() && src.Path != path {
+			texts[src.Path] = src.Text()
+			bases[src.Path] = src.original
+		}
+	}
+	texts[path] = text
+	// Other edited files keep their base, so changes made to them on disk
+	// can still be merged.
+	if err := c.reparse(texts, bases); err != nil {
+		return err
+	}
+	c.resetHistory()
+	return nil
+}
@@ -0,0 +1,86 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeExternalEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	original := "export EDITOR=vim\n\nalias ll='ls -la'\nalias gs='git status'\n\nexport PAGER=less\n"
+	os.WriteFile(path, []byte(original), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Modified() || len(config.ExternalChanges()) != 0 {
+		t.Fatal("Expected a freshly loaded config to be unmodified")
+	}
+
+	config.Exports["EDITOR"] = "nvim"
+	external := strings.Replace(original, "export PAGER=less\n", "export PAGER=most\n", 1)
+	os.WriteFile(path, []byte(external), 0644)
+
+	if changed := config.ExternalChanges(); len(changed) != 1 || changed[0] != path {
+		t.Fatalf("Expected %s to be reported as changed, got %v", path, changed)
+	}
+	merged, conflicts, err := config.Merge(path)
+	if err != nil || conflicts != 0 {
+		t.Fatalf("Expected a clean merge, got %d conflicts (%v):\n%s", conflicts, err, merged)
+	}
+	if err := config.ApplyMerge(path, merged); err != nil {
+		t.Fatalf("Failed to apply merge: %v", err)
+	}
+	if config.Exports["EDITOR"] != "nvim" || config.Exports["PAGER"] != "most" {
+		t.Errorf("Expected both edits after merging, got %v", config.Exports)
+	}
+	if len(config.ExternalChanges()) != 0 || !config.Modified() {
+		t.Error("Expected the merge to leave only our edit pending")
+	}
+	if changes := config.Changes(); len(changes) != 1 || len(changes[0].Diff.Hunks) != 1 {
+		t.Errorf("Expected one pending hunk, got %d changes", len(changes))
+	}
+
+	os.WriteFile(path, []byte(strings.Replace(external, "EDITOR=vim", "EDITOR=emacs", 1)), 0644)
+	merged, conflicts, _ = config.Merge(path)
+	if conflicts != 1 {
+		t.Errorf("Expected a conflict on EDITOR, got %d:\n%s", conflicts, merged)
+	}
+	if err := config.ApplyMerge(path, merged); err == nil {
+		t.Error("Expected unresolved conflicts to be refused")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".bashrc")
+	os.WriteFile(path, []byte("alias ll='ls -la'\n"), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	changed := make(chan string, 10)
+	watcher, err := config.Watch(func(p string) { changed <- p })
+	if err != nil {
+		t.Fatalf("Failed to watch config: %v", err)
+	}
+	defer watcher.Close()
+
+	// Replace the file the way editors do, by renaming a new file over it.
+	os.WriteFile(filepath.Join(dir, "unrelated"), []byte("x"), 0644)
+	os.WriteFile(path+".swp", []byte("alias ll='ls -l'\n"), 0644)
+	os.Rename(path+".swp", path)
+
+	select {
+	case p := <-changed:
+		if p != path {
+			t.Errorf("Expected a change to %s, got %s", path, p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected a change notification")
+	}
+}
@@ -0,0 +1,437 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// fishDialect handles config.fish and conf.d snippets. Fish keeps most
+// functions in files of their own, which Config reads through FunctionDir.
+type fishDialect struct{}
+
+var Fish Dialect = &fishDialect{}
+
+var (
+	fishFunctionStartRegex = regexp.MustCompile(`^\s*function\s+([^\s;]+)`)
+	fishBlockStartRegex    = regexp.MustCompile(`^\s*(function|if|for|while|switch|begin)\b`)
+	fishBlockEndRegex      = regexp.MustCompile(`^\s*end\b`)
+	fishSafeWordRegex      = regexp.MustCompile(`^[\w/.~$:@%+=,-]+$`)
+	positionalRegex        = regexp.MustCompile(`\$(\d)`)
+	fishSourceLoopRegex    = regexp.MustCompile(`^\s*for\s+(\w+)\s+in\s+([^\s;'"]+)\s*;\s*(?:source|\.)\s+"?\$(\w+)"?\s*;\s*end\s*$`)
+)
+
+func (d *fishDialect) Name() string {
+	return "fish"
+}
+
+func fishConfigDir(homeDir string) string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "fish")
+	}
+	return filepath.Join(homeDir, ".config", "fish")
+}
+
+func (d *fishDialect) ConfigFiles(homeDir string) []string {
+	dir := fishConfigDir(homeDir)
+	files := []string{filepath.Join(dir, "config.fish")}
+	snippets, _ := filepath.Glob(filepath.Join(dir, "conf.d", "*.fish"))
+	sort.Strings(snippets)
+	return append(files, snippets...)
+}
+
+func (d *fishDialect) Matches(path string) bool {
+	return filepath.Ext(path) == ".fish"
+}
+
+// FunctionDir returns the autoload directory for functions belonging to the
+// config file at path.
+func (d *fishDialect) FunctionDir(path string) string {
+	dir := filepath.Dir(path)
+	if filepath.Base(dir) == "conf.d" {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Join(dir, "functions")
+}
+
+func (d *fishDialect) Supports(kind NodeKind) bool {
+	switch kind {
+	case NodeTheme, NodePlugins, NodeOption:
+		return false
+	}
+	return true
+}
+
+func (d *fishDialect) Parse(content string) *Document {
+	doc := &Document{TrailingNewline: true, dialect: d}
+	if content == "" {
+		return doc
+	}
+	doc.TrailingNewline = strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var function *Node
+	depth := 0
+	blocks := &blockTracker{doc: doc}
+	for i, line := range lines {
+		if function != nil {
+			function.Lines = append(function.Lines, line)
+			opens := fishBlockStartRegex.MatchString(line)
+			closes := fishBlockEndRegex.MatchString(line) || fishBlockEndRegex.MatchString(lastCommand(line))
+			if opens && !closes {
+				depth++
+			} else if closes && !opens {
+				depth--
+			}
+			if depth == 0 {
+				function.Value = strings.Join(function.Lines, "\n")
+				function = nil
+			}
+			continue
+		}
+
+		node := &Node{Kind: NodeRaw, Line: i + 1, Lines: []string{line}, Value: line}
+		trimmedLine := strings.TrimSpace(line)
+
+		if trimmedLine == "" {
+			node.Kind = NodeBlank
+		} else if strings.HasPrefix(trimmedLine, "#") {
+			node.Kind = NodeComment
+		} else if matches := fishFunctionStartRegex.FindStringSubmatch(line); matches != nil {
+			node.Kind = NodeFunction
+			node.Name = matches[1]
+			function = node
+			depth = 1
+			if fishBlockEndRegex.MatchString(lastCommand(line)) {
+				function.Value = line
+				function = nil
+			}
+		} else if matches := fishSourceLoopRegex.FindStringSubmatch(line); matches != nil && matches[1] == matches[3] {
+			node.Kind = NodeSource
+			node.Keyword = "for"
+			node.Name = matches[2]
+		} else if parseFishCommand(node, trimmedLine); node.Kind == NodeRaw {
+			if condition, command, ok := splitGuard(trimmedLine); ok {
+				if parseFishCommand(node, command); node.Kind != NodeRaw {
+					guardInline([]*Node{node}, condition, blocks.current(), doc)
+				}
+			}
+		}
+		if node.Kind == NodeAlias || node.Kind == NodeExport || node.Kind == NodeVariable {
+			node.Indent = indentOf(line)
+			node.Comment = fishComment(trimmedLine)
+		}
+		blocks.tag(node)
+		if node.Kind == NodeRaw {
+			blocks.fishLine(node)
+		}
+		doc.Nodes = append(doc.Nodes, node)
+	}
+
+	if function != nil {
+		function.Value = strings.Join(function.Lines, "\n")
+	}
+	return doc
+}
+
+// parseFishCommand sets the kind, name and value of node from a command
+// line, leaving it raw if the command is not one the views understand.
+func parseFishCommand(node *Node, line string) {
+	words := fishWords(line)
+	switch {
+	case (words[0] == "source" || words[0] == ".") && len(words) == 2:
+		node.Kind = NodeSource
+		node.Keyword = words[0]
+		node.Name = words[1]
+	case words[0] == "set":
+		parseFishSet(node, words[1:])
+	case words[0] == "fish_add_path":
+		parseFishAddPath(node, words[1:])
+	case words[0] == "alias":
+		parseFishAlias(node, words[1:])
+	case words[0] == "abbr":
+		parseFishAbbr(node, words[1:])
+	}
+}
+
+// lastCommand returns the text after the final ';' so that one-line
+// functions such as "function ll; ls -l $argv; end" are recognised.
+func lastCommand(line string) string {
+	if i := strings.LastIndex(line, ";"); i >= 0 {
+		return line[i+1:]
+	}
+	return ""
+}
+
+func parseFishSet(node *Node, args []string) {
+	scope, exported := "", false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flag := args[0]
+		args = args[1:]
+		switch flag {
+		case "--global":
+			scope = "g"
+		case "--universal":
+			scope = "U"
+		case "--export":
+			exported = true
+		case "--erase", "--query", "--local", "--function", "--unexport", "-e", "-q", "-l", "-f", "-u":
+			return
+		default:
+			if strings.HasPrefix(flag, "--") {
+				continue
+			}
+			if strings.ContainsAny(flag, "eqlfu") {
+				return
+			}
+			if strings.Contains(flag, "x") {
+				exported = true
+			}
+			if strings.Contains(flag, "U") {
+				scope = "U"
+			} else if strings.Contains(flag, "g") {
+				scope = "g"
+			}
+		}
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	node.Name = args[0]
+	node.Value = fishJoin(node.Name, args[1:])
+	node.Keyword = "set -" + scope
+	if exported {
+		node.Kind = NodeExport
+		node.Keyword += "x"
+	} else {
+		node.Kind = NodeVariable
+	}
+	if node.Keyword == "set -" {
+		node.Keyword = "set"
+	}
+}
+
+// parseFishAddPath maps fish_add_path onto a PATH export so the Path tab
+// can show it alongside PATH set with set -gx.
+func parseFishAddPath(node *Node, args []string) {
+	appendPaths := false
+	dirs := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "-a" || arg == "--append":
+			appendPaths = true
+		case strings.HasPrefix(arg, "-"):
+			if arg != "-p" && arg != "--prepend" && arg != "-g" && arg != "--global" && arg != "-U" && arg != "--universal" {
+				return
+			}
+		default:
+			dirs = append(dirs, arg)
+		}
+	}
+	if len(dirs) == 0 {
+		return
+	}
+	node.Kind = NodeExport
+	node.Name = "PATH"
+	node.Keyword = "fish_add_path"
+	if appendPaths {
+		node.Keyword = "fish_add_path --append"
+		node.Value = strings.Join(append([]string{"$PATH"}, dirs...), ":")
+	} else {
+		node.Value = strings.Join(append(dirs, "$PATH"), ":")
+	}
+}
+
+func parseFishAlias(node *Node, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	if name, value, ok := strings.Cut(args[0], "="); ok && len(args) == 1 {
+		node.Kind = NodeAlias
+		node.Name, node.Value = name, value
+		return
+	}
+	if len(args) == 2 {
+		node.Kind = NodeAlias
+		node.Name, node.Value = args[0], args[1]
+	}
+}
+
+func parseFishAbbr(node *Node, args []string) {
+	keyword := []string{"abbr"}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-a", "--add", "-g", "--global", "-U", "--universal":
+			keyword = append(keyword, args[0])
+			args = args[1:]
+		default:
+			// Regex, function and positional abbreviations have no alias
+			// equivalent and stay raw.
+			return
+		}
+	}
+	if len(args) < 2 {
+		return
+	}
+	node.Kind = NodeAlias
+	node.Keyword = strings.Join(keyword, " ")
+	node.Name = args[0]
+	node.Value = strings.Join(args[1:], " ")
+}
+
+// fishJoin turns a fish list into the single string the typed views use:
+// path-like variables join with ':' as they would in the environment.
+func fishJoin(name string, values []string) string {
+	if strings.HasSuffix(name, "PATH") {
+		return strings.Join(values, ":")
+	}
+	return strings.Join(values, " ")
+}
+
+// fishComment returns the trailing comment of a command line, if any.
+func fishComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && i > 0 && (line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[i:]
+		}
+	}
+	return ""
+}
+
+func (d *fishDialect) Render(node *Node) string {
+	line := d.renderCommand(node)
+	if node.Comment != "" {
+		line += " " + node.Comment
+	}
+	return line
+}
+
+func (d *fishDialect) renderCommand(node *Node) string {
+	switch node.Kind {
+	case NodeAlias:
+		if strings.HasPrefix(node.Keyword, "abbr") {
+			return node.Keyword + " " + fishQuote(node.Name) + " " + fishQuote(node.Value)
+		}
+		return "alias " + fishQuote(node.Name) + " " + fishQuote(node.Value)
+	case NodeExport, NodeVariable:
+		if strings.HasPrefix(node.Keyword, "fish_add_path") {
+			words := []string{node.Keyword}
+			for _, dir := range strings.Split(node.Value, ":") {
+				if dir != "$PATH" && dir != "" {
+					words = append(words, fishQuote(dir))
+				}
+			}
+			return strings.Join(words, " ")
+		}
+		keyword := node.Keyword
+		if keyword == "" {
+			keyword = "set -g"
+			if node.Kind == NodeExport {
+				keyword = "set -gx"
+			}
+		}
+		words := []string{keyword, node.Name}
+		if strings.HasSuffix(node.Name, "PATH") {
+			for _, value := range strings.Split(node.Value, ":") {
+				if value != "" {
+					words = append(words, fishQuote(value))
+				}
+			}
+		} else if node.Value != "" {
+			words = append(words, fishQuote(node.Value))
+		}
+		return strings.Join(words, " ")
+	}
+	return node.Value
+}
+
+// fishQuote leaves simple words bare, double-quotes words that reference
+// variables so they still expand, and single-quotes anything else.
+func fishQuote(word string) string {
+	if fishSafeWordRegex.MatchString(word) {
+		return word
+	}
+	word = strings.ReplaceAll(word, `\`, `\\`)
+	if strings.Contains(word, "$") {
+		return `"` + strings.ReplaceAll(word, `"`, `\"`) + `"`
+	}
+	return "'" + strings.ReplaceAll(word, `'`, `\'`) + "'"
+}
+
+// fishWords splits a command line into words, removing quotes and stopping
+// at a comment or the first ';'.
+func fishWords(line string) []string {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && (quote != '\'' || runes[i+1] == '\'' || runes[i+1] == '\\'):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case (r == '#' && !inWord) || r == ';':
+			i = len(runes)
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return []string{""}
+	}
+	return words
+}
+
+func (d *fishDialect) FormatSourceLoop(glob string) string {
+	return "for f in " + glob + "; source $f; end"
+}
+
+func (d *fishDialect) FormatGuard(condition string) (string, string) {
+	return "if " + condition, "end"
+}
+
+// FormatFunction translates $1 and $@ to fish's $argv list.
+func (d *fishDialect) FormatFunction(name string, body []string) string {
+	lines := []string{"function " + name}
+	for _, line := range body {
+		line = positionalRegex.ReplaceAllString(line, "$$argv[$1]")
+		line = strings.ReplaceAll(line, "$@", "$argv")
+		lines = append(lines, "    "+line)
+	}
+	return strings.Join(append(lines, "end"), "\n")
+}
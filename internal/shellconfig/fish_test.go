@@ -0,0 +1,142 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fishContent = `# config.fish
+set -gx EDITOR nvim
+set -Ux GOPATH $HOME/go
+set -gx PATH $HOME/bin /opt/tools/bin $PATH
+set -g fish_greeting ''
+fish_add_path ~/.cargo/bin
+alias ll 'ls -la'
+alias gs='git status'
+abbr -a gco git checkout
+abbr --add -r 'regex' foo
+
+function greet --description 'Say hi'
+    if test -n "$argv[1]"
+        echo "Hi $argv[1]"
+    end
+end
+function ll2; ls -l $argv; end
+`
+
+func TestFishParse(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "fish", "config.fish")
+	functionsDir := filepath.Join(dir, "fish", "functions")
+	if err := os.MkdirAll(functionsDir, 0755); err != nil {
+		t.Fatalf("Failed to create functions dir: %v", err)
+	}
+	if err := os.WriteFile(configFile, []byte(fishContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	mkcd := "function mkcd\n    mkdir -p $argv[1]; and cd $argv[1]\nend"
+	if err := os.WriteFile(filepath.Join(functionsDir, "mkcd.fish"), []byte(mkcd+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create function file: %v", err)
+	}
+
+	config := NewForFile(configFile)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Dialect != Fish {
+		t.Fatalf("Expected fish dialect, got %s", config.Dialect.Name())
+	}
+	if config.Exports["EDITOR"] != "nvim" || config.Exports["GOPATH"] != "$HOME/go" {
+		t.Errorf("Unexpected exports: %v", config.Exports)
+	}
+	if _, ok := config.Variables["fish_greeting"]; !ok {
+		t.Error("Expected fish_greeting variable")
+	}
+	if config.Aliases["ll"] != "ls -la" || config.Aliases["gs"] != "git status" || config.Aliases["gco"] != "git checkout" {
+		t.Errorf("Unexpected aliases: %v", config.Aliases)
+	}
+	if _, ok := config.Aliases["foo"]; ok {
+		t.Error("Expected regex abbreviation to stay raw")
+	}
+
+	names := []string{}
+	for _, text := range config.CustomFunctions {
+		names = append(names, FunctionName(text))
+	}
+	if strings.Join(names, ",") != "greet,ll2,mkcd" {
+		t.Errorf("Expected greet, ll2 and mkcd functions, got %v", names)
+	}
+
+	if got := config.Document().String(); got != fishContent {
+		t.Errorf("Expected unedited fish document to round trip, got:\n%s", got)
+	}
+}
+
+func TestFishPathViews(t *testing.T) {
+	doc := Fish.Parse("set -gx PATH $HOME/bin /opt/tools/bin $PATH\nfish_add_path --append ~/.cargo/bin\n")
+	exports := doc.Find(NodeExport)
+	if len(exports) != 2 {
+		t.Fatalf("Expected 2 PATH nodes, got %d", len(exports))
+	}
+	if exports[0].Value != "$HOME/bin:/opt/tools/bin:$PATH" {
+		t.Errorf("Unexpected PATH value %q", exports[0].Value)
+	}
+	if exports[1].Value != "$PATH:~/.cargo/bin" {
+		t.Errorf("Unexpected fish_add_path value %q", exports[1].Value)
+	}
+
+	exports[0].set("/usr/local/bin:$HOME/my bin:$PATH")
+	exports[1].set("$PATH:~/.cargo/bin:~/go/bin")
+	want := "set -gx PATH /usr/local/bin \"$HOME/my bin\" $PATH\nfish_add_path --append ~/.cargo/bin ~/go/bin\n"
+	if got := doc.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestFishSaveFunctionFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.fish")
+	if err := os.WriteFile(configFile, []byte("set -gx EDITOR vim\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	config := NewForFile(configFile)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Aliases["ll"] = "ls -la"
+	config.CustomFunctions = append(config.CustomFunctions, Fish.FormatFunction("mkcd", []string{"mkdir -p \"$1\"; and cd \"$1\""}))
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	content, _ := os.ReadFile(configFile)
+	if string(content) != "set -gx EDITOR vim\n\n# Aliases\nalias ll 'ls -la'\n" {
+		t.Errorf("Unexpected config.fish:\n%s", content)
+	}
+	function, err := os.ReadFile(filepath.Join(dir, "functions", "mkcd.fish"))
+	if err != nil {
+		t.Fatalf("Expected function file to be written: %v", err)
+	}
+	if !strings.Contains(string(function), `mkdir -p "$argv[1]"`) {
+		t.Errorf("Expected fish positional arguments, got:\n%s", function)
+	}
+
+	config.CustomFunctions = []string{}
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "functions", "mkcd.fish")); !os.IsNotExist(err) {
+		t.Error("Expected function file to be removed")
+	}
+	snapshots, err := config.Backups.List(filepath.Join(dir, "functions", "mkcd.fish"))
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Expected the removed function file to be snapshotted, got %d (%v)", len(snapshots), err)
+	}
+	if content, _ := snapshots[0].Content(); content != string(function) {
+		t.Errorf("Expected the snapshot to hold the function file, got:\n%s", content)
+	}
+}
@@ -0,0 +1,378 @@
+package shellconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// functionHeaderRegex matches the zsh and bash function forms "name() ...",
+// "function name ..." and "function name() ...". The body opener, if on the
+// same line, starts at the last group.
+var functionHeaderRegex = regexp.MustCompile(`^\s*(?:function\s+([\w.:@+-]+)\s*(?:\(\s*\))?|([\w.:@+-]+)\s*\(\s*\))\s*(.*)$`)
+
+// parseFunctionHeader returns the function name and the text after the
+// header, which should open the body.
+func parseFunctionHeader(line string) (string, string, bool) {
+	matches := functionHeaderRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return "", "", false
+	}
+	return matches[1] + matches[2], matches[3], true
+}
+
+// functionEnd returns the index of the line that closes the function
+// starting at lines[start], or -1 if lines[start] does not begin a function
+// or its body never closes.
+func functionEnd(lines []string, start int) int {
+	_, rest, ok := parseFunctionHeader(lines[start])
+	if !ok {
+		return -1
+	}
+	i := start
+	if strings.TrimSpace(rest) == "" {
+		// The body may open on the following line.
+		if i+1 >= len(lines) {
+			return -1
+		}
+		i++
+		rest = lines[i]
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if rest == "" || (rest[0] != '{' && rest[0] != '(') {
+		return -1
+	}
+
+	s := &blockScanner{open: rest[0], close: '}'}
+	if s.open == '(' {
+		s.close = ')'
+	}
+	if s.feed(rest) {
+		return i
+	}
+	for i++; i < len(lines); i++ {
+		if s.feed(lines[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+type heredoc struct {
+	delim string
+	strip bool
+}
+
+// blockScanner follows a function body line by line, tracking quoting,
+// expansions, comments and heredocs so that only the braces or parentheses
+// that delimit the body change its depth.
+type blockScanner struct {
+	open, close byte
+	depth       int
+	caseDepth   int
+
+	// stack holds the open quoting contexts: '\'', '"', '$' for $'...',
+	// '`', '(' for command substitution and '{' for ${...}.
+	stack    []byte
+	pending  []heredoc
+	heredocs []heredoc
+}
+
+// feed scans one line and reports whether the body closed on it.
+func (s *blockScanner) feed(line string) bool {
+	if len(s.heredocs) > 0 {
+		doc := s.heredocs[0]
+		text := line
+		if doc.strip {
+			text = strings.TrimLeft(text, "\t")
+		}
+		if text == doc.delim {
+			s.heredocs = s.heredocs[1:]
+		}
+		return false
+	}
+
+scan:
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		top := byte(0)
+		if len(s.stack) > 0 {
+			top = s.stack[len(s.stack)-1]
+		}
+
+		switch top {
+		case '\'':
+			if c == '\'' {
+				s.pop()
+			}
+			continue
+		case '$':
+			if c == '\\' {
+				i++
+			} else if c == '\'' {
+				s.pop()
+			}
+			continue
+		case '`':
+			if c == '\\' {
+				i++
+			} else if c == '`' {
+				s.pop()
+			}
+			continue
+		case '"':
+			switch {
+			case c == '\\':
+				i++
+			case c == '"':
+				s.pop()
+			default:
+				i += s.pushExpansion(line, i)
+			}
+			continue
+		}
+
+		// Unquoted text, at the top level or inside $(...) or ${...}.
+		switch {
+		case c == '\\':
+			i++
+		case c == '\'':
+			s.stack = append(s.stack, '\'')
+		case c == '"':
+			s.stack = append(s.stack, '"')
+		case c == '$' && i+1 < len(line) && line[i+1] == '\'':
+			s.stack = append(s.stack, '$')
+			i++
+		case c == '#' && top != '{' && wordStart(line, i):
+			break scan
+		case c == '<' && strings.HasPrefix(line[i:], "<<") && !strings.HasPrefix(line[i:], "<<<"):
+			i = s.readHeredoc(line, i+2) - 1
+		case top == '(' && c == '(':
+			s.stack = append(s.stack, '(')
+		case top == '(' && c == ')':
+			s.pop()
+		case top == '{' && c == '}':
+			s.pop()
+		default:
+			if skip := s.pushExpansion(line, i); skip > 0 {
+				i += skip
+				continue
+			}
+			if top != 0 {
+				continue
+			}
+			if wordStart(line, i) && isWordChar(c) {
+				word := line[i:]
+				if end := strings.IndexFunc(word, func(r rune) bool { return r > 127 || !isWordChar(byte(r)) }); end >= 0 {
+					word = word[:end]
+				}
+				switch word {
+				case "case":
+					s.caseDepth++
+				case "esac":
+					s.caseDepth--
+				}
+				i += len(word) - 1
+				continue
+			}
+			if s.delimiter(line, i) {
+				if c == s.open {
+					s.depth++
+				} else if s.depth--; s.depth == 0 {
+					return true
+				}
+			}
+		}
+	}
+	s.heredocs = append(s.heredocs, s.pending...)
+	s.pending = nil
+	return false
+}
+
+func (s *blockScanner) pop() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+// pushExpansion opens $(...), ${...} or `...` at i and returns how many
+// extra bytes it consumed, or 0 if there is none.
+func (s *blockScanner) pushExpansion(line string, i int) int {
+	switch {
+	case line[i] == '`':
+		s.stack = append(s.stack, '`')
+		return 0
+	case line[i] == '$' && i+1 < len(line) && (line[i+1] == '(' || line[i+1] == '{'):
+		s.stack = append(s.stack, line[i+1])
+		return 1
+	}
+	return 0
+}
+
+// readHeredoc records the delimiter of a heredoc whose operator ends just
+// before i, returning the index after the delimiter.
+func (s *blockScanner) readHeredoc(line string, i int) int {
+	doc := heredoc{}
+	if i < len(line) && line[i] == '-' {
+		doc.strip = true
+		i++
+	}
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	w, end, err := lexWord(line, i)
+	if err != nil || end == i {
+		return i
+	}
+	doc.delim = w.literal()
+	s.pending = append(s.pending, doc)
+	return end
+}
+
+// delimiter reports whether line[i] is a brace or parenthesis that opens or
+// closes the function body. Braces only count as the reserved words { and },
+// and parentheses inside case blocks belong to patterns.
+func (s *blockScanner) delimiter(line string, i int) bool {
+	c := line[i]
+	if c != s.open && c != s.close {
+		return false
+	}
+	if s.open == '(' {
+		return s.caseDepth == 0
+	}
+	if c == '{' {
+		return i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t'
+	}
+	before := i == 0 || strings.IndexByte(" \t;&", line[i-1]) >= 0
+	after := i+1 == len(line) || strings.IndexByte(" \t;&|)<>#", line[i+1]) >= 0
+	return before && after
+}
+
+func wordStart(line string, i int) bool {
+	return i == 0 || strings.IndexByte(" \t;&|(){}", line[i-1]) >= 0
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// Function returns the definition of the named function.
+func (c *Config) Function(name string) (string, bool) {
+	for _, text := range c.CustomFunctions {
+		if FunctionName(text) == name {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// SetFunction replaces the function called name with text, or adds text as a
+// new function when name is empty or unknown. If text declares a different
+// name the function is renamed in place.
+func (c *Config) SetFunction(name, text string) error {
+	if err := c.CheckFunction(text); err != nil {
+		return err
+	}
+	newName := FunctionName(text)
+	if newName != name {
+		if _, exists := c.Function(newName); exists {
+			return fmt.Errorf("function %s already exists", newName)
+		}
+	}
+
+	for i, existing := range c.CustomFunctions {
+		if FunctionName(existing) != name {
+			continue
+		}
+		c.CustomFunctions[i] = text
+		if newName != name {
+			// Renaming the node keeps the definition where it was.
+			for _, ref := range c.find(NodeFunction) {
+				if ref.node.Name == name {
+					ref.node.Name = newName
+				}
+			}
+		}
+		return nil
+	}
+	c.CustomFunctions = append(c.CustomFunctions, text)
+	return nil
+}
+
+// RenameFunction changes the name a function is declared with.
+func (c *Config) RenameFunction(oldName, newName string) error {
+	text, ok := c.Function(oldName)
+	if !ok {
+		return fmt.Errorf("function %s not found", oldName)
+	}
+	header, offset := headerLine(text)
+	loc := functionHeaderRegex.FindStringSubmatchIndex(header)
+	if loc == nil {
+		loc = fishFunctionStartRegex.FindStringSubmatchIndex(header)
+	}
+	for group := 1; loc != nil && 2*group+1 < len(loc); group++ {
+		if start, end := loc[2*group], loc[2*group+1]; start >= 0 && header[start:end] == oldName {
+			start, end = start+offset, end+offset
+			return c.SetFunction(oldName, text[:start]+newName+text[end:])
+		}
+	}
+	return fmt.Errorf("cannot find the name of function %s", oldName)
+}
+
+// headerLine returns the first line of text that is not blank or a comment,
+// and its byte offset.
+func headerLine(text string) (string, int) {
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return strings.TrimSuffix(line, "\n"), offset
+		}
+		offset += len(line)
+	}
+	return "", 0
+}
+
+// RemoveFunction deletes the named function.
+func (c *Config) RemoveFunction(name string) {
+	functions := []string{}
+	for _, text := range c.CustomFunctions {
+		if FunctionName(text) != name {
+			functions = append(functions, text)
+		}
+	}
+	c.CustomFunctions = functions
+}
+
+// CheckFunction verifies that text is a single complete function definition
+// and, when the shell is installed, that the shell accepts its syntax.
+func (c *Config) CheckFunction(text string) error {
+	name := FunctionName(text)
+	if name == "" {
+		return fmt.Errorf("no function definition found")
+	}
+	if !isFunctionName(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+
+	doc := c.Dialect.Parse(text)
+	functions := 0
+	for _, node := range doc.Nodes {
+		switch node.Kind {
+		case NodeFunction:
+			functions++
+		case NodeBlank, NodeComment:
+		default:
+			if _, _, ok := parseFunctionHeader(node.String()); ok {
+				return fmt.Errorf("function %s is not terminated", name)
+			}
+			return fmt.Errorf("unexpected text outside function %s at line %d", name, node.Line)
+		}
+	}
+	if functions != 1 {
+		return fmt.Errorf("expected one function definition, found %d", functions)
+	}
+
+	return checkSyntax(c.Dialect.Name(), text)
+}
+
+func isFunctionName(name string) bool {
+	return name != "" && strings.Trim(name, "_.:@+-") != "" && !strings.ContainsAny(name, " \t$\"'`;&|<>(){}")
+}
@@ -0,0 +1,130 @@
+package shellconfig
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const functionsContent = `function greet {
+    echo "hi }"
+}
+function both() {
+    if [ -n "$1" ]; then
+        { echo nested; }
+    fi
+}
+one() { echo one; }
+spaced ()
+{
+    case "$1" in
+        a) echo '{' ;;
+        *) echo "${1:-}}" ;;
+    esac
+}
+doc() {
+    cat <<-EOF
+	}
+	EOF
+    cat <<'END'
+}
+END
+}
+sub() (
+    cd /tmp && ls
+)
+broken() {
+    echo never closed
+export AFTER=1`
+
+func TestParseFunctionForms(t *testing.T) {
+	doc := Zsh.Parse(functionsContent)
+	if got := doc.String(); got != functionsContent {
+		t.Errorf("Expected round trip, got:\n%s", got)
+	}
+
+	want := map[string]int{"greet": 3, "both": 5, "one": 1, "spaced": 7, "doc": 8, "sub": 3}
+	functions := doc.Find(NodeFunction)
+	if len(functions) != len(want) {
+		t.Errorf("Expected %d functions, got %d", len(want), len(functions))
+	}
+	for _, node := range functions {
+		if lines, ok := want[node.Name]; !ok || len(node.Lines) != lines {
+			t.Errorf("Function %s: expected %d lines, got %d", node.Name, lines, len(node.Lines))
+		}
+	}
+
+	// An unterminated function is left raw so the rest of the file still
+	// parses.
+	if exports := doc.Find(NodeExport); len(exports) != 1 || exports[0].Name != "AFTER" {
+		t.Errorf("Expected AFTER export after unterminated function, got %v", exports)
+	}
+}
+
+func TestFunctionName(t *testing.T) {
+	cases := map[string]string{
+		"foo() {\n}":             "foo",
+		"function bar {\n}":      "bar",
+		"function baz() { :; }":  "baz",
+		"git-sync () {\n}":       "git-sync",
+		"function ll\n  ls\nend": "ll",
+		"echo hi":                "",
+	}
+	for text, want := range cases {
+		if got := FunctionName(text); got != want {
+			t.Errorf("FunctionName(%q): expected %q, got %q", text, want, got)
+		}
+	}
+}
+
+func TestSetFunction(t *testing.T) {
+	config := newTestConfig("first() {\n    echo 1\n}\n\nsecond() {\n    echo 2\n}\n")
+
+	if err := config.SetFunction("first", "first() {\n    echo one\n}"); err != nil {
+		t.Fatalf("Failed to edit function: %v", err)
+	}
+	if err := config.RenameFunction("second", "third"); err != nil {
+		t.Fatalf("Failed to rename function: %v", err)
+	}
+	if err := config.SetFunction("", "fourth() { echo 4; }"); err != nil {
+		t.Fatalf("Failed to add function: %v", err)
+	}
+	config.RemoveFunction("first")
+
+	got := config.Document().String()
+	want := "\nthird() {\n    echo 2\n}\nfourth() { echo 4; }\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if err := config.SetFunction("third", "fourth() { :; }"); err == nil {
+		t.Error("Expected error renaming onto an existing function")
+	}
+}
+
+func TestCheckFunction(t *testing.T) {
+	config := NewWithDialect(Zsh, ".zshrc")
+	invalid := []string{
+		"echo not a function",
+		"broken() {\n    echo",
+		"a() { :; }\nb() { :; }",
+		"a() { :; }\necho trailing",
+	}
+	for _, text := range invalid {
+		if err := config.CheckFunction(text); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+	if err := config.CheckFunction("# helper\nok() {\n    echo \"}\"\n}"); err != nil {
+		t.Errorf("Expected valid function to pass, got %v", err)
+	}
+	if err := config.SetFunction("", "broken() {"); err == nil || !strings.Contains(err.Error(), "not terminated") {
+		t.Errorf("Expected unterminated error, got %v", err)
+	}
+
+	if _, err := exec.LookPath("bash"); err == nil {
+		if err := NewWithDialect(Bash, ".bashrc").CheckFunction("bad() {\n    if then fi\n}"); err == nil {
+			t.Error("Expected bash to reject invalid syntax")
+		}
+	}
+}
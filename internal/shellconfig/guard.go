@@ -0,0 +1,539 @@
+package shellconfig
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Guard is the condition under which a run of lines executes: a branch of
+// an if or case block, the body of a loop, or the left side of
+// "cond && command". Guards nest through Parent.
+type Guard struct {
+	Keyword   string
+	Condition string
+	Subject   string
+	Parent    *Guard
+
+	first  *Guard
+	doc    *Document
+	open   *Node
+	close  *Node
+	last   *Node
+	indent string
+	// dropped holds the lines of a block removed once nothing was left in
+	// it, and before the node they preceded, so that adding an entry under
+	// the guard again writes them back.
+	dropped []*Node
+	before  *Node
+	// placeholder keeps an emptied if branch that has others after it valid.
+	placeholder *Node
+}
+
+// NewGuard returns a guard for a new if block. The block is written after
+// the last entry of the file when an entry is first added under it.
+func NewGuard(condition string) *Guard {
+	return &Guard{Keyword: "if", Condition: condition}
+}
+
+// Inline reports whether the guard prefixes a single line with "cond &&".
+func (g *Guard) Inline() bool {
+	return g.Keyword == "&&"
+}
+
+func (g *Guard) String() string {
+	var text string
+	switch g.Keyword {
+	case "&&":
+		text = g.Condition + " &&"
+	case "else":
+		text = "else of if " + g.first.Condition
+	case "case":
+		text = "case " + g.Subject + " in " + g.Condition
+	default:
+		text = g.Keyword + " " + g.Condition
+	}
+	if g.Parent != nil {
+		return g.Parent.String() + " › " + text
+	}
+	return text
+}
+
+// GuardedEntry is an alias, export or variable that only takes effect when
+// its guard holds. Guarded entries are kept out of the flat maps so that
+// saving never moves them out of their block.
+type GuardedEntry struct {
+	Kind        NodeKind
+	Name        string
+	Value       string
+	Description string
+	Guard       *Guard
+
+	node *Node
+}
+
+var (
+	posixIfRegex       = regexp.MustCompile(`^if\s+(.+?)\s*;\s*then$`)
+	posixIfOpenRegex   = regexp.MustCompile(`^if\s+([^;]+)$`)
+	posixElifRegex     = regexp.MustCompile(`^elif\s+(.+?)\s*;\s*then$`)
+	posixCaseRegex     = regexp.MustCompile(`^case\s+(.+?)\s+in$`)
+	posixPatternRegex  = regexp.MustCompile(`^\(?\s*([^()]+?)\s*\)$`)
+	posixLoopRegex     = regexp.MustCompile(`^(for|while|until)\s+(.+?)\s*;\s*do$`)
+	posixLoopOpenRegex = regexp.MustCompile(`^(for|while|until)\s+([^;]+)$`)
+	blockEndRegex      = regexp.MustCompile(`^(fi|esac|done|end)\s*(?:[#<>|].*)?$`)
+	caseBreakRegex     = regexp.MustCompile(`;;&?$|;[&|]$`)
+	fishIfRegex        = regexp.MustCompile(`^if\s+(.+)$`)
+	fishElseIfRegex    = regexp.MustCompile(`^else\s+if\s+(.+)$`)
+	fishSwitchRegex    = regexp.MustCompile(`^switch\s+(.+)$`)
+	fishCaseRegex      = regexp.MustCompile(`^case\s+(.+)$`)
+	fishLoopRegex      = regexp.MustCompile(`^(for|while)\s+(.+)$`)
+	fishBeginRegex     = regexp.MustCompile(`^begin\b`)
+)
+
+// blockFrame is an open if, case, loop or other compound command.
+type blockFrame struct {
+	keyword string
+	subject string
+	parent  *Guard
+	first   *Guard
+	guard   *Guard
+}
+
+// blockTracker follows the nesting of conditional blocks while a document is
+// parsed, so that each node can be tagged with the guard it runs under.
+type blockTracker struct {
+	doc    *Document
+	frames []*blockFrame
+}
+
+// current returns the innermost active guard.
+func (t *blockTracker) current() *Guard {
+	for i := len(t.frames) - 1; i >= 0; i-- {
+		if t.frames[i].guard != nil {
+			return t.frames[i].guard
+		}
+	}
+	return nil
+}
+
+func (t *blockTracker) top(keyword string) *blockFrame {
+	if len(t.frames) == 0 || t.frames[len(t.frames)-1].keyword != keyword {
+		return nil
+	}
+	return t.frames[len(t.frames)-1]
+}
+
+// push opens a block. Its guards are started by branch.
+func (t *blockTracker) push(keyword, subject string) *blockFrame {
+	frame := &blockFrame{keyword: keyword, subject: subject, parent: t.current()}
+	t.frames = append(t.frames, frame)
+	return frame
+}
+
+// branch ends the current guard of frame at node and, unless keyword is
+// empty, starts a new one.
+func (t *blockTracker) branch(frame *blockFrame, keyword, condition string, node *Node) {
+	if frame.guard != nil {
+		frame.guard.close = node
+	}
+	frame.guard = nil
+	if keyword == "" {
+		return
+	}
+	guard := &Guard{
+		Keyword:   keyword,
+		Condition: condition,
+		Parent:    frame.parent,
+		first:     frame.first,
+		doc:       t.doc,
+		open:      node,
+		indent:    indentOf(node.String()) + "    ",
+	}
+	if frame.keyword == "case" || frame.keyword == "switch" {
+		guard.Subject = frame.subject
+	}
+	if frame.first == nil {
+		frame.first = guard
+		guard.first = guard
+	}
+	frame.guard = guard
+}
+
+func (t *blockTracker) pop(node *Node) {
+	t.branch(t.frames[len(t.frames)-1], "", "", node)
+	t.frames = t.frames[:len(t.frames)-1]
+}
+
+// posixLine updates the tracker for a line of zsh or bash.
+func (t *blockTracker) posixLine(node *Node) {
+	trimmed := strings.TrimSpace(node.String())
+	if frame := t.top("case"); frame != nil {
+		switch {
+		case frame.guard == nil:
+			if matches := posixPatternRegex.FindStringSubmatch(trimmed); matches != nil {
+				t.branch(frame, "case", matches[1], node)
+				return
+			}
+		case caseBreakRegex.MatchString(trimmed):
+			t.branch(frame, "", "", node)
+			return
+		}
+	}
+
+	switch {
+	case posixIfRegex.MatchString(trimmed):
+		t.branch(t.push("if", ""), "if", posixIfRegex.FindStringSubmatch(trimmed)[1], node)
+	case posixIfOpenRegex.MatchString(trimmed) && !strings.Contains(trimmed, "then"):
+		t.branch(t.push("if", ""), "if", posixIfOpenRegex.FindStringSubmatch(trimmed)[1], node)
+	case posixElifRegex.MatchString(trimmed) && t.top("if") != nil:
+		t.branch(t.top("if"), "elif", posixElifRegex.FindStringSubmatch(trimmed)[1], node)
+	case trimmed == "else" && t.top("if") != nil:
+		t.branch(t.top("if"), "else", "", node)
+	case posixCaseRegex.MatchString(trimmed):
+		t.push("case", posixCaseRegex.FindStringSubmatch(trimmed)[1])
+	case posixLoopRegex.MatchString(trimmed):
+		matches := posixLoopRegex.FindStringSubmatch(trimmed)
+		t.branch(t.push("loop", ""), matches[1], matches[2], node)
+	case posixLoopOpenRegex.MatchString(trimmed) && !strings.Contains(trimmed, "done"):
+		matches := posixLoopOpenRegex.FindStringSubmatch(trimmed)
+		t.branch(t.push("loop", ""), matches[1], matches[2], node)
+	case blockEndRegex.MatchString(trimmed):
+		keyword := map[string]string{"fi": "if", "esac": "case", "done": "loop"}[blockEndRegex.FindStringSubmatch(trimmed)[1]]
+		if t.top(keyword) != nil {
+			t.pop(node)
+		}
+	}
+}
+
+// fishLine updates the tracker for a line of fish. Begin blocks are tracked
+// only so that their end is not mistaken for the end of an if.
+func (t *blockTracker) fishLine(node *Node) {
+	trimmed := strings.TrimSpace(node.String())
+	switch {
+	case fishElseIfRegex.MatchString(trimmed) && t.top("if") != nil:
+		t.branch(t.top("if"), "else if", fishElseIfRegex.FindStringSubmatch(trimmed)[1], node)
+	case trimmed == "else" && t.top("if") != nil:
+		t.branch(t.top("if"), "else", "", node)
+	case fishIfRegex.MatchString(trimmed) && !strings.Contains(trimmed, "; end"):
+		t.branch(t.push("if", ""), "if", fishIfRegex.FindStringSubmatch(trimmed)[1], node)
+	case fishSwitchRegex.MatchString(trimmed):
+		t.push("switch", fishSwitchRegex.FindStringSubmatch(trimmed)[1])
+	case fishCaseRegex.MatchString(trimmed) && t.top("switch") != nil:
+		t.branch(t.top("switch"), "case", fishCaseRegex.FindStringSubmatch(trimmed)[1], node)
+	case fishLoopRegex.MatchString(trimmed) && !strings.Contains(trimmed, "; end"):
+		matches := fishLoopRegex.FindStringSubmatch(trimmed)
+		t.branch(t.push("loop", ""), matches[1], matches[2], node)
+	case fishBeginRegex.MatchString(trimmed) && !strings.Contains(trimmed, "; end"):
+		t.push("block", "")
+	case blockEndRegex.MatchString(trimmed) && len(t.frames) > 0:
+		t.pop(node)
+	}
+}
+
+// tag attaches the current guard to the nodes parsed from one line. Block
+// guards record the indentation of the first entry inside them.
+func (t *blockTracker) tag(nodes ...*Node) {
+	guard := t.current()
+	if guard == nil {
+		return
+	}
+	for _, node := range nodes {
+		if node.Guard == nil {
+			node.Guard = guard
+		}
+	}
+	if kind := nodes[0].Kind; kind == NodeAlias || kind == NodeExport || kind == NodeVariable {
+		if guard.last == nil {
+			guard.indent = nodes[0].Indent
+		}
+		guard.last = nodes[0]
+	}
+}
+
+// splitGuard splits "cond && command" at its last unquoted &&. The
+// condition must be a single pipeline so that the guard covers only the
+// command.
+func splitGuard(line string) (string, string, bool) {
+	split := -1
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			i = len(line)
+		case c == ';' || (c == '|' && i+1 < len(line) && line[i+1] == '|'):
+			if split < 0 {
+				return "", "", false
+			}
+		case c == '&' && i+1 < len(line) && line[i+1] == '&':
+			split = i
+			i++
+		}
+	}
+	if split < 0 || quote != 0 {
+		return "", "", false
+	}
+	condition := strings.TrimSpace(line[:split])
+	command := strings.TrimSpace(line[split+2:])
+	if condition == "" || command == "" {
+		return "", "", false
+	}
+	return condition, command, true
+}
+
+// guardInline marks nodes parsed from the command half of "cond && command".
+func guardInline(nodes []*Node, condition string, parent *Guard, doc *Document) {
+	guard := &Guard{Keyword: "&&", Condition: condition, Parent: parent, doc: doc, open: nodes[0], last: nodes[0]}
+	guard.indent = nodes[0].Indent
+	for _, node := range nodes {
+		node.Guard = guard
+	}
+}
+
+func indentOf(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// guard returns the condition the referenced node runs under, including the
+// guard of the source command that included its file.
+func (r nodeRef) guard() *Guard {
+	if r.node.Guard != nil {
+		return r.node.Guard
+	}
+	return r.src.Guard
+}
+
+// unguarded returns the nodes of a kind that always run.
+func (c *Config) unguarded(kind NodeKind) []nodeRef {
+	refs := []nodeRef{}
+	for _, ref := range c.find(kind) {
+		if ref.guard() == nil {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Guards returns every condition found in the loaded files, plus those of
+// new guarded entries, in file order.
+func (c *Config) Guards() []*Guard {
+	guards := []*Guard{}
+	seen := make(map[*Guard]bool)
+	add := func(guard *Guard) {
+		chain := []*Guard{}
+		for g := guard; g != nil && !seen[g]; g = g.Parent {
+			chain = append([]*Guard{g}, chain...)
+			seen[g] = true
+		}
+		guards = append(guards, chain...)
+	}
+	c.tree().walk(func(src *Source, node *Node) {
+		add(src.Guard)
+		add(node.Guard)
+	})
+	for _, entry := range c.Guarded {
+		add(entry.Guard)
+	}
+	return guards
+}
+
+// AddGuarded adds an entry that only applies when guard holds.
+func (c *Config) AddGuarded(kind NodeKind, name, value string, guard *Guard) *GuardedEntry {
+	entry := &GuardedEntry{Kind: kind, Name: name, Value: value, Guard: guard}
+	c.Guarded = append(c.Guarded, entry)
+	return entry
+}
+
+// RemoveGuarded deletes a guarded entry.
+func (c *Config) RemoveGuarded(entry *GuardedEntry) {
+	entries := []*GuardedEntry{}
+	for _, e := range c.Guarded {
+		if e != entry {
+			entries = append(entries, e)
+		}
+	}
+	c.Guarded = entries
+}
+
+// GuardedOrigin returns where a guarded entry is defined.
+func (c *Config) GuardedOrigin(entry *GuardedEntry) Origin {
+	c.sync()
+	origin := Origin{}
+	c.tree().walk(func(src *Source, node *Node) {
+		if node == entry.node {
+			origin.Path = src.Path
+			if !node.Modified() || node.Line > 0 {
+				origin.Line = src.LineOf(node)
+			}
+		}
+	})
+	if origin.Path == "" {
+		origin.Path = c.FilePath
+	}
+	return origin
+}
+
+// syncGuarded applies edits to guarded entries in place and writes new ones
+// inside the block of their guard.
+func (c *Config) syncGuarded() {
+	entries := make(map[*Node]*GuardedEntry)
+	for _, entry := range c.Guarded {
+		if entry.node != nil {
+			entries[entry.node] = entry
+		}
+	}
+	for _, kind := range []NodeKind{NodeExport, NodeVariable, NodeAlias} {
+		for _, ref := range c.find(kind) {
+			if ref.guard() == nil {
+				continue
+			}
+			entry, ok := entries[ref.node]
+			if !ok {
+				ref.remove()
+				c.dropEmptyGuard(ref.node.Guard)
+				continue
+			}
+			if entry.Name != ref.node.Name {
+				ref.node.Name = entry.Name
+				ref.node.Lines = nil
+			}
+			ref.node.set(entry.Value)
+			ref.src.Doc.setDescription(ref.node, entry.Description)
+		}
+	}
+	for _, entry := range c.Guarded {
+		if entry.node == nil {
+			entry.node = c.insertGuarded(entry)
+		}
+	}
+}
+
+func (c *Config) insertGuarded(entry *GuardedEntry) *Node {
+	guard := entry.Guard
+	node := &Node{Kind: entry.Kind, Name: entry.Name, Value: entry.Value, Guard: guard}
+	if entry.Description != "" {
+		node.Comment = "# " + strings.ReplaceAll(entry.Description, "\n", " ")
+	}
+	if guard.doc == nil {
+		c.openGuard(guard, c.target(entry.Kind))
+	}
+	doc := guard.doc
+	node.Indent = guard.indent
+	guard.restore()
+	if guard.placeholder != nil {
+		doc.Remove(guard.placeholder)
+		guard.placeholder = nil
+	}
+
+	switch {
+	case guard.Inline() && guard.last != nil:
+		doc.insertAfter(guard.last, node)
+	case guard.close != nil && doc.indexOf(guard.close) > 0:
+		doc.insertAfter(doc.Nodes[doc.indexOf(guard.close)-1], node)
+	default:
+		doc.Insert(len(doc.Nodes), node)
+	}
+	guard.last = node
+	return node
+}
+
+// openGuard writes an empty block for a new guard at the end of doc.
+func (c *Config) openGuard(guard *Guard, doc *Document) {
+	open, close := c.Dialect.FormatGuard(guard.Condition)
+	guard.doc = doc
+	guard.open = &Node{Kind: NodeRaw, Value: open}
+	guard.close = &Node{Kind: NodeRaw, Value: close}
+	guard.first = guard
+	guard.indent = "    "
+	nodes := []*Node{guard.open, guard.close}
+	if len(doc.Nodes) > 0 && doc.Nodes[len(doc.Nodes)-1].Kind != NodeBlank {
+		nodes = append([]*Node{{Kind: NodeBlank}}, nodes...)
+	}
+	doc.Insert(len(doc.Nodes), nodes...)
+}
+
+// dropEmptyGuard removes the lines of a block guard once nothing but blank
+// lines and comments is left in it, since the shell rejects an empty if
+// branch or loop body. A branch with others after it keeps a no-op instead,
+// and dropping a whole block can in turn empty the block around it.
+func (c *Config) dropEmptyGuard(guard *Guard) {
+	if guard == nil || guard.Inline() || guard.doc == nil || guard.close == nil {
+		return
+	}
+	doc := guard.doc
+	start, end := doc.indexOf(guard.open), doc.indexOf(guard.close)
+	if start < 0 || end <= start {
+		return
+	}
+	for _, node := range doc.Nodes[start+1 : end] {
+		if trimmed := strings.TrimSpace(node.String()); node.Kind != NodeBlank && node.Kind != NodeComment && trimmed != "then" && trimmed != "do" {
+			return
+		}
+	}
+
+	closing := strings.TrimSpace(guard.close.String())
+	switch {
+	case caseBreakRegex.MatchString(closing) || (guard.first == guard && guard.Keyword != "case" && blockEndRegex.MatchString(closing)):
+		guard.drop(start, end+1)
+		if parent := guard.Parent; parent != nil && parent.doc == doc {
+			c.dropEmptyGuard(parent)
+		}
+	case guard.first != guard || guard.Keyword == "case":
+		guard.drop(start, end)
+		// The branch before now runs up to the line that ended this one.
+		if previous := guard.open.Guard; previous != nil && previous.close == guard.open {
+			previous.close = guard.close
+			if guard.close.Guard == guard {
+				guard.close.Guard = previous
+			}
+		}
+	case c.Dialect.Name() != "fish":
+		guard.placeholder = &Node{Kind: NodeRaw, Value: guard.indent + ":", Guard: guard}
+		doc.Insert(end, guard.placeholder)
+	}
+}
+
+// drop takes the nodes from start up to end out of the guard's document.
+func (g *Guard) drop(start, end int) {
+	doc := g.doc
+	g.dropped = append([]*Node{}, doc.Nodes[start:end]...)
+	g.before = nil
+	if end < len(doc.Nodes) {
+		g.before = doc.Nodes[end]
+	}
+	for _, node := range g.dropped {
+		doc.Remove(node)
+	}
+}
+
+// restore writes back the lines of a dropped block, and of the blocks
+// around it that were dropped with it.
+func (g *Guard) restore() {
+	if len(g.dropped) == 0 {
+		return
+	}
+	if g.Parent != nil && g.Parent.doc == g.doc {
+		g.Parent.restore()
+	}
+	i := len(g.doc.Nodes)
+	if g.before != nil && g.doc.indexOf(g.before) >= 0 {
+		i = g.doc.indexOf(g.before)
+	}
+	g.doc.Insert(i, g.dropped...)
+	if previous := g.open.Guard; previous != nil && previous.close == g.close {
+		previous.close = g.open
+		if g.close.Guard == previous {
+			g.close.Guard = g
+		}
+	}
+	g.dropped, g.before = nil, nil
+}
@@ -0,0 +1,204 @@
+package shellconfig
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const guardedContent = `export EDITOR=vi
+if [[ -d ~/go ]]; then
+    export GOPATH=~/go
+else
+    export GOPATH=/opt/go
+fi
+case $HOST in
+    work*)
+        alias vpn='sudo vpnc'
+        ;;
+esac
+command -v nvim >/dev/null && alias vim=nvim
+`
+
+func TestParseGuards(t *testing.T) {
+	config := newTestConfig(guardedContent)
+
+	if len(config.Exports) != 1 || config.Exports["EDITOR"] != "vi" {
+		t.Errorf("Expected only EDITOR in Exports, got %v", config.Exports)
+	}
+	if len(config.Aliases) != 0 {
+		t.Errorf("Expected no unconditional aliases, got %v", config.Aliases)
+	}
+
+	want := []struct{ name, value, guard string }{
+		{"GOPATH", "~/go", "if [[ -d ~/go ]]"},
+		{"GOPATH", "/opt/go", "else of if [[ -d ~/go ]]"},
+		{"vpn", "sudo vpnc", "case $HOST in work*"},
+		{"vim", "nvim", "command -v nvim >/dev/null &&"},
+	}
+	if len(config.Guarded) != len(want) {
+		t.Fatalf("Expected %d guarded entries, got %d", len(want), len(config.Guarded))
+	}
+	for i, w := range want {
+		entry := config.Guarded[i]
+		if entry.Name != w.name || entry.Value != w.value || entry.Guard.String() != w.guard {
+			t.Errorf("Entry %d: expected %s=%s under %q, got %s=%s under %q", i, w.name, w.value, w.guard, entry.Name, entry.Value, entry.Guard)
+		}
+	}
+
+	if got := config.Document().String(); got != guardedContent {
+		t.Errorf("Expected unedited document to round trip, got:\n%s", got)
+	}
+}
+
+func TestEditGuardedEntries(t *testing.T) {
+	config := newTestConfig(guardedContent)
+
+	config.Exports["PAGER"] = "less"
+	config.Guarded[0].Value = "$HOME/go"
+	config.RemoveGuarded(config.Guarded[3])
+	config.AddGuarded(NodeExport, "GOBIN", "~/go/bin", config.Guarded[0].Guard)
+	ssh := NewGuard("[[ -n $SSH_TTY ]]")
+	config.AddGuarded(NodeAlias, "ls", "ls --color=never", ssh)
+	config.AddGuarded(NodeExport, "TERM", "xterm", ssh)
+
+	want := `export EDITOR=vi
+export PAGER="less"
+if [[ -d ~/go ]]; then
+    export GOPATH=$HOME/go
+    export GOBIN=~"/go/bin"
+else
+    export GOPATH=/opt/go
+fi
+case $HOST in
+    work*)
+        alias vpn='sudo vpnc'
+        ;;
+esac
+
+if [[ -n $SSH_TTY ]]; then
+    alias ls='ls --color=never'
+    export TERM="xterm"
+fi
+`
+	if got := config.Document().String(); got != want {
+		t.Errorf("Unexpected document:\n%s\nwant:\n%s", got, want)
+	}
+
+	guards := []string{}
+	for _, guard := range config.Guards() {
+		guards = append(guards, guard.String())
+	}
+	if len(guards) != 4 || guards[3] != "if [[ -n $SSH_TTY ]]" {
+		t.Errorf("Unexpected guards: %v", guards)
+	}
+}
+
+func TestConditionalInclude(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFiles(t, home, map[string]string{
+		".zshrc":     "[ -f ~/.local.zsh ] && source ~/.local.zsh\n",
+		".local.zsh": "export LOCAL=1\nif [[ $TERM = xterm* ]]; then\n  alias t=tmux\nfi\n",
+	})
+
+	config := NewForFile(filepath.Join(home, ".zshrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(config.Exports) != 0 || len(config.Guarded) != 2 {
+		t.Fatalf("Expected entries of the conditional include to be guarded, got %v and %d guarded", config.Exports, len(config.Guarded))
+	}
+	if got := config.Guarded[1].Guard.String(); got != "[ -f ~/.local.zsh ] && › if [[ $TERM = xterm* ]]" {
+		t.Errorf("Unexpected nested guard: %q", got)
+	}
+
+	config.AddGuarded(NodeExport, "EXTRA", "1", config.Guarded[0].Guard)
+	want := "[ -f ~/.local.zsh ] && source ~/.local.zsh\n[ -f ~/.local.zsh ] && export EXTRA=\"1\"\n"
+	if got := config.Document().String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if origin := config.GuardedOrigin(config.Guarded[1]); origin.Path != filepath.Join(home, ".local.zsh") || origin.Line != 3 {
+		t.Errorf("Unexpected origin for guarded alias: %+v", origin)
+	}
+}
+
+func TestFishGuards(t *testing.T) {
+	content := "if test -d ~/go\n    set -gx GOPATH ~/go\nelse if test -d /opt/go\n    set -gx GOPATH /opt/go\nend\nset -gx EDITOR nvim\n"
+	config := NewWithDialect(Fish, filepath.Join(t.TempDir(), "config.fish"))
+	config.doc = config.Dialect.Parse(content)
+	config.populate()
+
+	if len(config.Guarded) != 2 || config.Guarded[1].Guard.String() != "else if test -d /opt/go" {
+		t.Fatalf("Expected two guarded GOPATH entries, got %d", len(config.Guarded))
+	}
+	config.Guarded[0].Value = "$HOME/go"
+	if got := config.Document().String(); !strings.Contains(got, "\n    set -gx GOPATH $HOME/go\n") {
+		t.Errorf("Expected edit to stay indented inside the if block, got:\n%s", got)
+	}
+}
+
+func TestRemoveLastGuardedEntry(t *testing.T) {
+	config := newTestConfig(guardedContent)
+
+	config.RemoveGuarded(config.Guarded[2])
+	config.RemoveGuarded(config.Guarded[1])
+	want := `export EDITOR=vi
+if [[ -d ~/go ]]; then
+    export GOPATH=~/go
+fi
+case $HOST in
+esac
+command -v nvim >/dev/null && alias vim=nvim
+`
+	if got := config.Document().String(); got != want {
+		t.Errorf("Expected emptied branches to be dropped, got:\n%s", got)
+	}
+
+	guard := config.Guarded[0].Guard
+	config.RemoveGuarded(config.Guarded[0])
+	if got := config.Document().String(); strings.Contains(got, "if [[") || strings.Contains(got, "fi\n") {
+		t.Errorf("Expected the emptied if block to be dropped, got:\n%s", got)
+	}
+	config.AddGuarded(NodeExport, "GOPATH", "/srv/go", guard)
+	if got := config.Document().String(); !strings.Contains(got, "vi\nif [[ -d ~/go ]]; then\n    export GOPATH=\"/srv/go\"\nfi\ncase") {
+		t.Errorf("Expected the block to be written back in place, got:\n%s", got)
+	}
+}
+
+func TestRemoveGuardedKeepsBranchValid(t *testing.T) {
+	config := newTestConfig("if [ -n \"$A\" ]; then\n    export X=1\nelse\n    export X=2\nfi\n")
+
+	config.RemoveGuarded(config.Guarded[0])
+	want := "if [ -n \"$A\" ]; then\n    :\nelse\n    export X=2\nfi\n"
+	if got := config.Document().String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestLoopGuards(t *testing.T) {
+	content := "export A=1\nfor dir in /opt/*/bin; do\n    export PATH=$dir:$PATH\ndone\nwhile read -r line\ndo\n    alias x=y\ndone < ~/.aliases\n"
+	config := newTestConfig(content)
+
+	if len(config.Guarded) != 2 || config.Guarded[0].Guard.String() != "for dir in /opt/*/bin" || config.Guarded[1].Guard.String() != "while read -r line" {
+		t.Fatalf("Expected loop bodies to be guarded, got %d guarded entries", len(config.Guarded))
+	}
+	if len(config.Exports) != 1 || len(config.Aliases) != 0 {
+		t.Errorf("Expected only A outside the loops, got %v and %v", config.Exports, config.Aliases)
+	}
+
+	config.Exports["B"] = "2"
+	config.Aliases["ll"] = "ls -l"
+	got := config.Document().String()
+	if !strings.HasPrefix(got, "export A=1\nexport B=\"2\"\nfor dir") {
+		t.Errorf("Expected the new export after A, got:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "done < ~/.aliases\n\n# Aliases\nalias ll='ls -l'\n") {
+		t.Errorf("Expected the new alias after the loop, got:\n%s", got)
+	}
+
+	config.RemoveGuarded(config.Guarded[1])
+	if got := config.Document().String(); strings.Contains(got, "while") || strings.Contains(got, "\ndo\n") {
+		t.Errorf("Expected the emptied loop to be dropped, got:\n%s", got)
+	}
+}
@@ -0,0 +1,175 @@
+package shellconfig
+
+import (
+	"maps"
+	"sort"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// state is the rendered text of every file of a config at one point in time,
+// along with the functions kept in the dialect's function directory.
+type state struct {
+	texts     map[string]string
+	functions map[string]string
+}
+
+func (s state) equal(other state) bool {
+	return maps.Equal(s.texts, other.texts) && maps.Equal(s.functions, other.functions)
+}
+
+// command is a recorded edit, undone by restoring the state before it and
+// redone by restoring the state after it.
+type command struct {
+	label         string
+	before, after state
+}
+
+// history holds the commands that can be undone and redone. current is the
+// state the last command left the config in.
+type history struct {
+	done    []*command
+	undone  []*command
+	current state
+	// typing is set when the last command was typing into a field, which
+	// the next keystroke in the same field extends.
+	typing bool
+}
+
+// state captures the config with pending edits applied.
+func (c *Config) state() state {
+	s := state{texts: make(map[string]string)}
+	for _, src := range c.Sources().Files() {
+		s.texts[src.Path] = src.Text()
+	}
+	_, s.functions = c.splitFunctions()
+	return s
+}
+
+// resetHistory forgets every recorded command and starts recording from the
+// config as it is now.
+func (c *Config) resetHistory() {
+	c.history = history{current: c.state()}
+}
+
+// Record turns the edits made to the typed fields since the last call into a
+// command that Undo reverts. Recording without any change does nothing.
+func (c *Config) Record(label string) {
+	c.record(label, false)
+}
+
+// RecordTyping records a keystroke in a field. Keystrokes that directly
+// follow each other under the same label form a single command, so typing
+// a value is undone in one step, and a command typed back to where it
+// started is dropped.
+func (c *Config) RecordTyping(label string) {
+	c.record(label, true)
+}
+
+func (c *Config) record(label string, typing bool) {
+	now := c.state()
+	h := &c.history
+	if now.equal(h.current) {
+		return
+	}
+	if n := len(h.done); typing && h.typing && n > 0 && h.done[n-1].label == label {
+		last := h.done[n-1]
+		last.after = now
+		if last.before.equal(now) {
+			h.done = h.done[:n-1]
+			logger.Debug("Dropped edit that changed nothing: %s", label)
+		}
+	} else {
+		h.done = append(h.done, &command{label: label, before: h.current, after: now})
+		logger.Debug("Recorded edit: %s", label)
+	}
+	h.undone = nil
+	h.current = now
+	h.typing = typing
+}
+
+// CanUndo reports whether there is an edit to undo.
+func (c *Config) CanUndo() bool {
+	return len(c.history.done) > 0
+}
+
+// CanRedo reports whether there is an undone edit to redo.
+func (c *Config) CanRedo() bool {
+	return len(c.history.undone) > 0
+}
+
+// Undo reverts the last recorded edit and returns its label, or an empty
+// label when there is nothing to undo.
+func (c *Config) Undo() (string, error) {
+	h := &c.history
+	if len(h.done) == 0 {
+		return "", nil
+	}
+	cmd := h.done[len(h.done)-1]
+	if err := c.restore(cmd.before); err != nil {
+		return "", err
+	}
+	h.done = h.done[:len(h.done)-1]
+	h.undone = append(h.undone, cmd)
+	h.current = cmd.before
+	h.typing = false
+	logger.Debug("Undid edit: %s", cmd.label)
+	return cmd.label, nil
+}
+
+// Redo applies the last undone edit again and returns its label, or an empty
+// label when there is nothing to redo.
+func (c *Config) Redo() (string, error) {
+	h := &c.history
+	if len(h.undone) == 0 {
+		return "", nil
+	}
+	cmd := h.undone[len(h.undone)-1]
+	if err := c.restore(cmd.after); err != nil {
+		return "", err
+	}
+	h.undone = h.undone[:len(h.undone)-1]
+	h.done = append(h.done, cmd)
+	h.current = cmd.after
+	h.typing = false
+	logger.Debug("Redid edit: %s", cmd.label)
+	return cmd.label, nil
+}
+
+// restore rereads the config from the texts of s. Every file keeps its base,
+// so restoring the loaded state leaves nothing to save.
+func (c *Config) restore(s state) error {
+	bases := make(map[string]string)
+	for _, src := range c.tree().Files() {
+		bases[src.Path] = src.original
+	}
+	if err := c.reparse(s.texts, bases); err != nil {
+		return err
+	}
+
+	inline, _ := c.splitFunctions()
+	names := []string{}
+	for name := range s.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		inline = append(inline, s.functions[name])
+	}
+	c.CustomFunctions = inline
+	return nil
+}
+
+// reparse loads the config with texts in place of the content on disk and
+// then sets the base of each file in bases.
+func (c *Config) reparse(texts, bases map[string]string) error {
+	if err := c.load(texts); err != nil {
+		return err
+	}
+	for _, src := range c.tree().Files() {
+		if base, ok := bases[src.Path]; ok {
+			src.original = base
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFiles(t, home, map[string]string{
+		".zshrc":           "export EDITOR=vim\nsource ~/.zsh/aliases.zsh\nplugins=(git)\n",
+		".zsh/aliases.zsh": "alias ll='ls -la'\n",
+	})
+	config := NewForFile(filepath.Join(home, ".zshrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.CanUndo() || config.CanRedo() {
+		t.Fatal("Expected a freshly loaded config to have no history")
+	}
+
+	config.Record("Nothing changed")
+	if config.CanUndo() {
+		t.Error("Expected recording without changes to add no command")
+	}
+
+	config.Aliases["ll"] = "ls -l"
+	config.RecordTyping("Edit alias ll")
+	config.Aliases["ll"] = "ls -lh"
+	config.RecordTyping("Edit alias ll")
+	config.Exports["PAGER"] = "less"
+	config.Record("Add export PAGER")
+	config.OhMyZshPlugins = []string{"git", "docker"}
+	config.Record("Toggle plugin docker")
+
+	if label, err := config.Undo(); err != nil || label != "Toggle plugin docker" {
+		t.Fatalf("Expected to undo the plugin toggle, got %q (%v)", label, err)
+	}
+	if len(config.OhMyZshPlugins) != 1 {
+		t.Errorf("Expected plugins to be restored, got %v", config.OhMyZshPlugins)
+	}
+	config.Undo()
+	if _, ok := config.Exports["PAGER"]; ok {
+		t.Error("Expected PAGER to be removed by undo")
+	}
+	if label, _ := config.Undo(); label != "Edit alias ll" || config.Aliases["ll"] != "ls -la" {
+		t.Errorf("Expected both alias edits undone in one step, got %q and ll=%q", label, config.Aliases["ll"])
+	}
+	if config.CanUndo() || config.Modified() {
+		t.Error("Expected undoing every edit to leave nothing to save")
+	}
+
+	if label, _ := config.Redo(); label != "Edit alias ll" || config.Aliases["ll"] != "ls -lh" {
+		t.Errorf("Expected redo to restore the alias edit, got %q and ll=%q", label, config.Aliases["ll"])
+	}
+	if origin, _ := config.Origin(NodeAlias, "ll"); origin.Path != filepath.Join(home, ".zsh/aliases.zsh") {
+		t.Errorf("Expected the redone alias to stay in its file, got %+v", origin)
+	}
+	if !config.Modified() {
+		t.Error("Expected the redone edit to be pending")
+	}
+
+	// A new edit after undoing drops the commands that could be redone.
+	config.Exports["EDITOR"] = "nvim"
+	config.Record("Edit export EDITOR")
+	if config.CanRedo() {
+		t.Error("Expected a new edit to clear the redo history")
+	}
+	if label, _ := config.Redo(); label != "" {
+		t.Errorf("Expected nothing to redo, got %q", label)
+	}
+}
+
+func TestUndoNewFileAndFunctionFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.fish")
+	config := NewForFile(configFile)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	config.Aliases["ll"] = "ls -la"
+	config.Record("Add alias ll")
+	if err := config.SetFunction("", Fish.FormatFunction("mkcd", []string{"mkdir -p $argv[1]"})); err != nil {
+		t.Fatalf("Failed to add function: %v", err)
+	}
+	config.Record("Add function mkcd")
+
+	config.Undo()
+	if _, ok := config.Function("mkcd"); ok {
+		t.Error("Expected the function to be removed by undo")
+	}
+	if config.Aliases["ll"] != "ls -la" {
+		t.Error("Expected the alias to survive undoing the function")
+	}
+	config.Redo()
+	if _, ok := config.Function("mkcd"); !ok {
+		t.Error("Expected redo to add the function back")
+	}
+	config.Undo()
+	config.Undo()
+	if len(config.Aliases) != 0 || config.Modified() {
+		t.Errorf("Expected an empty config after undoing everything, got %v", config.Aliases)
+	}
+	if _, err := os.Stat(configFile); !os.IsNotExist(err) {
+		t.Error("Expected undo to leave the file on disk alone")
+	}
+}
+
+func TestRecordKeepsDiscreteEditsApart(t *testing.T) {
+	config := newTestConfig("alias ll='ls -la'\n")
+	config.resetHistory()
+
+	config.Aliases["a"] = "1"
+	config.Record("Add alias")
+	config.Aliases["b"] = "2"
+	config.Record("Add alias")
+	if label, _ := config.Undo(); label != "Add alias" || config.Aliases["a"] != "1" || config.Aliases["b"] != "" {
+		t.Errorf("Expected one undo to remove only the second alias, got %v", config.Aliases)
+	}
+
+	config.Aliases["ll"] = "ls -l"
+	config.RecordTyping("Edit alias ll")
+	config.Aliases["ll"] = "ls -la"
+	config.RecordTyping("Edit alias ll")
+	if label, _ := config.Undo(); label != "Add alias" {
+		t.Errorf("Expected typing back to the old value to leave no command, got %q", label)
+	}
+	if config.CanUndo() {
+		t.Error("Expected only the first alias to be left to undo")
+	}
+}
@@ -0,0 +1,360 @@
+package shellconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/btassone/swiss-linux-knife/internal/filelock"
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// maxIncludeDepth bounds how deeply sourced files are followed.
+const maxIncludeDepth = 8
+
+// Source is one file in the tree of files reached from Config.FilePath by
+// following source and . commands.
+//
+// Guard is set when the file is only sourced under a condition.
+type Source struct {
+	Path     string
+	Line     int
+	Parent   *Source
+	Children []*Source
+	Doc      *Document
+	Guard    *Guard
+
+	include  *Node
+	original string
+	block    *managedBlock
+}
+
+// Text returns the content saving would write to the file.
+func (s *Source) Text() string {
+	if s.block == nil {
+		return s.Doc.String()
+	}
+	content := s.Doc.String()
+	if s.block.glob != "" && !s.block.found && !s.loadsContent() {
+		content = ""
+	}
+	return s.block.render(content)
+}
+
+// savedText returns Text with edited assignments put after the variables
+// they use. The order is worked out on a copy of the document, so preparing
+// a save that is then cancelled leaves the config as it was.
+func (s *Source) savedText() string {
+	doc := *s.Doc
+	doc.Nodes = slices.Clone(s.Doc.Nodes)
+	doc.orderAssignments()
+	ordered := *s
+	ordered.Doc = &doc
+	return ordered.Text()
+}
+
+// loadsContent reports whether any file sourced from s has content.
+func (s *Source) loadsContent() bool {
+	for _, child := range s.Children {
+		if len(child.Doc.Nodes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// docText returns the part of the file content text that Doc is parsed
+// from: the managed block or loader line, or the whole file.
+func (s *Source) docText(text string) string {
+	if s.block == nil {
+		return text
+	}
+	_, content := s.block.split(text)
+	return content
+}
+
+// LineOf returns the line of the file at which node starts, or 0 if the node
+// is not part of the file.
+func (s *Source) LineOf(node *Node) int {
+	line := s.Doc.LineOf(node)
+	if line > 0 && s.block != nil {
+		line += strings.Count(s.block.prefix(), "\n")
+	}
+	return line
+}
+
+// Modified reports whether saving would change the file on disk.
+func (s *Source) Modified() bool {
+	return s.Text() != s.original
+}
+
+// walk visits every node in the order the shell would execute it, descending
+// into sourced files where they are included.
+func (s *Source) walk(visit func(*Source, *Node)) {
+	for _, node := range s.Doc.Nodes {
+		visit(s, node)
+		for _, child := range s.Children {
+			if child.include == node {
+				child.walk(visit)
+			}
+		}
+	}
+}
+
+// child returns the file sourced directly from s at path, or nil.
+func (s *Source) child(path string) *Source {
+	for _, child := range s.Children {
+		if child.Path == path {
+			return child
+		}
+	}
+	return nil
+}
+
+// Files returns the sources of the tree in depth-first order.
+func (s *Source) Files() []*Source {
+	files := []*Source{s}
+	for _, child := range s.Children {
+		files = append(files, child.Files()...)
+	}
+	return files
+}
+
+// Origin is the file and line where an entry is defined. Line is zero for
+// entries that have not been saved yet.
+type Origin struct {
+	Path string
+	Line int
+}
+
+func (o Origin) String() string {
+	path := ShortPath(o.Path)
+	if o.Line == 0 {
+		return path + " (new)"
+	}
+	return fmt.Sprintf("%s:%d", path, o.Line)
+}
+
+// ShortPath abbreviates the home directory in path to ~.
+func ShortPath(path string) string {
+	if homeDir, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, homeDir+"/") {
+		return "~" + strings.TrimPrefix(path, homeDir)
+	}
+	return path
+}
+
+type nodeRef struct {
+	src  *Source
+	node *Node
+}
+
+// remove deletes the node along with the comment lines describing it.
+func (r nodeRef) remove() {
+	if r.node.group == nil {
+		for _, comment := range r.src.Doc.leadingComments(r.node) {
+			r.src.Doc.Remove(comment)
+		}
+	}
+	r.src.Doc.Remove(r.node)
+}
+
+// tree returns the include tree, keeping its root in step with FilePath and
+// the root document.
+func (c *Config) tree() *Source {
+	if c.root == nil || c.root.Doc != c.doc {
+		c.root = &Source{Doc: c.doc}
+	}
+	c.root.Path = c.FilePath
+	c.root.block = c.block
+	return c.root
+}
+
+// Sources returns the include tree with pending edits applied.
+func (c *Config) Sources() *Source {
+	c.sync()
+	return c.tree()
+}
+
+// find returns every node of the given kind across the include tree, in
+// execution order.
+func (c *Config) find(kind NodeKind) []nodeRef {
+	refs := []nodeRef{}
+	c.tree().walk(func(src *Source, node *Node) {
+		if node.Kind == kind {
+			refs = append(refs, nodeRef{src, node})
+		}
+	})
+	return refs
+}
+
+// Origin returns where the effective definition of a named entry lives.
+func (c *Config) Origin(kind NodeKind, name string) (Origin, bool) {
+	c.sync()
+	if kind == NodeFunction {
+		if fd, ok := c.Dialect.(functionDir); ok {
+			if _, ok := c.functionFiles[name]; ok {
+				return Origin{Path: filepath.Join(fd.FunctionDir(c.FilePath), name+filepath.Ext(c.FilePath)), Line: 1}, true
+			}
+		}
+	}
+	refs := c.unguarded(kind)
+	for i := len(refs) - 1; i >= 0; i-- {
+		if refs[i].node.Name == name {
+			line := 0
+			if !refs[i].node.Modified() || refs[i].node.Line > 0 {
+				line = refs[i].src.LineOf(refs[i].node)
+			}
+			return Origin{Path: refs[i].src.Path, Line: line}, true
+		}
+	}
+	return Origin{}, false
+}
+
+// loadIncludes parses the files sourced from src and attaches them as
+// children. seen guards against include cycles. Each file is read under a
+// shared lock, and the locks are returned for the caller to release once
+// the whole tree is loaded.
+func (c *Config) loadIncludes(src *Source, seen map[string]bool, depth int, texts map[string]string) ([]*filelock.Lock, error) {
+	locks := []*filelock.Lock{}
+	if depth >= maxIncludeDepth {
+		logger.Warn("Not following includes deeper than %d levels from %s", depth, src.Path)
+		return locks, nil
+	}
+	homeDir, _ := os.UserHomeDir()
+	for _, node := range src.Doc.Find(NodeSource) {
+		for _, path := range resolveInclude(node, homeDir) {
+			key := includeKey(path)
+			if seen[key] {
+				continue
+			}
+			lock, err := filelock.Shared(path)
+			if err != nil {
+				return locks, err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				lock.Release()
+				logger.Warn("Failed to read sourced file %s: %v", path, err)
+				continue
+			}
+			locks = append(locks, lock)
+			seen[key] = true
+			text := string(content)
+			if override, ok := texts[path]; ok {
+				text = override
+			}
+			child := &Source{
+				Path:     path,
+				Line:     node.Line,
+				Parent:   src,
+				Doc:      c.Dialect.Parse(text),
+				Guard:    nodeRef{src, node}.guard(),
+				include:  node,
+				original: string(content),
+			}
+			child.inheritGuard()
+			src.Children = append(src.Children, child)
+			logger.Debug("Following include %s from %s:%d", path, src.Path, node.Line)
+			childLocks, err := c.loadIncludes(child, seen, depth+1, texts)
+			locks = append(locks, childLocks...)
+			if err != nil {
+				return locks, err
+			}
+		}
+	}
+	return locks, nil
+}
+
+// includeKey identifies the file at path for cycle detection, so a file
+// reached through a symlink or a relative path counts as the same file.
+func includeKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// inheritGuard nests the outermost guards of a conditionally sourced file
+// under the condition that sources it.
+func (s *Source) inheritGuard() {
+	if s.Guard == nil {
+		return
+	}
+	for _, node := range s.Doc.Nodes {
+		guard := node.Guard
+		for guard != nil && guard.Parent != nil {
+			guard = guard.Parent
+		}
+		if guard != nil && guard != s.Guard {
+			guard.Parent = s.Guard
+		}
+	}
+}
+
+// resolveInclude expands the target of a source node into file paths. Only
+// ~ and home-related variables are expanded, since other variables depend on
+// state the shell builds at runtime. Relative paths are taken from the home
+// directory, where login shells start.
+func resolveInclude(node *Node, homeDir string) []string {
+	target := expandInclude(node.Name, homeDir)
+	if target == "" {
+		return nil
+	}
+
+	if !strings.ContainsAny(target, "*?[") {
+		if info, err := os.Stat(target); err != nil || info.IsDir() {
+			return nil
+		}
+		return []string{target}
+	}
+	matches, err := filepath.Glob(target)
+	if err != nil || len(matches) == 0 {
+		return nil
+	}
+	// A glob passed straight to source only sources its first match; the
+	// rest become positional parameters. Loops source every match.
+	if node.Keyword != "for" {
+		return matches[:1]
+	}
+	return matches
+}
+
+// expandInclude turns the target of a source command into an absolute path,
+// or returns an empty string if it depends on other variables.
+func expandInclude(target, homeDir string) string {
+	if target == "~" || strings.HasPrefix(target, "~/") {
+		target = homeDir + target[1:]
+	}
+
+	resolved := true
+	target = os.Expand(target, func(name string) string {
+		switch name {
+		case "HOME":
+			return homeDir
+		case "XDG_CONFIG_HOME":
+			if value := os.Getenv(name); value != "" {
+				return value
+			}
+			return filepath.Join(homeDir, ".config")
+		case "ZDOTDIR":
+			if value := os.Getenv(name); value != "" {
+				return value
+			}
+			return homeDir
+		}
+		resolved = false
+		return ""
+	})
+	if !resolved || target == "" {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(homeDir, target)
+	}
+	return target
+}
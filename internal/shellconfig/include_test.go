@@ -0,0 +1,167 @@
+package shellconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btassone/swiss-linux-knife/internal/filelock"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadFollowsIncludes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFiles(t, home, map[string]string{
+		".zshrc": "export EDITOR=vim\nsource ~/.zsh/aliases.zsh\n. $HOME/.work_env\n" +
+			"for f in ~/.zsh/conf.d/*.zsh; do source \"$f\"; done\nsource $ZSH/oh-my-zsh.sh\n",
+		".zsh/aliases.zsh":     "alias ll='ls -la'\nsource ~/.zshrc\n",
+		".work_env":            "export EDITOR=\"nvim\"\nexport WORK=1\n",
+		".zsh/conf.d/a.zsh":    "alias ga='git add'\n",
+		".zsh/conf.d/b.zsh":    "alias gb='git branch'\n",
+		".zsh/conf.d/notes.md": "alias nope='no'\n",
+	})
+
+	config := NewForFile(filepath.Join(home, ".zshrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	files := config.Sources().Files()
+	if len(files) != 5 {
+		t.Fatalf("Expected root and 4 included files, got %d", len(files))
+	}
+	if files[1].Path != filepath.Join(home, ".zsh/aliases.zsh") || files[1].Line != 2 || files[1].Parent != files[0] {
+		t.Errorf("Unexpected first include: %s from line %d", files[1].Path, files[1].Line)
+	}
+
+	if config.Exports["EDITOR"] != "nvim" {
+		t.Errorf("Expected later include to win for EDITOR, got %q", config.Exports["EDITOR"])
+	}
+	for _, name := range []string{"ll", "ga", "gb"} {
+		if _, ok := config.Aliases[name]; !ok {
+			t.Errorf("Expected alias %s from included file", name)
+		}
+	}
+	if _, ok := config.Aliases["nope"]; ok {
+		t.Error("Expected glob to only match .zsh files")
+	}
+
+	origin, ok := config.Origin(NodeExport, "EDITOR")
+	if !ok || origin.Path != filepath.Join(home, ".work_env") || origin.Line != 1 {
+		t.Errorf("Unexpected origin for EDITOR: %+v", origin)
+	}
+	origin, _ = config.Origin(NodeAlias, "gb")
+	if origin.Path != filepath.Join(home, ".zsh/conf.d/b.zsh") {
+		t.Errorf("Unexpected origin for gb: %+v", origin)
+	}
+}
+
+func TestLoadLocksIncludedFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	defer func(timeout time.Duration) { filelock.Timeout = timeout }(filelock.Timeout)
+	filelock.Timeout = 100 * time.Millisecond
+	writeTestFiles(t, home, map[string]string{
+		".bashrc":       "source ~/.bash_aliases\n",
+		".bash_aliases": "alias ll='ls -la'\n",
+	})
+
+	lock, err := filelock.Exclusive(filepath.Join(home, ".bash_aliases"))
+	if err != nil {
+		t.Fatalf("Failed to lock the included file: %v", err)
+	}
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	if err := config.Load(); !errors.Is(err, filelock.ErrLocked) {
+		t.Errorf("Expected loading to wait for the writer of the included file, got %v", err)
+	}
+	lock.Release()
+	if err := config.Load(); err != nil || config.Aliases["ll"] != "ls -la" {
+		t.Errorf("Expected the included file to load once unlocked, got %v", err)
+	}
+}
+
+func TestSaveWritesToDefiningFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	rootContent := "source ~/.zsh/aliases.zsh\n"
+	writeTestFiles(t, home, map[string]string{
+		".zshrc":           rootContent,
+		".zsh/aliases.zsh": "alias ll='ls -la'\nalias gs='git status'\n",
+	})
+
+	config := NewForFile(filepath.Join(home, ".zshrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Aliases["gs"] = "git status -sb"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	aliases, _ := os.ReadFile(filepath.Join(home, ".zsh/aliases.zsh"))
+	if string(aliases) != "alias ll='ls -la'\nalias gs='git status -sb'\n" {
+		t.Errorf("Expected edit in aliases.zsh, got:\n%s", aliases)
+	}
+	root, _ := os.ReadFile(filepath.Join(home, ".zshrc"))
+	if string(root) != rootContent {
+		t.Errorf("Expected root file untouched, got:\n%s", root)
+	}
+
+	config.Aliases["gd"] = "git diff"
+	origin, _ := config.Origin(NodeAlias, "gd")
+	if origin.Path != filepath.Join(home, ".zshrc") || origin.Line != 0 {
+		t.Errorf("Expected new alias to go to the root file, got %+v", origin)
+	}
+}
+
+func TestParseSourceLoops(t *testing.T) {
+	for _, line := range []string{
+		`for f in ~/.zsh/conf.d/*.zsh; do source "$f"; done`,
+		Zsh.FormatSourceLoop("~/.zsh/conf.d/*.zsh"),
+	} {
+		nodes := Zsh.Parse(line + "\n").Find(NodeSource)
+		if len(nodes) != 1 || nodes[0].Keyword != "for" || nodes[0].Name != "~/.zsh/conf.d/*.zsh" {
+			t.Errorf("Expected %q to source the glob, got %d sources", line, len(nodes))
+		}
+	}
+	line := `for f in ~/.zsh/conf.d/*.zsh; do . "$f"; done; unset g`
+	if nodes := Zsh.Parse(line + "\n").Find(NodeSource); len(nodes) != 0 {
+		t.Errorf("Expected a loop unsetting another variable not to be a source, got %d", len(nodes))
+	}
+}
+
+func TestIncludeCycleThroughSymlinkedRoot(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestFiles(t, home, map[string]string{
+		"dotfiles/zshrc":       "source ~/dotfiles/aliases.zsh\n",
+		"dotfiles/aliases.zsh": "alias ll='ls -la'\nsource ~/dotfiles/zshrc\n",
+	})
+	if err := os.Symlink(filepath.Join(home, "dotfiles", "zshrc"), filepath.Join(home, ".zshrc")); err != nil {
+		t.Fatalf("Failed to link config: %v", err)
+	}
+
+	config := NewForFile(filepath.Join(home, ".zshrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if files := config.Sources().Files(); len(files) != 2 {
+		t.Errorf("Expected the linked root not to be loaded again, got %d files", len(files))
+	}
+}
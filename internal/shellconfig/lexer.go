@@ -0,0 +1,462 @@
+package shellconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// QuoteStyle records how a value was quoted so edits can be written back in
+// the same style.
+type QuoteStyle int
+
+const (
+	QuoteDefault QuoteStyle = iota
+	QuoteNone
+	QuoteSingle
+	QuoteDouble
+)
+
+// wordPart is a run of a shell word sharing one kind of quoting. quote is 0
+// for unquoted text, '\'' or '"' for quoted text and '$' for $'...' strings;
+// text is the raw content between the quotes.
+type wordPart struct {
+	quote byte
+	text  string
+}
+
+type word struct {
+	raw   string
+	parts []wordPart
+}
+
+const metaChars = ";&|<>()"
+
+var (
+	identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	bareValueRegex  = regexp.MustCompile(`^(?:[\w@%+=:,./-]|\$\w+|\$\{\w+\})+$`)
+	bareAliasRegex  = regexp.MustCompile(`^[\w@%+=:,./~-]+$`)
+)
+
+// lexWords splits a line into shell words, stopping at the first unquoted
+// metacharacter or comment. rest holds the unconsumed remainder including the
+// whitespace before it.
+func lexWords(line string) ([]word, string, error) {
+	words := []word{}
+	i := 0
+	for {
+		start := i
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			return words, "", nil
+		}
+		if line[i] == '#' || strings.IndexByte(metaChars, line[i]) >= 0 {
+			return words, line[start:], nil
+		}
+
+		w, end, err := lexWord(line, i)
+		if err != nil {
+			return nil, "", err
+		}
+		words = append(words, w)
+		i = end
+	}
+}
+
+func lexWord(line string, i int) (word, int, error) {
+	start := i
+	w := word{}
+	var unquoted strings.Builder
+	flush := func() {
+		if unquoted.Len() > 0 {
+			w.parts = append(w.parts, wordPart{text: unquoted.String()})
+			unquoted.Reset()
+		}
+	}
+
+	for i < len(line) {
+		c := line[i]
+		if c == ' ' || c == '\t' || strings.IndexByte(metaChars, c) >= 0 {
+			break
+		}
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return w, 0, fmt.Errorf("unterminated single quote at column %d", i+1)
+			}
+			flush()
+			w.parts = append(w.parts, wordPart{quote: '\'', text: line[i+1 : i+1+end]})
+			i += end + 2
+		case c == '$' && i+1 < len(line) && line[i+1] == '\'':
+			end, err := scanQuoted(line, i+2, '\'')
+			if err != nil {
+				return w, 0, err
+			}
+			flush()
+			w.parts = append(w.parts, wordPart{quote: '$', text: line[i+2 : end]})
+			i = end + 1
+		case c == '"':
+			end, err := scanQuoted(line, i+1, '"')
+			if err != nil {
+				return w, 0, err
+			}
+			flush()
+			w.parts = append(w.parts, wordPart{quote: '"', text: line[i+1 : end]})
+			i = end + 1
+		case c == '\\':
+			if i+1 >= len(line) {
+				return w, 0, fmt.Errorf("trailing backslash")
+			}
+			unquoted.WriteString(line[i : i+2])
+			i += 2
+		case c == '`' || (c == '$' && i+1 < len(line) && (line[i+1] == '(' || line[i+1] == '{')):
+			end, err := skipExpansion(line, i)
+			if err != nil {
+				return w, 0, err
+			}
+			unquoted.WriteString(line[i:end])
+			i = end
+		default:
+			unquoted.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	w.raw = line[start:i]
+	return w, i, nil
+}
+
+// scanQuoted returns the index of the closing quote for a string starting at
+// i, honouring backslash escapes and, inside double quotes, expansions.
+func scanQuoted(line string, i int, quote byte) (int, error) {
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == '\\':
+			i += 2
+		case c == quote:
+			return i, nil
+		case quote == '"' && (c == '`' || (c == '$' && i+1 < len(line) && (line[i+1] == '(' || line[i+1] == '{'))):
+			end, err := skipExpansion(line, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return 0, fmt.Errorf("unterminated %c quote", quote)
+}
+
+// skipExpansion returns the index just past a $(...), ${...} or `...`
+// expansion starting at i.
+func skipExpansion(line string, i int) (int, error) {
+	if line[i] == '`' {
+		for j := i + 1; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+			} else if line[j] == '`' {
+				return j + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated command substitution")
+	}
+
+	open, close := line[i+1], byte(')')
+	if open == '{' {
+		close = '}'
+	}
+	depth := 0
+	for j := i + 1; j < len(line); j++ {
+		switch c := line[j]; {
+		case c == '\\':
+			j++
+		case c == '\'':
+			end := strings.IndexByte(line[j+1:], '\'')
+			if end < 0 {
+				return 0, fmt.Errorf("unterminated single quote")
+			}
+			j += end + 1
+		case c == '"':
+			end, err := scanQuoted(line, j+1, '"')
+			if err != nil {
+				return 0, err
+			}
+			j = end
+		case c == open:
+			depth++
+		case c == close:
+			depth--
+			if depth == 0 {
+				return j + 1, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated expansion")
+}
+
+// literal decodes a word into the string the shell would see if it performed
+// no expansions.
+func (w word) literal() string {
+	var sb strings.Builder
+	for _, part := range w.parts {
+		switch part.quote {
+		case '\'':
+			sb.WriteString(part.text)
+		case '$':
+			sb.WriteString(decodeANSI(part.text))
+		case '"':
+			sb.WriteString(unescape(part.text, "$`\"\\\n"))
+		default:
+			sb.WriteString(unescape(part.text, ""))
+		}
+	}
+	return sb.String()
+}
+
+// expandable converts a word into the form values are edited in: the text
+// between double quotes with expansions left live, literal $, ` and \
+// backslash-escaped, and double quotes left bare. quoteValue escapes the
+// quotes again when writing.
+func (w word) expandable() string {
+	var sb strings.Builder
+	for _, part := range w.parts {
+		switch part.quote {
+		case '\'':
+			sb.WriteString(escapeExpansions(part.text))
+		case '$':
+			sb.WriteString(escapeExpansions(decodeANSI(part.text)))
+		default:
+			for i := 0; i < len(part.text); i++ {
+				c := part.text[i]
+				if c == '\\' && i+1 < len(part.text) {
+					next := part.text[i+1]
+					switch {
+					case next == '"':
+						i++
+						c = next
+					case strings.IndexByte("$`\\", next) >= 0:
+						sb.WriteByte(c)
+						i++
+						c = next
+					case part.quote == 0:
+						// Outside quotes a backslash makes any character literal.
+						i++
+						c = next
+					}
+				}
+				sb.WriteByte(c)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// style reports the quoting used by a word's parts.
+func (w word) style() QuoteStyle {
+	style := QuoteNone
+	for _, part := range w.parts {
+		switch part.quote {
+		case '\'', '$':
+			if style == QuoteNone {
+				style = QuoteSingle
+			}
+		case '"':
+			style = QuoteDouble
+		}
+	}
+	return style
+}
+
+// splitAssignment splits NAME=value. The name must be unquoted; valid
+// reports whether it is acceptable to the caller.
+func (w word) splitAssignment(valid func(string) bool) (string, word, bool) {
+	if len(w.parts) == 0 || w.parts[0].quote != 0 {
+		return "", word{}, false
+	}
+	eq := strings.IndexByte(w.parts[0].text, '=')
+	if eq <= 0 || !valid(w.parts[0].text[:eq]) {
+		return "", word{}, false
+	}
+	value := word{raw: w.raw[eq+1:]}
+	if rest := w.parts[0].text[eq+1:]; rest != "" {
+		value.parts = append(value.parts, wordPart{text: rest})
+	}
+	value.parts = append(value.parts, w.parts[1:]...)
+	return w.parts[0].text[:eq], value, true
+}
+
+func isIdentifier(name string) bool {
+	return identifierRegex.MatchString(name)
+}
+
+// isAliasName accepts the names bash and zsh allow for aliases, which
+// include things like "..", "g-" and "l.".
+func isAliasName(name string) bool {
+	return !strings.ContainsAny(name, "/$`=\\'\" \t"+metaChars)
+}
+
+func unescape(text, escapable string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && (escapable == "" || strings.IndexByte(escapable, text[i+1]) >= 0) {
+			i++
+			if text[i] == '\n' {
+				continue
+			}
+		}
+		sb.WriteByte(text[i])
+	}
+	return sb.String()
+}
+
+func escapeExpansions(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("$`\\", r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// decodeANSI decodes the escapes of a $'...' string.
+func decodeANSI(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 >= len(text) {
+			sb.WriteByte(text[i])
+			continue
+		}
+		i++
+		switch c := text[i]; c {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'e', 'E':
+			sb.WriteByte(0x1b)
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'x', 'u', 'U':
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+			j := i + 1
+			for j < len(text) && j < i+1+size && strings.IndexByte("0123456789abcdefABCDEF", text[j]) >= 0 {
+				j++
+			}
+			if n, err := strconv.ParseUint(text[i+1:j], 16, 32); err == nil {
+				if c == 'x' {
+					sb.WriteByte(byte(n))
+				} else {
+					sb.WriteRune(rune(n))
+				}
+				i = j - 1
+			} else {
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(text) && j < i+3 && text[j] >= '0' && text[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(text[i:j], 8, 8)
+			sb.WriteByte(byte(n))
+			i = j - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// quoteValue writes a double-quote form value, preferring style. A leading ~
+// stays unquoted so tilde expansion still happens.
+func quoteValue(value string, style QuoteStyle) string {
+	prefix := ""
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		prefix, value = "~", value[1:]
+		if value == "" {
+			return prefix
+		}
+	}
+	switch style {
+	case QuoteNone:
+		if bareValueRegex.MatchString(value) {
+			return prefix + value
+		}
+	case QuoteSingle:
+		if literal, ok := literalOf(value); ok && !strings.Contains(literal, "'") {
+			return prefix + "'" + literal + "'"
+		}
+	}
+	return prefix + `"` + closeDQ(value) + `"`
+}
+
+// closeDQ escapes any unescaped double quote and a dangling backslash so the
+// value cannot end the surrounding quotes early.
+func closeDQ(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value):
+			sb.WriteByte(c)
+			i++
+			sb.WriteByte(value[i])
+		case c == '\\' || c == '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// literalOf returns the literal text of a double-quote form value when it
+// contains no live expansions.
+func literalOf(value string) (string, bool) {
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '$', '`':
+			return "", false
+		}
+	}
+	return unescape(value, "$`\\"), true
+}
+
+// quoteLiteral writes a literal string such as an alias body so the shell
+// reads back exactly the same text, preferring style.
+func quoteLiteral(value string, style QuoteStyle) string {
+	switch style {
+	case QuoteNone:
+		if bareAliasRegex.MatchString(value) {
+			return value
+		}
+	case QuoteDouble:
+		if !strings.ContainsAny(value, "$`\"\\!") {
+			return `"` + value + `"`
+		}
+	}
+	if value == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,112 @@
+package shellconfig
+
+import (
+	"testing"
+)
+
+func TestLexWords(t *testing.T) {
+	words, rest, err := lexWords(`export A="x y" B='$q' C=$'a\tb' D=$(echo "1 2") # note`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(words) != 5 {
+		t.Fatalf("Expected 5 words, got %d", len(words))
+	}
+	if rest != " # note" {
+		t.Errorf("Expected comment as rest, got %q", rest)
+	}
+	want := []string{"export", "A=x y", "B=$q", "C=a\tb", `D=$(echo "1 2")`}
+	for i, w := range want {
+		if got := words[i].literal(); got != w {
+			t.Errorf("Word %d: expected %q, got %q", i, w, got)
+		}
+	}
+
+	if _, _, err := lexWords(`alias x='unterminated`); err == nil {
+		t.Error("Expected error for unterminated quote")
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	cases := []struct {
+		line  string
+		kind  NodeKind
+		names []string
+		value string
+	}{
+		{`export A=1 B=2`, NodeExport, []string{"A", "B"}, "2"},
+		{`typeset -x EDITOR='nvim'`, NodeExport, []string{"EDITOR"}, "nvim"},
+		{`declare -gx GOPATH="$HOME/go"`, NodeExport, []string{"GOPATH"}, "$HOME/go"},
+		{`export LITERAL='$HOME'`, NodeExport, []string{"LITERAL"}, `\$HOME`},
+		{`export MSG=$'it\'s'`, NodeExport, []string{"MSG"}, "it's"},
+		{`export GREETING="say \"hi\""`, NodeExport, []string{"GREETING"}, `say "hi"`},
+		{`alias g-='git checkout -'`, NodeAlias, []string{"g-"}, "git checkout -"},
+		{`alias ..='cd ..' ...='cd ../..'`, NodeAlias, []string{"..", "..."}, "cd ../.."},
+		{`alias gs=git\ status`, NodeAlias, []string{"gs"}, "git status"},
+		{`alias -g G='| grep'`, NodeAlias, []string{"G"}, "| grep"},
+		{`HISTSIZE=10000`, NodeVariable, []string{"HISTSIZE"}, "10000"},
+	}
+	for _, tc := range cases {
+		nodes := parseAssignments(tc.line)
+		if len(nodes) != len(tc.names) {
+			t.Errorf("%s: expected %d nodes, got %d", tc.line, len(tc.names), len(nodes))
+			continue
+		}
+		for i, name := range tc.names {
+			if nodes[i].Kind != tc.kind || nodes[i].Name != name {
+				t.Errorf("%s: expected %s %s, got %s %s", tc.line, tc.kind, name, nodes[i].Kind, nodes[i].Name)
+			}
+		}
+		if last := nodes[len(nodes)-1]; last.Value != tc.value {
+			t.Errorf("%s: expected value %q, got %q", tc.line, tc.value, last.Value)
+		}
+	}
+
+	for _, line := range []string{`FOO=1 make`, `export PATH`, `typeset -U path`, `alias -s md=vim`, `export A=1; echo hi`} {
+		if nodes := parseAssignments(line); nodes != nil {
+			t.Errorf("Expected %q to stay raw, got %d nodes", line, len(nodes))
+		}
+	}
+}
+
+func TestQuotingRoundTrip(t *testing.T) {
+	aliases := []string{"ls -la", "echo 'quoted'", `printf "%s\n" $1`, "it's", "", `back\slash`, "a'b\"c$d`e"}
+	for _, value := range aliases {
+		for _, style := range []QuoteStyle{QuoteDefault, QuoteNone, QuoteSingle, QuoteDouble} {
+			line := Zsh.Render(&Node{Kind: NodeAlias, Name: "x", Value: value, Quote: style})
+			nodes := parseAssignments(line)
+			if len(nodes) != 1 || nodes[0].Value != value {
+				t.Errorf("Alias %q with style %d rendered as %s did not round trip", value, style, line)
+			}
+		}
+	}
+
+	exports := []string{"$HOME/bin:$PATH", `say "hi"`, `literal \$ sign`, "~/go", "~", "a b", `trailing\`, "$(date +%s)"}
+	for _, value := range exports {
+		for _, style := range []QuoteStyle{QuoteDefault, QuoteNone, QuoteSingle, QuoteDouble} {
+			line := Bash.Render(&Node{Kind: NodeExport, Name: "X", Value: value, Quote: style})
+			nodes := parseAssignments(line)
+			want := value
+			if value == `trailing\` {
+				want = `trailing\\`
+			}
+			if len(nodes) != 1 || nodes[0].Value != want {
+				t.Errorf("Export %q with style %d rendered as %s did not round trip", value, style, line)
+			}
+		}
+	}
+}
+
+func TestEditSharedLine(t *testing.T) {
+	doc := Zsh.Parse("export A=1 B=2 # both\n")
+	nodes := doc.Find(NodeExport)
+	nodes[1].set("two words")
+	if got := doc.String(); got != "export A=1 B=\"two words\" # both\n" {
+		t.Errorf("Unexpected render after edit: %q", got)
+	}
+
+	doc.Remove(nodes[0])
+	if got := doc.String(); got != "export B=\"two words\" # both\n" {
+		t.Errorf("Unexpected render after removal: %q", got)
+	}
+}
@@ -0,0 +1,20 @@
+package shellconfig
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain points the backup store and lock files at temporary directories
+// so saves made by tests leave the user's snapshots and locks alone.
+func TestMain(m *testing.M) {
+	state, err := os.MkdirTemp("", "shellconfig-state")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_STATE_HOME", state)
+	os.Setenv("XDG_RUNTIME_DIR", state)
+	code := m.Run()
+	os.RemoveAll(state)
+	os.Exit(code)
+}
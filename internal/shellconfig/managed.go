@@ -0,0 +1,200 @@
+package shellconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WriteMode selects which part of the root file a config reads and writes.
+type WriteMode int
+
+const (
+	// WriteInPlace edits entries wherever they are defined.
+	WriteInPlace WriteMode = iota
+	// WriteManagedBlock reads and writes only the lines between ManagedStart
+	// and ManagedEnd, leaving the rest of the file byte for byte as it is.
+	// The block is added at the end of the file when it is first needed.
+	WriteManagedBlock
+	// WriteDropIn writes each category of entries to a file of its own in
+	// DropInDir and keeps a single loop sourcing them in the root file. The
+	// loop is added when the first drop-in file gets content.
+	WriteDropIn
+)
+
+// Markers around the managed block.
+const (
+	ManagedStart = "# >>> swiss-linux-knife >>>"
+	ManagedEnd   = "# <<< swiss-linux-knife <<<"
+)
+
+// managedBlock is the text of the root file around the part a config writes:
+// the lines between the markers, or the loader line in WriteDropIn mode. The
+// marker lines are kept as found so that their spacing survives a save.
+type managedBlock struct {
+	before, after string
+	start, end    string
+	found         bool
+
+	// glob is the pattern the loader line sources, with the dialect used to
+	// recognise the line. It is empty for a block between markers.
+	glob    string
+	dialect Dialect
+}
+
+// split separates text the same way b was.
+func (b *managedBlock) split(text string) (*managedBlock, string) {
+	if b.glob != "" {
+		return splitLoader(text, b.dialect, b.glob)
+	}
+	return splitManaged(text)
+}
+
+// splitManaged separates text into the lines around the managed block and
+// the content of the block.
+func splitManaged(text string) (*managedBlock, string) {
+	b := &managedBlock{before: text, start: ManagedStart, end: ManagedEnd, after: "\n"}
+	offset, startAt, contentAt := 0, -1, 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		marker := strings.TrimSpace(line)
+		switch {
+		case startAt < 0 && marker == ManagedStart:
+			startAt, contentAt = offset, offset+len(line)
+			b.start = strings.TrimSuffix(line, "\n")
+		case startAt >= 0 && marker == ManagedEnd:
+			b.end = strings.TrimSuffix(line, "\n")
+			b.before = text[:startAt]
+			b.after = text[offset+len(b.end):]
+			b.found = true
+			return b, text[contentAt:offset]
+		}
+		offset += len(line)
+	}
+	return b, ""
+}
+
+// prefix returns the file up to and including the start marker. A new block
+// is separated from the existing content by a blank line.
+func (b *managedBlock) prefix() string {
+	before := b.before
+	if !b.found && before != "" {
+		if !strings.HasSuffix(before, "\n") {
+			before += "\n"
+		}
+		if !strings.HasSuffix(before, "\n\n") {
+			before += "\n"
+		}
+	}
+	if b.start == "" {
+		return before
+	}
+	return before + b.start + "\n"
+}
+
+// render returns the file with content in the block. A file that never had
+// a block gets none while the block would be empty.
+func (b *managedBlock) render(content string) string {
+	if !b.found && content == "" {
+		return b.before
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") && b.end != "" {
+		content += "\n"
+	}
+	return b.prefix() + content + b.end + b.after
+}
+
+// outside parses the text before and after the block.
+func (c *Config) outside() []*Document {
+	return []*Document{c.Dialect.Parse(c.block.before), c.Dialect.Parse(c.block.after)}
+}
+
+// migratable are the kinds of entries that can be moved into the block or
+// the drop-in files.
+var migratable = []NodeKind{NodeAlias, NodeExport, NodeVariable, NodeFunction}
+
+// Unmanaged returns the names of the aliases, exports, variables and
+// functions defined outside the managed block or, in WriteDropIn mode, in the
+// root file itself, sorted and grouped by kind. Entries under a condition are
+// left out since they cannot be moved without their block. It returns nil in
+// WriteInPlace mode.
+func (c *Config) Unmanaged() map[NodeKind][]string {
+	if c.block == nil {
+		return nil
+	}
+	names := make(map[NodeKind][]string)
+	seen := make(map[entryKey]bool)
+	for _, doc := range c.outside() {
+		for _, kind := range migratable {
+			for _, node := range doc.Find(kind) {
+				key := entryKey{kind, node.Name}
+				if node.Guard == nil && !seen[key] {
+					names[kind] = append(names[kind], node.Name)
+					seen[key] = true
+				}
+			}
+		}
+	}
+	for _, list := range names {
+		sort.Strings(list)
+	}
+	return names
+}
+
+// Migrate moves the unconditional definitions of a named entry from outside
+// the managed block into it, or into its drop-in file, along with the
+// comments describing them. The last definition outside sets the value, as
+// it would in the shell.
+func (c *Config) Migrate(kind NodeKind, name string) error {
+	if c.block == nil {
+		return fmt.Errorf("%s is not edited through a managed block or drop-in files", ShortPath(c.FilePath))
+	}
+	docs := c.outside()
+	texts := []*string{&c.block.before, &c.block.after}
+	value, description, found := "", "", false
+	changed := make([]bool, len(docs))
+	for i, doc := range docs {
+		for _, node := range doc.Find(kind) {
+			if node.Guard != nil || node.Name != name {
+				continue
+			}
+			value, found, changed[i] = node.Value, true, true
+			if text := doc.description(node); text != "" {
+				description = text
+			}
+			if node.group == nil {
+				for _, comment := range doc.leadingComments(node) {
+					doc.Remove(comment)
+				}
+			}
+			doc.Remove(node)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s %s is not defined outside the managed entries", kind, name)
+	}
+
+	switch kind {
+	case NodeAlias:
+		c.Aliases[name] = value
+	case NodeExport:
+		c.Exports[name] = value
+	case NodeVariable:
+		c.Variables[name] = value
+	case NodeFunction:
+		if _, exists := c.Function(name); exists {
+			c.RemoveFunction(name)
+		}
+		c.CustomFunctions = append(c.CustomFunctions, value)
+	default:
+		return fmt.Errorf("cannot move %s entries", kind)
+	}
+	for i, doc := range docs {
+		if changed[i] {
+			*texts[i] = doc.String()
+		}
+	}
+	if description != "" {
+		c.SetDescription(kind, name, description)
+	}
+	return nil
+}
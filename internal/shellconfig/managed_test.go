@@ -0,0 +1,103 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManagedBlockLeavesRestOfFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	original := "# my setup\nexport EDITOR=vim   # keep this spacing\nalias ll='ls -la'\n[[ -f ~/.local.zsh ]] && source ~/.local.zsh"
+	os.WriteFile(path, []byte(original), 0644)
+
+	config := NewForFile(path)
+	config.Mode = WriteManagedBlock
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(config.Aliases) != 0 || len(config.Exports) != 0 {
+		t.Errorf("Expected only the block to be read, got %v and %v", config.Aliases, config.Exports)
+	}
+	if changes := config.Changes(); len(changes) != 0 {
+		t.Fatalf("Expected no block to be added without entries, got:\n%s", changes[0].Unified())
+	}
+
+	config.Aliases["gs"] = "git status"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	want := original + "\n\n" + ManagedStart + "\n# Aliases\nalias gs='git status'\n" + ManagedEnd + "\n"
+	if string(content) != want {
+		t.Fatalf("Expected the block appended after the file, got:\n%s", content)
+	}
+
+	config = NewForFile(path)
+	config.Mode = WriteManagedBlock
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.Aliases["gs"] != "git status" || len(config.Aliases) != 1 {
+		t.Errorf("Expected the block's alias only, got %v", config.Aliases)
+	}
+	if origin, _ := config.Origin(NodeAlias, "gs"); origin.Line != 8 {
+		t.Errorf("Expected the origin to count the lines before the block, got %+v", origin)
+	}
+	config.Aliases["gs"] = "git status -sb"
+	config.Exports["PAGER"] = "less"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	if !strings.HasPrefix(string(content), original+"\n\n"+ManagedStart+"\n") || !strings.HasSuffix(string(content), ManagedEnd+"\n") {
+		t.Errorf("Expected the text around the block to be untouched, got:\n%s", content)
+	}
+	if !strings.Contains(string(content), "alias gs='git status -sb'\n") || !strings.Contains(string(content), "export PAGER=\"less\"\n") {
+		t.Errorf("Expected the edits inside the block, got:\n%s", content)
+	}
+}
+
+func TestMigrateIntoManagedBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	original := "export EDITOR=vim\n\n# List everything\nalias ll='ls -la'\n\nif [ -d ~/go ]; then\n    alias gob='go build'\nfi\n\n" +
+		ManagedStart + "\nalias gs='git status'\n" + ManagedEnd + "\n\nalias ll='ls -lah'\n"
+	os.WriteFile(path, []byte(original), 0644)
+
+	config := NewForFile(path)
+	config.Mode = WriteManagedBlock
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got := config.Document().String(); got != "alias gs='git status'\n" {
+		t.Errorf("Expected the block content, got %q", got)
+	}
+	unmanaged := config.Unmanaged()
+	if len(unmanaged[NodeAlias]) != 1 || unmanaged[NodeAlias][0] != "ll" || len(unmanaged[NodeExport]) != 1 {
+		t.Errorf("Expected ll and EDITOR outside the block, got %v", unmanaged)
+	}
+
+	if err := config.Migrate(NodeAlias, "ll"); err != nil {
+		t.Fatalf("Failed to migrate alias: %v", err)
+	}
+	if err := config.Migrate(NodeAlias, "gob"); err == nil {
+		t.Error("Expected conditional entries to stay where they are")
+	}
+	if config.Aliases["ll"] != "ls -lah" || config.Description(NodeAlias, "ll") != "List everything" {
+		t.Errorf("Expected the last definition and its description, got %q / %q", config.Aliases["ll"], config.Description(NodeAlias, "ll"))
+	}
+	config.Record("Move alias ll into managed block")
+
+	want := "export EDITOR=vim\n\n\nif [ -d ~/go ]; then\n    alias gob='go build'\nfi\n\n" +
+		ManagedStart + "\nalias gs='git status'\nalias ll='ls -lah' # List everything\n" + ManagedEnd + "\n\n"
+	changes := config.Changes()
+	if len(changes) != 1 || changes[0].Content() != want {
+		t.Fatalf("Unexpected migrated file:\n%s", changes[0].Content())
+	}
+
+	config.Undo()
+	if config.Modified() || len(config.Unmanaged()[NodeAlias]) != 1 {
+		t.Error("Expected undo to put the alias back outside the block")
+	}
+}
@@ -0,0 +1,323 @@
+package shellconfig
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// uniquePathRegex matches zsh's typeset -U path, which drops every later
+// duplicate from PATH.
+var uniquePathRegex = regexp.MustCompile(`^\s*(?:typeset|declare)\s+-[a-zA-Z]*U[a-zA-Z]*\s+(?:\w+\s+)*path\b`)
+
+// PathList is the PATH a config builds with its unconditional assignments,
+// as the directories it puts before and after the PATH the shell inherited.
+// Directories are kept as written, such as $HOME/bin.
+type PathList struct {
+	Prepend []string
+	Append  []string
+	// Inherited is false when an assignment replaces PATH without referring
+	// to the PATH before it. Every directory is then in Prepend.
+	Inherited bool
+	// Unique is set when typeset -U path drops duplicates.
+	Unique bool
+}
+
+// Dirs returns the directories in the order the shell searches them, with
+// $PATH standing for the inherited PATH.
+func (l PathList) Dirs() []string {
+	dirs := slices.Clone(l.Prepend)
+	if l.Inherited {
+		dirs = append(dirs, "$PATH")
+	}
+	return append(dirs, l.Append...)
+}
+
+// pathAssignment is one assignment to PATH, split around its reference to
+// the PATH before it.
+type pathAssignment struct {
+	ref      nodeRef
+	before   []string
+	after    []string
+	inherits bool
+	// spelling is how the assignment refers to the PATH before it.
+	spelling string
+}
+
+func isPathRef(dir string) bool {
+	return dir == "$PATH" || dir == "${PATH}"
+}
+
+func newPathAssignment(ref nodeRef) *pathAssignment {
+	a := &pathAssignment{ref: ref, spelling: "$PATH"}
+	for _, dir := range strings.Split(ref.node.Value, ":") {
+		switch {
+		case isPathRef(dir) && !a.inherits:
+			a.inherits, a.spelling = true, dir
+		case a.inherits:
+			a.after = append(a.after, dir)
+		default:
+			a.before = append(a.before, dir)
+		}
+	}
+	return a
+}
+
+func (a *pathAssignment) value() string {
+	if !a.inherits {
+		return strings.Join(a.before, ":")
+	}
+	dirs := append(slices.Clone(a.before), a.spelling)
+	return strings.Join(append(dirs, a.after...), ":")
+}
+
+// empty reports whether the assignment no longer changes PATH.
+func (a *pathAssignment) empty() bool {
+	return a.inherits && len(a.before) == 0 && len(a.after) == 0
+}
+
+// pathItem is a directory of the built PATH and the side of the assignment
+// that adds it. index is -1 for the inherited PATH.
+type pathItem struct {
+	dir   string
+	index int
+	after bool
+}
+
+// buildPath runs the assignments in order, starting from the inherited PATH.
+func buildPath(assignments []*pathAssignment) []pathItem {
+	items := []pathItem{{index: -1}}
+	for i, a := range assignments {
+		built := []pathItem{}
+		for _, dir := range a.before {
+			built = append(built, pathItem{dir: dir, index: i})
+		}
+		if a.inherits {
+			built = append(built, items...)
+			for _, dir := range a.after {
+				built = append(built, pathItem{dir: dir, index: i, after: true})
+			}
+		}
+		items = built
+	}
+	return items
+}
+
+// pathList splits built items around the inherited PATH.
+func pathList(items []pathItem, unique bool) PathList {
+	list := PathList{Prepend: []string{}, Append: []string{}, Unique: unique}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		switch {
+		case item.index < 0:
+			list.Inherited = true
+		case unique && seen[item.dir]:
+		case list.Inherited:
+			list.Append = append(list.Append, item.dir)
+		default:
+			list.Prepend = append(list.Prepend, item.dir)
+		}
+		seen[item.dir] = true
+	}
+	return list
+}
+
+// pathAssignments returns the unconditional assignments to PATH in the
+// order they run, and whether PATH drops duplicates.
+func (c *Config) pathAssignments() ([]*pathAssignment, bool) {
+	assignments := []*pathAssignment{}
+	unique := false
+	c.tree().walk(func(src *Source, node *Node) {
+		ref := nodeRef{src, node}
+		if ref.guard() != nil {
+			return
+		}
+		switch {
+		case (node.Kind == NodeExport || node.Kind == NodeVariable) && node.Name == "PATH":
+			assignments = append(assignments, newPathAssignment(ref))
+		case node.Kind == NodeRaw && uniquePathRegex.MatchString(node.Value):
+			unique = true
+		}
+	})
+	return assignments, unique
+}
+
+// Path returns the PATH the config builds.
+func (c *Config) Path() PathList {
+	c.sync()
+	assignments, unique := c.pathAssignments()
+	return pathList(buildPath(assignments), unique)
+}
+
+// SetPath changes the assignments to PATH so that they build list. Each
+// directory stays in the assignment that adds it, and new directories join
+// the assignment of a neighbour, so an edit touches as few lines as it can.
+// Assignments keep their style, whether export PATH=..., zsh's path array
+// or fish_add_path. Only when the order cannot be reached that way are all
+// directories moved into the last assignment.
+func (c *Config) SetPath(list PathList) {
+	c.sync()
+	assignments, unique := c.pathAssignments()
+	if !list.Inherited {
+		list.Prepend = append(slices.Clone(list.Prepend), list.Append...)
+		list.Append = nil
+	}
+	want := list.Dirs()
+
+	placed := c.placePath(assignments, list)
+	if !slices.Equal(pathList(buildPath(placed), unique).Dirs(), want) {
+		placed = c.collapsePath(assignments, list)
+	}
+	c.writePath(placed)
+}
+
+// placePath returns copies of assignments holding the directories of list,
+// with new directories next to a neighbour, or in the last assignment when
+// they have none. A new assignment is only added when there is none yet.
+func (c *Config) placePath(assignments []*pathAssignment, list PathList) []*pathAssignment {
+	placed := []*pathAssignment{}
+	for _, a := range assignments {
+		copied := *a
+		placed = append(placed, &copied)
+	}
+	items := buildPath(assignments)
+	touched := make(map[pathItem][]string)
+	var added *pathAssignment
+
+	place := func(dirs []string, after bool) {
+		old := []pathItem{}
+		for _, item := range items {
+			if item.index >= 0 && item.after == after {
+				old = append(old, item)
+			}
+		}
+		used := make([]bool, len(old))
+		segments := make([]*pathItem, len(dirs))
+		for i, dir := range dirs {
+			for j, item := range old {
+				if !used[j] && item.dir == dir {
+					used[j] = true
+					segment := pathItem{index: item.index, after: after}
+					segments[i] = &segment
+					break
+				}
+			}
+		}
+		for _, item := range old {
+			touched[pathItem{index: item.index, after: after}] = []string{}
+		}
+		for i, dir := range dirs {
+			segment := segments[i]
+			for j := i - 1; segment == nil && j >= 0; j-- {
+				segment = segments[j]
+			}
+			for j := i + 1; segment == nil && j < len(dirs); j++ {
+				segment = segments[j]
+			}
+			if segment == nil && len(placed) > 0 {
+				segment = &pathItem{index: len(placed) - 1, after: after}
+			}
+			if segment == nil {
+				if added == nil {
+					added = &pathAssignment{inherits: true, spelling: "$PATH"}
+				}
+				if after {
+					added.after = append(added.after, dir)
+				} else {
+					added.before = append(added.before, dir)
+				}
+				continue
+			}
+			touched[*segment] = append(touched[*segment], dir)
+		}
+	}
+	place(list.Prepend, false)
+	place(list.Append, true)
+
+	for segment, dirs := range touched {
+		if segment.after {
+			placed[segment.index].after = dirs
+		} else {
+			placed[segment.index].before = dirs
+		}
+	}
+	if added != nil {
+		added.inherits = list.Inherited
+		placed = append(placed, added)
+	}
+	return placed
+}
+
+// collapsePath returns copies of assignments with every directory of list in
+// the last assignment and the others that still shape PATH emptied.
+func (c *Config) collapsePath(assignments []*pathAssignment, list PathList) []*pathAssignment {
+	placed := []*pathAssignment{}
+	for _, a := range assignments {
+		copied := *a
+		placed = append(placed, &copied)
+	}
+	if len(placed) == 0 {
+		placed = append(placed, &pathAssignment{spelling: "$PATH"})
+	}
+	for _, item := range buildPath(assignments) {
+		if item.index >= 0 {
+			placed[item.index].before, placed[item.index].after = nil, nil
+		}
+	}
+	last := placed[len(placed)-1]
+	last.inherits = list.Inherited
+	last.before, last.after = list.Prepend, list.Append
+	return placed
+}
+
+// writePath applies placed assignments to their nodes, adding a node for a
+// new assignment and removing those left empty, and updates the typed
+// fields to match.
+func (c *Config) writePath(placed []*pathAssignment) {
+	for _, a := range placed {
+		switch {
+		case a.empty():
+			if a.ref.node != nil {
+				a.ref.remove()
+			}
+		case a.ref.node == nil:
+			c.appendSection(NodeExport, "Environment Variables", &Node{Kind: NodeExport, Name: "PATH", Value: a.value()})
+		case a.value() != a.ref.node.Value:
+			a.ref.node.set(a.value())
+			fitPathKeyword(a)
+		}
+	}
+
+	for _, kind := range []NodeKind{NodeExport, NodeVariable} {
+		values := c.Exports
+		if kind == NodeVariable {
+			values = c.Variables
+		}
+		delete(values, "PATH")
+		for _, ref := range c.unguarded(kind) {
+			if ref.node.Name == "PATH" {
+				values["PATH"] = ref.node.Value
+			}
+		}
+	}
+}
+
+// fitPathKeyword switches an assignment to a plain one when its keyword can
+// no longer express the value, such as fish_add_path losing its $PATH.
+func fitPathKeyword(a *pathAssignment) {
+	node := a.ref.node
+	switch node.Keyword {
+	case "path+=":
+		if !a.inherits || len(a.before) > 0 {
+			node.Keyword = "path="
+		}
+	case "fish_add_path":
+		if !a.inherits || len(a.after) > 0 {
+			node.Keyword = "set -gx"
+		}
+	case "fish_add_path --append":
+		if !a.inherits || len(a.before) > 0 {
+			node.Keyword = "set -gx"
+		}
+	}
+}
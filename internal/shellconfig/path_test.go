@@ -0,0 +1,135 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func loadPathConfig(t *testing.T, name, content string) (*Config, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, []byte(content), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	return config, path
+}
+
+func TestPathZshArrays(t *testing.T) {
+	config, path := loadPathConfig(t, ".zshrc", "typeset -U path\npath=(~/bin $path)\npath+=(/opt/tools/bin)\nexport PATH=\"$HOME/.cargo/bin:$PATH\"\n")
+
+	list := config.Path()
+	if !slices.Equal(list.Prepend, []string{"$HOME/.cargo/bin", "~/bin"}) || !slices.Equal(list.Append, []string{"/opt/tools/bin"}) {
+		t.Errorf("Expected prepends and appends from every assignment, got %+v", list)
+	}
+	if !list.Inherited || !list.Unique {
+		t.Errorf("Expected an inherited, unique PATH, got %+v", list)
+	}
+
+	list.Prepend = []string{"$HOME/.cargo/bin", "~/.local/bin", "~/bin"}
+	list.Append = []string{}
+	config.SetPath(list)
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	expected := "typeset -U path\npath=(~/bin $path)\nexport PATH=\"$HOME/.cargo/bin:~/.local/bin:$PATH\"\n"
+	if string(content) != expected {
+		t.Errorf("Expected only the assignments that changed to be rewritten, got:\n%s", content)
+	}
+}
+
+func TestPathArrayStyleKept(t *testing.T) {
+	config, path := loadPathConfig(t, ".zshrc", "path=(~/bin $path) # local tools\n")
+
+	config.SetPath(PathList{Prepend: []string{"~/bin"}, Append: []string{"/usr/games"}, Inherited: true})
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "path=(~/bin $path /usr/games) # local tools\n" {
+		t.Errorf("Expected the array assignment to be kept, got:\n%s", content)
+	}
+}
+
+func TestPathReset(t *testing.T) {
+	config, path := loadPathConfig(t, ".bashrc", "export PATH=\"$HOME/bin:$PATH\"\nPATH=/usr/local/bin:/usr/bin\n")
+
+	list := config.Path()
+	if list.Inherited || !slices.Equal(list.Prepend, []string{"/usr/local/bin", "/usr/bin"}) {
+		t.Errorf("Expected the reset to drop the inherited PATH, got %+v", list)
+	}
+
+	list.Prepend = append(list.Prepend, "/bin")
+	config.SetPath(list)
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "export PATH=\"$HOME/bin:$PATH\"\nPATH=/usr/local/bin:/usr/bin:/bin\n" {
+		t.Errorf("Expected the directory added to the reset, got:\n%s", content)
+	}
+}
+
+func TestPathNewAssignment(t *testing.T) {
+	config, path := loadPathConfig(t, ".bashrc", "export EDITOR=vim\n")
+
+	list := config.Path()
+	if !list.Inherited || len(list.Prepend) != 0 || len(list.Append) != 0 {
+		t.Errorf("Expected only the inherited PATH, got %+v", list)
+	}
+	config.SetPath(PathList{Prepend: []string{"$HOME/bin"}, Inherited: true})
+	if config.Exports["PATH"] != "$HOME/bin:$PATH" {
+		t.Errorf("Expected PATH in the exports, got %q", config.Exports["PATH"])
+	}
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "export EDITOR=vim\nexport PATH=\"$HOME/bin:$PATH\"\n" {
+		t.Errorf("Expected a new PATH export, got:\n%s", content)
+	}
+
+	config.SetPath(PathList{Inherited: true})
+	if _, ok := config.Exports["PATH"]; ok {
+		t.Errorf("Expected PATH to be dropped once it adds nothing, got %q", config.Exports["PATH"])
+	}
+}
+
+func TestPathMoveAcrossAssignments(t *testing.T) {
+	config, path := loadPathConfig(t, ".bashrc", "export PATH=\"/a:$PATH\"\nexport PATH=\"/b:$PATH\"\n")
+
+	config.SetPath(PathList{Prepend: []string{"/a", "/b"}, Inherited: true})
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if list := config.Path(); !slices.Equal(list.Prepend, []string{"/a", "/b"}) {
+		t.Errorf("Expected the new order, got %+v", list)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "export PATH=\"/a:/b:$PATH\"\n" {
+		t.Errorf("Expected the directories moved into the last assignment, got:\n%s", content)
+	}
+}
+
+func TestPathFish(t *testing.T) {
+	config, path := loadPathConfig(t, "config.fish", "fish_add_path ~/bin\nset -gx PATH $PATH /opt/bin\n")
+
+	list := config.Path()
+	if !slices.Equal(list.Prepend, []string{"~/bin"}) || !slices.Equal(list.Append, []string{"/opt/bin"}) {
+		t.Errorf("Expected fish_add_path and set to be combined, got %+v", list)
+	}
+
+	list.Prepend = []string{"~/bin", "~/.local/bin"}
+	config.SetPath(list)
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "fish_add_path ~/bin ~/.local/bin\nset -gx PATH $PATH /opt/bin\n" {
+		t.Errorf("Expected fish_add_path to gain the directory, got:\n%s", content)
+	}
+}
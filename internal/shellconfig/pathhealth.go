@@ -0,0 +1,211 @@
+package shellconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// PathProblem is something wrong with a PATH entry.
+type PathProblem int
+
+const (
+	// PathEmpty is an empty component, which the shell searches as the
+	// current directory.
+	PathEmpty PathProblem = iota
+	// PathRelative is resolved against whatever directory the shell is in.
+	PathRelative
+	PathMissing
+	PathNotDirectory
+	// PathDuplicate repeats an earlier entry, possibly spelled with a
+	// trailing slash or through a symlink.
+	PathDuplicate
+	// PathWorldWritable lets any user plant commands that shadow others.
+	PathWorldWritable
+	// PathWorldWritableSticky is a shared directory such as /tmp. The
+	// sticky bit only stops users removing each other's files, so anyone
+	// can still add commands to it.
+	PathWorldWritableSticky
+)
+
+func (p PathProblem) String() string {
+	switch p {
+	case PathEmpty:
+		return "empty"
+	case PathRelative:
+		return "relative"
+	case PathMissing:
+		return "missing"
+	case PathNotDirectory:
+		return "not a directory"
+	case PathDuplicate:
+		return "duplicate"
+	case PathWorldWritable:
+		return "world-writable"
+	case PathWorldWritableSticky:
+		return "shared world-writable (sticky)"
+	}
+	return "unknown"
+}
+
+// Fix names the one-click fix for p. Every problem but PathWorldWritable is
+// fixed by removing the entry from PATH; a sticky shared directory is meant
+// to be writable, so it is taken out of PATH rather than changed.
+func (p PathProblem) Fix() string {
+	switch p {
+	case PathDuplicate:
+		return "Remove duplicate"
+	case PathWorldWritable:
+		return "Remove write for others"
+	}
+	return "Remove"
+}
+
+// PathStatus is the health of one PATH entry.
+type PathStatus struct {
+	Dir string
+	// Resolved is the directory with ~ and variables expanded, or empty when
+	// it refers to a variable that is not known.
+	Resolved string
+	// Problems are ordered from the most to the least severe.
+	Problems []PathProblem
+	// DuplicateOf is the index of the entry this one repeats.
+	DuplicateOf int
+}
+
+// OK reports whether the entry has no problems.
+func (s PathStatus) OK() bool {
+	return len(s.Problems) == 0
+}
+
+// Summary describes the problems for a badge, such as "missing" or
+// "duplicate of entry 2".
+func (s PathStatus) Summary() string {
+	if s.OK() {
+		return "ok"
+	}
+	words := []string{}
+	for _, problem := range s.Problems {
+		if problem == PathDuplicate {
+			words = append(words, fmt.Sprintf("duplicate of entry %d", s.DuplicateOf+1))
+			continue
+		}
+		words = append(words, problem.String())
+	}
+	return strings.Join(words, ", ")
+}
+
+// CheckPath checks PATH entries in search order, such as those of
+// PathList.Dirs. Later entries that resolve to the same directory as an
+// earlier one are duplicates. $PATH, the inherited PATH, is not checked.
+func (c *Config) CheckPath(dirs []string) []PathStatus {
+	homeDir, _ := os.UserHomeDir()
+	statuses := make([]PathStatus, len(dirs))
+	seen := make(map[string]int)
+	for i, dir := range dirs {
+		if isPathRef(dir) {
+			statuses[i] = PathStatus{Dir: dir}
+			continue
+		}
+		status := PathStatus{Dir: dir, Resolved: c.expandPathDir(dir, homeDir)}
+		switch {
+		case dir == "":
+			status.Problems = append(status.Problems, PathEmpty)
+		case status.Resolved != "" && !filepath.IsAbs(status.Resolved):
+			status.Problems = append(status.Problems, PathRelative)
+		}
+
+		if filepath.IsAbs(status.Resolved) {
+			key := filepath.Clean(status.Resolved)
+			info, err := os.Stat(status.Resolved)
+			switch {
+			case err != nil:
+				status.Problems = append(status.Problems, PathMissing)
+			case !info.IsDir():
+				status.Problems = append(status.Problems, PathNotDirectory)
+			default:
+				if real, err := filepath.EvalSymlinks(key); err == nil {
+					key = real
+				}
+			}
+			if first, ok := seen[key]; ok {
+				status.Problems = append(status.Problems, PathDuplicate)
+				status.DuplicateOf = first
+			} else {
+				seen[key] = i
+			}
+			if err == nil && info.IsDir() && info.Mode().Perm()&0002 != 0 {
+				if info.Mode()&os.ModeSticky != 0 {
+					status.Problems = append(status.Problems, PathWorldWritableSticky)
+				} else {
+					status.Problems = append(status.Problems, PathWorldWritable)
+				}
+			}
+		}
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// expandPathDir expands ~ and variables in a PATH entry, taking values from
+// the config before the environment. It returns "" when a variable is not
+// set anywhere.
+func (c *Config) expandPathDir(dir, homeDir string) string {
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		dir = homeDir + dir[1:]
+	}
+	resolved := true
+	seen := make(map[string]bool)
+	var lookup func(name string) string
+	lookup = func(name string) string {
+		value, ok := c.Exports[name]
+		if !ok {
+			value, ok = c.Variables[name]
+		}
+		if ok && !seen[name] {
+			seen[name] = true
+			defer delete(seen, name)
+			return os.Expand(value, lookup)
+		}
+		if name == "HOME" {
+			return homeDir
+		}
+		value, ok = os.LookupEnv(name)
+		if !ok {
+			resolved = false
+		}
+		return value
+	}
+	dir = os.Expand(dir, lookup)
+	if !resolved {
+		return ""
+	}
+	return dir
+}
+
+// WorldWriteFix returns the mode of dir and the mode RemoveWorldWrite would
+// give it, so the change can be confirmed first.
+func WorldWriteFix(dir string) (os.FileMode, os.FileMode, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	return info.Mode(), info.Mode() &^ 0002, nil
+}
+
+// RemoveWorldWrite takes away write permission for other users from dir,
+// the fix for PathWorldWritable.
+func RemoveWorldWrite(dir string) error {
+	_, fixed, err := WorldWriteFix(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, fixed); err != nil {
+		return fmt.Errorf("failed to change permissions of %s: %w", dir, err)
+	}
+	logger.Info("Removed write permission for others from %s", dir)
+	return nil
+}
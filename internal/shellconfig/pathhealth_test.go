@@ -0,0 +1,64 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, dir := range []string{"bin", "shared", "tools", "tmp"} {
+		os.Mkdir(filepath.Join(home, dir), 0755)
+	}
+	os.Chmod(filepath.Join(home, "shared"), 0777)
+	os.Chmod(filepath.Join(home, "tmp"), 0777|os.ModeSticky)
+	os.WriteFile(filepath.Join(home, "file"), []byte("x"), 0644)
+	os.Symlink(filepath.Join(home, "bin"), filepath.Join(home, "link"))
+
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	config.Exports["TOOLS"] = "$HOME/tools"
+	dirs := []string{"~/bin", "$PATH", "$HOME/bin/", "", ".", home + "/missing", home + "/file", home + "/shared", home + "/link", "$TOOLS", "$UNSET_FOR_TEST/bin", home + "/tmp"}
+	statuses := config.CheckPath(dirs)
+
+	expected := [][]PathProblem{
+		nil,
+		nil,
+		{PathDuplicate},
+		{PathEmpty},
+		{PathRelative},
+		{PathMissing},
+		{PathNotDirectory},
+		{PathWorldWritable},
+		{PathDuplicate},
+		nil,
+		nil,
+		{PathWorldWritableSticky},
+	}
+	for i, status := range statuses {
+		if !slices.Equal(status.Problems, expected[i]) {
+			t.Errorf("Expected %q to have problems %v, got %v", dirs[i], expected[i], status.Problems)
+		}
+	}
+	if statuses[8].DuplicateOf != 0 || statuses[8].Summary() != "duplicate of entry 1" {
+		t.Errorf("Expected the symlink to duplicate the first entry, got %q", statuses[8].Summary())
+	}
+	if statuses[11].Summary() == statuses[7].Summary() || statuses[11].Problems[0].Fix() != "Remove" {
+		t.Errorf("Expected a sticky directory to be described and fixed apart, got %q", statuses[11].Summary())
+	}
+	if statuses[9].Resolved != filepath.Join(home, "tools") {
+		t.Errorf("Expected exports to be expanded, got %q", statuses[9].Resolved)
+	}
+
+	if mode, fixed, _ := WorldWriteFix(filepath.Join(home, "shared")); mode.Perm() != 0777 || fixed.Perm() != 0775 {
+		t.Errorf("Expected the fix to change 0777 to 0775, got %v to %v", mode, fixed)
+	}
+	if err := RemoveWorldWrite(filepath.Join(home, "shared")); err != nil {
+		t.Fatalf("Failed to fix permissions: %v", err)
+	}
+	if status := config.CheckPath([]string{home + "/shared"}); !status[0].OK() {
+		t.Errorf("Expected the directory to be fixed, got %v", status[0].Problems)
+	}
+}
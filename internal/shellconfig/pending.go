@@ -0,0 +1,81 @@
+package shellconfig
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// entryKey identifies the definitions of one name.
+type entryKey struct {
+	kind NodeKind
+	name string
+}
+
+// entries lists the definitions in doc by kind and name, each rendered with
+// its description and condition so that editing either counts as a change.
+func entries(doc *Document) map[entryKey][]string {
+	defs := make(map[entryKey][]string)
+	for _, node := range doc.Nodes {
+		switch node.Kind {
+		case NodeRaw, NodeBlank, NodeComment:
+			continue
+		}
+		def := []string{node.Value, doc.description(node)}
+		if node.Guard != nil {
+			def = append(def, node.Guard.String())
+		}
+		key := entryKey{node.Kind, node.Name}
+		defs[key] = append(defs[key], strings.Join(def, "\x00"))
+	}
+	return defs
+}
+
+// ModifiedEntries returns the names of the entries with unsaved edits,
+// sorted and grouped by kind. An entry counts as edited when it was added,
+// removed, or its value, description or condition changed.
+func (c *Config) ModifiedEntries() map[NodeKind][]string {
+	seen := make(map[entryKey]bool)
+	for _, src := range c.Sources().Files() {
+		if !src.Modified() {
+			continue
+		}
+		dialect := src.Doc.dialect
+		if dialect == nil {
+			dialect = c.Dialect
+		}
+		before := entries(dialect.Parse(src.docText(src.original)))
+		after := entries(src.Doc)
+		for key, defs := range after {
+			if !slices.Equal(before[key], defs) {
+				seen[key] = true
+			}
+		}
+		for key := range before {
+			if _, ok := after[key]; !ok {
+				seen[key] = true
+			}
+		}
+	}
+
+	_, files := c.splitFunctions()
+	for name, text := range files {
+		if c.functionFiles[name] != text {
+			seen[entryKey{NodeFunction, name}] = true
+		}
+	}
+	for name := range c.functionFiles {
+		if _, ok := files[name]; !ok {
+			seen[entryKey{NodeFunction, name}] = true
+		}
+	}
+
+	modified := make(map[NodeKind][]string)
+	for key := range seen {
+		modified[key.kind] = append(modified[key.kind], key.name)
+	}
+	for _, names := range modified {
+		sort.Strings(names)
+	}
+	return modified
+}
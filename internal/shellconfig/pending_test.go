@@ -0,0 +1,55 @@
+package shellconfig
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestModifiedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	os.WriteFile(path, []byte("# Editor\nexport EDITOR=vim\nexport PATH=\"$HOME/bin:$PATH\"\nalias ll='ls -la'\nalias gs='git status'\nsetopt autocd\n"), 0644)
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if modified := config.ModifiedEntries(); len(modified) != 0 {
+		t.Fatalf("Expected no edits after loading, got %v", modified)
+	}
+
+	config.Exports["PATH"] = "$HOME/.local/bin:$PATH"
+	config.SetDescription(NodeExport, "EDITOR", "Preferred editor")
+	delete(config.Aliases, "gs")
+	config.Aliases["gd"] = "git diff"
+
+	modified := config.ModifiedEntries()
+	if !slices.Equal(modified[NodeExport], []string{"EDITOR", "PATH"}) {
+		t.Errorf("Expected EDITOR and PATH to be edited, got %v", modified[NodeExport])
+	}
+	if !slices.Equal(modified[NodeAlias], []string{"gd", "gs"}) {
+		t.Errorf("Expected gd and gs to be edited, got %v", modified[NodeAlias])
+	}
+	if _, ok := modified[NodeOption]; ok {
+		t.Error("Expected options to be unchanged")
+	}
+
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if modified := config.ModifiedEntries(); len(modified) != 0 || config.Modified() {
+		t.Errorf("Expected no edits after saving, got %v", modified)
+	}
+}
+
+func TestModifiedFunctionFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := NewForFile(filepath.Join(dir, "config.fish"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.CustomFunctions = append(config.CustomFunctions, Fish.FormatFunction("mkcd", []string{"mkdir -p $argv[1]"}))
+	if modified := config.ModifiedEntries(); !slices.Equal(modified[NodeFunction], []string{"mkcd"}) {
+		t.Errorf("Expected the new function file to be pending, got %v", modified)
+	}
+}
@@ -0,0 +1,351 @@
+package shellconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// posixDialect covers the Bourne-style shells, which share alias, export and
+// function syntax and differ mostly in their option commands.
+type posixDialect struct {
+	name    string
+	files   []string
+	ohMyZsh bool
+
+	optionRegex *regexp.Regexp
+	optionOn    string
+	optionOff   string
+}
+
+var (
+	Zsh Dialect = &posixDialect{
+		name:        "zsh",
+		files:       []string{".zshrc", ".zshenv", ".zprofile", ".zlogin"},
+		ohMyZsh:     true,
+		optionRegex: regexp.MustCompile(`^\s*(setopt|unsetopt)\s+([\w\s]+?)\s*$`),
+		optionOn:    "setopt",
+		optionOff:   "unsetopt",
+	}
+	Bash Dialect = &posixDialect{
+		name:        "bash",
+		files:       []string{".bashrc", ".bash_profile", ".bash_aliases", ".profile"},
+		optionRegex: regexp.MustCompile(`^\s*(shopt\s+-s|shopt\s+-u)\s+([\w\s]+?)\s*$`),
+		optionOn:    "shopt -s",
+		optionOff:   "shopt -u",
+	}
+)
+
+var (
+	themeRegex         = regexp.MustCompile(`^\s*ZSH_THEME=['"](.+)['"]`)
+	pluginsRegex       = regexp.MustCompile(`^\s*plugins=\((.*)\)`)
+	sourceRegex        = regexp.MustCompile(`^\s*(source|\.)\s+(?:"([^"]+)"|'([^']+)'|([^\s;'"]+))\s*;?\s*$`)
+	pathArrayRegex     = regexp.MustCompile(`^\s*path(\+?=)(?:\(([^()]*)\)|([^\s()#;]+))\s*(#.*)?$`)
+	sourceLoopRegex    = regexp.MustCompile(`^\s*for\s+(\w+)\s+in\s+(?:"([^"]+)"|([^\s;'"]+))\s*;\s*do\s+(?:source|\.)\s+"?\$\{?(\w+)\}?"?\s*;\s*done(?:\s*;\s*unset\s+(\w+))?\s*$`)
+)
+
+func (d *posixDialect) Name() string {
+	return d.name
+}
+
+func (d *posixDialect) ConfigFiles(homeDir string) []string {
+	files := make([]string, len(d.files))
+	for i, file := range d.files {
+		files[i] = filepath.Join(homeDir, file)
+	}
+	return files
+}
+
+func (d *posixDialect) Matches(path string) bool {
+	base := filepath.Base(path)
+	for _, file := range d.files {
+		if file == base {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *posixDialect) Supports(kind NodeKind) bool {
+	switch kind {
+	case NodeTheme, NodePlugins:
+		return d.ohMyZsh
+	}
+	return true
+}
+
+func (d *posixDialect) Parse(content string) *Document {
+	doc := &Document{TrailingNewline: true, dialect: d}
+	if content == "" {
+		return doc
+	}
+	doc.TrailingNewline = strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	blocks := &blockTracker{doc: doc}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		node := &Node{Kind: NodeRaw, Line: i + 1, Lines: []string{line}, Value: line}
+		trimmedLine := strings.TrimSpace(line)
+
+		if trimmedLine == "" {
+			node.Kind = NodeBlank
+		} else if strings.HasPrefix(trimmedLine, "#") {
+			node.Kind = NodeComment
+		} else if end := functionEnd(lines, i); end >= 0 {
+			node.Kind = NodeFunction
+			node.Name, _, _ = parseFunctionHeader(line)
+			node.Lines = lines[i : end+1]
+			node.Value = strings.Join(node.Lines, "\n")
+			i = end
+		} else if matches := sourceRegex.FindStringSubmatch(line); matches != nil {
+			node.Kind = NodeSource
+			node.Keyword = matches[1]
+			node.Name = matches[2] + matches[3] + matches[4]
+		} else if matches := sourceLoopRegex.FindStringSubmatch(line); matches != nil && matches[1] == matches[4] && (matches[5] == "" || matches[5] == matches[1]) {
+			node.Kind = NodeSource
+			node.Keyword = "for"
+			node.Name = matches[2] + matches[3]
+		} else if matches := d.optionRegex.FindStringSubmatch(line); matches != nil {
+			node.Kind = NodeOption
+			node.Keyword = strings.Join(strings.Fields(matches[1]), " ")
+			node.Name = strings.Join(strings.Fields(matches[2]), " ")
+			node.Value = d.optionValue(node.Keyword)
+		} else if matches := themeRegex.FindStringSubmatch(line); d.ohMyZsh && matches != nil {
+			node.Kind = NodeTheme
+			node.Value = matches[1]
+		} else if matches := pluginsRegex.FindStringSubmatch(line); d.ohMyZsh && matches != nil {
+			node.Kind = NodePlugins
+			node.Value = strings.Join(strings.Fields(matches[1]), " ")
+		} else if matches := pathArrayRegex.FindStringSubmatch(line); d.name == "zsh" && matches != nil && parsePathArray(node, matches) {
+			node.Indent = indentOf(line)
+		} else if nodes := parseAssignments(line); nodes != nil {
+			for _, n := range nodes {
+				n.Line, n.Lines, n.Indent = node.Line, node.Lines, indentOf(line)
+			}
+			blocks.tag(nodes...)
+			doc.Nodes = append(doc.Nodes, nodes...)
+			continue
+		} else if condition, nodes := parseGuarded(trimmedLine); nodes != nil {
+			for _, n := range nodes {
+				n.Line, n.Lines, n.Indent = node.Line, node.Lines, indentOf(line)
+			}
+			guardInline(nodes, condition, blocks.current(), doc)
+			doc.Nodes = append(doc.Nodes, nodes...)
+			continue
+		}
+		blocks.tag(node)
+		blocks.posixLine(node)
+		doc.Nodes = append(doc.Nodes, node)
+	}
+	return doc
+}
+
+// parseAssignments recognises alias definitions, exports and plain variable
+// assignments, including several on one line. It returns nil for anything
+// else, such as a command prefixed with an assignment.
+func parseAssignments(line string) []*Node {
+	words, rest, err := lexWords(line)
+	if err != nil || len(words) == 0 {
+		return nil
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil
+	}
+
+	kind, valid := NodeVariable, isIdentifier
+	keyword := []string{}
+	switch command := words[0].literal(); command {
+	case "alias":
+		kind, valid = NodeAlias, isAliasName
+	case "export", "typeset", "declare":
+		kind = NodeExport
+	}
+	if kind != NodeVariable {
+		keyword = append(keyword, words[0].raw)
+		words = words[1:]
+		exported := kind == NodeAlias || keyword[0] == "export"
+		for len(words) > 0 && strings.HasPrefix(words[0].raw, "-") {
+			flag := words[0].raw
+			if kind == NodeAlias && flag != "-g" {
+				return nil
+			}
+			if strings.Contains(flag, "x") {
+				exported = true
+			}
+			keyword = append(keyword, flag)
+			words = words[1:]
+		}
+		if !exported || len(words) == 0 {
+			return nil
+		}
+	}
+
+	nodes := []*Node{}
+	for _, w := range words {
+		name, value, ok := w.splitAssignment(valid)
+		if !ok {
+			return nil
+		}
+		node := &Node{Kind: kind, Name: name, Keyword: strings.Join(keyword, " "), Quote: value.style()}
+		if kind == NodeAlias {
+			node.Value = value.literal()
+		} else {
+			node.Value = value.expandable()
+		}
+		nodes = append(nodes, node)
+	}
+	if rest != "" {
+		nodes[0].Comment = rest
+	}
+	groupNodes(nodes)
+	return nodes
+}
+
+// parsePathArray reads zsh's path array, tied to PATH, as an export of PATH
+// whose value lists the directories with $PATH standing for $path. The
+// keyword keeps whether the line assigns or appends.
+func parsePathArray(node *Node, matches []string) bool {
+	words, rest, err := lexWords(matches[2] + matches[3])
+	if err != nil || strings.TrimSpace(rest) != "" {
+		return false
+	}
+	dirs := []string{}
+	if matches[1] == "+=" {
+		dirs = append(dirs, "$PATH")
+	}
+	for _, w := range words {
+		switch dir := w.expandable(); dir {
+		case "$path", "${path}", "$path[@]", "${path[@]}":
+			dirs = append(dirs, "$PATH")
+		default:
+			dirs = append(dirs, dir)
+		}
+	}
+	node.Kind = NodeExport
+	node.Name = "PATH"
+	node.Keyword = "path" + matches[1]
+	node.Value = strings.Join(dirs, ":")
+	node.Comment = matches[4]
+	return true
+}
+
+// renderPathArray writes a PATH export parsed by parsePathArray back as an
+// assignment or, while the value still starts with $PATH, an append.
+func renderPathArray(node *Node) string {
+	dirs := strings.Split(node.Value, ":")
+	keyword := node.Keyword
+	if keyword == "path+=" {
+		if dirs[0] == "$PATH" {
+			dirs = dirs[1:]
+		} else {
+			keyword = "path="
+		}
+	}
+	words := []string{}
+	for _, dir := range dirs {
+		if dir == "$PATH" {
+			words = append(words, "$path")
+		} else {
+			words = append(words, quoteValue(dir, QuoteNone))
+		}
+	}
+	line := keyword + "(" + strings.Join(words, " ") + ")"
+	if node.Comment != "" {
+		line += " " + node.Comment
+	}
+	return line
+}
+
+// parseGuarded recognises "cond && command" where the command is a source,
+// alias, export or assignment.
+func parseGuarded(line string) (string, []*Node) {
+	condition, command, ok := splitGuard(line)
+	if !ok {
+		return "", nil
+	}
+	if matches := sourceRegex.FindStringSubmatch(command); matches != nil {
+		return condition, []*Node{{Kind: NodeSource, Keyword: matches[1], Name: matches[2] + matches[3] + matches[4], Value: command}}
+	}
+	return condition, parseAssignments(command)
+}
+
+func (d *posixDialect) optionValue(keyword string) string {
+	if keyword == d.optionOn {
+		return "on"
+	}
+	return "off"
+}
+
+func (d *posixDialect) Render(node *Node) string {
+	switch node.Kind {
+	case NodeAlias, NodeExport, NodeVariable:
+		if node.Keyword == "path=" || node.Keyword == "path+=" {
+			return renderPathArray(node)
+		}
+		words := []string{}
+		if node.Keyword != "" {
+			words = append(words, node.Keyword)
+		} else if node.Kind == NodeAlias {
+			words = append(words, "alias")
+		} else if node.Kind == NodeExport {
+			words = append(words, "export")
+		}
+		for _, member := range node.Group() {
+			words = append(words, renderAssignment(member))
+		}
+		line := strings.Join(words, " ")
+		if node.Comment != "" {
+			line += " " + node.Comment
+		}
+		return line
+	case NodeOption:
+		if node.Value == "on" {
+			return d.optionOn + " " + node.Name
+		}
+		return d.optionOff + " " + node.Name
+	case NodeTheme:
+		return "ZSH_THEME=" + quoteValue(node.Value, QuoteDouble)
+	case NodePlugins:
+		return fmt.Sprintf("plugins=(%s)", node.Value)
+	}
+	return node.Value
+}
+
+// renderAssignment writes NAME=value, keeping the node's original quoting
+// where it can still represent the value. New aliases default to single
+// quotes and new variables to double quotes.
+func renderAssignment(node *Node) string {
+	if node.Kind == NodeAlias {
+		style := node.Quote
+		if style == QuoteDefault {
+			style = QuoteSingle
+		}
+		return quoteLiteral(node.Name, QuoteNone) + "=" + quoteLiteral(node.Value, style)
+	}
+	style := node.Quote
+	if style == QuoteDefault {
+		style = QuoteDouble
+	}
+	return node.Name + "=" + quoteValue(node.Value, style)
+}
+
+func (d *posixDialect) FormatGuard(condition string) (string, string) {
+	return "if " + condition + "; then", "fi"
+}
+
+// FormatSourceLoop uses . rather than source, which sh and dash lack, since
+// .profile is read by them too.
+func (d *posixDialect) FormatSourceLoop(glob string) string {
+	return "for f in " + glob + "; do . \"$f\"; done; unset f"
+}
+
+func (d *posixDialect) FormatFunction(name string, body []string) string {
+	lines := []string{name + "() {"}
+	for _, line := range body {
+		lines = append(lines, "    "+line)
+	}
+	return strings.Join(append(lines, "}"), "\n")
+}
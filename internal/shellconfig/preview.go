@@ -0,0 +1,380 @@
+package shellconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btassone/swiss-linux-knife/internal/diff"
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+)
+
+// previewTimeout bounds how long an interactive shell may take to start.
+const previewTimeout = 10 * time.Second
+
+// captureMarker starts each section of the capture script's output, so that
+// anything the startup files print is skipped.
+const captureMarker = "\x1eswiss-linux-knife:"
+
+// captureScripts print the environment, aliases and functions of an
+// interactive shell. "{marker}" stands for captureMarker.
+var captureScripts = map[string]string{
+	"zsh": `printf '%s\n' '{marker}env'; env -0
+for name in ${(ok)aliases}; do printf '%s\n%s' "{marker}alias:$name" "$aliases[$name]"; done
+for name in ${(ok)functions}; do printf '%s\n%s' "{marker}function:$name" "$functions[$name]"; done
+printf '%s\n' '{marker}end'`,
+	"bash": `printf '%s\n' '{marker}env'; env -0
+for name in "${!BASH_ALIASES[@]}"; do printf '%s\n%s' "{marker}alias:$name" "${BASH_ALIASES[$name]}"; done
+while read -r _ _ name; do printf '%s\n' "{marker}function:$name"; declare -f "$name"; done < <(declare -F)
+printf '%s\n' '{marker}end'`,
+	"fish": `printf '%s\n' '{marker}env'; env -0
+printf '%s\n' '{marker}aliases'; alias
+for name in (functions -a -n); printf '%s\n' "{marker}function:$name"; functions $name; end
+printf '%s\n' '{marker}end'`,
+}
+
+// Environment is what an interactive shell has defined once it has read its
+// startup files.
+type Environment struct {
+	Vars      map[string]string
+	Aliases   map[string]string
+	Functions map[string]string
+}
+
+// EnvChange is one difference between two environments, described in
+// Summary. Kind is NodeExport for environment variables.
+type EnvChange struct {
+	Kind    NodeKind
+	Name    string
+	Before  string
+	After   string
+	Summary string
+}
+
+// Preview holds the files the shell reads as saved and as Save would write
+// them, taken from a config at one point in time.
+type Preview struct {
+	shell  string
+	path   string
+	before map[string]string
+	after  map[string]string
+}
+
+// Preview collects the files to compare. Run then needs nothing from the
+// config, so it can be called while the config is edited.
+func (c *Config) Preview() *Preview {
+	return &Preview{
+		shell:  c.Dialect.Name(),
+		path:   c.FilePath,
+		before: c.previewFiles(false),
+		after:  c.previewFiles(true),
+	}
+}
+
+// Run starts the shell once over the files as saved and once over the files
+// as Save would write them, each time in a throwaway home directory, and
+// returns how the two environments differ. Only the dialect's startup files
+// and the files of the config are copied, so files they source from
+// elsewhere in the home directory are missing in both runs.
+func (p *Preview) Run() ([]EnvChange, error) {
+	before, err := p.capture(p.before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s with the saved config: %w", p.shell, err)
+	}
+	after, err := p.capture(p.after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s with the edited config: %w", p.shell, err)
+	}
+	return CompareEnvironments(before, after), nil
+}
+
+// previewFiles returns the content of each file the shell may read, as
+// saved or, when pending is set, with pending edits applied.
+func (c *Config) previewFiles(pending bool) map[string]string {
+	files := make(map[string]string)
+	homeDir, _ := os.UserHomeDir()
+	for _, path := range c.Dialect.ConfigFiles(homeDir) {
+		if content, err := os.ReadFile(path); err == nil {
+			files[path] = string(content)
+		}
+	}
+	for _, src := range c.Sources().Files() {
+		files[src.Path] = src.original
+		if pending {
+			files[src.Path] = src.savedText()
+		}
+	}
+	if fd, ok := c.Dialect.(functionDir); ok {
+		functions := c.functionFiles
+		if pending {
+			_, functions = c.splitFunctions()
+		}
+		dir := fd.FunctionDir(c.FilePath)
+		for name, text := range functions {
+			files[filepath.Join(dir, name+filepath.Ext(c.FilePath))] = text + "\n"
+		}
+	}
+	return files
+}
+
+// sandboxPath maps a path in the home or config directory to the same place
+// under sandbox. Paths outside both are not mapped.
+func sandboxPath(path, homeDir, configDir, sandbox string) string {
+	if rel, err := filepath.Rel(configDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join(sandbox, ".config", rel)
+	}
+	if rel, err := filepath.Rel(homeDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join(sandbox, rel)
+	}
+	return ""
+}
+
+// capture writes files to a throwaway home directory, starts an interactive
+// shell there and reads back what it defined. Paths into the sandbox are
+// reported as the real paths they stand for.
+func (p *Preview) capture(files map[string]string) (*Environment, error) {
+	shell := p.shell
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not installed", shell)
+	}
+	sandbox, err := os.MkdirTemp("", "swiss-linux-knife-preview-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	homeDir, _ := os.UserHomeDir()
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	for file, text := range files {
+		target := sandboxPath(file, homeDir, configDir, sandbox)
+		if target == "" {
+			logger.Warn("Not previewing %s, which is outside the home directory", file)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+		}
+		if err := os.WriteFile(target, []byte(text), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write sandbox file: %w", err)
+		}
+	}
+
+	args := []string{"-i"}
+	base := filepath.Base(p.path)
+	if shell != "fish" && (strings.Contains(base, "profile") || strings.Contains(base, "login")) {
+		args = append(args, "-l")
+	}
+	script := strings.ReplaceAll(captureScripts[shell], "{marker}", captureMarker)
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, append(args, "-c", script)...)
+	cmd.Dir = sandbox
+	cmd.Env = sandboxEnv(os.Environ(), sandbox)
+	if shell == "zsh" && filepath.Dir(p.path) != homeDir {
+		if dir := sandboxPath(filepath.Dir(p.path), homeDir, configDir, sandbox); dir != "" {
+			cmd.Env = append(cmd.Env, "ZDOTDIR="+dir)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s did not start within %s", shell, previewTimeout)
+	}
+
+	output := strings.NewReplacer(filepath.Join(sandbox, ".config"), configDir, sandbox, homeDir).Replace(stdout.String())
+	env, err := parseCapture(output)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		if runErr != nil {
+			return nil, fmt.Errorf("%w: %w", err, runErr)
+		}
+		return nil, err
+	}
+	logger.Debug("Captured %d variables, %d aliases and %d functions from %s",
+		len(env.Vars), len(env.Aliases), len(env.Functions), shell)
+	return env, nil
+}
+
+// sandboxEnv returns environ with the home and config directories pointed
+// into sandbox.
+func sandboxEnv(environ []string, sandbox string) []string {
+	env := []string{}
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		switch name {
+		case "HOME", "XDG_CONFIG_HOME", "ZDOTDIR":
+			continue
+		}
+		env = append(env, entry)
+	}
+	return append(env, "HOME="+sandbox, "XDG_CONFIG_HOME="+filepath.Join(sandbox, ".config"))
+}
+
+// parseCapture reads the output of a capture script.
+func parseCapture(output string) (*Environment, error) {
+	sections := strings.Split(output, captureMarker)
+	if len(sections) < 2 || !strings.HasPrefix(sections[len(sections)-1], "end") {
+		return nil, fmt.Errorf("shell exited before reporting its environment")
+	}
+	env := &Environment{
+		Vars:      make(map[string]string),
+		Aliases:   make(map[string]string),
+		Functions: make(map[string]string),
+	}
+	for _, section := range sections[1:] {
+		header, body, _ := strings.Cut(section, "\n")
+		kind, name, _ := strings.Cut(header, ":")
+		switch kind {
+		case "env":
+			for _, entry := range strings.Split(body, "\x00") {
+				if name, value, ok := strings.Cut(entry, "="); ok && name != "" {
+					env.Vars[name] = value
+				}
+			}
+		case "aliases":
+			for _, line := range strings.Split(body, "\n") {
+				if words := fishWords(line); len(words) >= 3 && words[0] == "alias" {
+					env.Aliases[words[1]] = words[2]
+				}
+			}
+		case "alias":
+			env.Aliases[name] = body
+		case "function":
+			env.Functions[name] = strings.TrimSuffix(body, "\n")
+		}
+	}
+	return env, nil
+}
+
+// CompareEnvironments lists how after differs from before: variables first,
+// then aliases and functions, each sorted by name. Variables holding a
+// colon-separated list of paths are compared entry by entry.
+func CompareEnvironments(before, after *Environment) []EnvChange {
+	changes := []EnvChange{}
+	for _, name := range unionNames(before.Vars, after.Vars) {
+		old, wasSet := before.Vars[name]
+		value, isSet := after.Vars[name]
+		change := EnvChange{Kind: NodeExport, Name: name, Before: old, After: value}
+		switch {
+		case old == value && wasSet == isSet:
+			continue
+		case !isSet:
+			change.Summary = name + " is no longer set"
+		case !wasSet:
+			change.Summary = fmt.Sprintf("%s is now set to %s", name, value)
+		case strings.HasSuffix(name, "PATH"):
+			for _, summary := range pathListChanges(old, value) {
+				change.Summary = name + " " + summary
+				changes = append(changes, change)
+			}
+			continue
+		default:
+			change.Summary = fmt.Sprintf("%s now resolves to %s", name, value)
+		}
+		changes = append(changes, change)
+	}
+	changes = append(changes, compareDefinitions(NodeAlias, before.Aliases, after.Aliases)...)
+	return append(changes, compareDefinitions(NodeFunction, before.Functions, after.Functions)...)
+}
+
+// compareDefinitions reports the aliases or functions that were added,
+// removed or changed.
+func compareDefinitions(kind NodeKind, before, after map[string]string) []EnvChange {
+	changes := []EnvChange{}
+	for _, name := range unionNames(before, after) {
+		old, existed := before[name]
+		value, exists := after[name]
+		change := EnvChange{Kind: kind, Name: name, Before: old, After: value}
+		switch {
+		case old == value && existed == exists:
+			continue
+		case !exists:
+			change.Summary = fmt.Sprintf("%s %s is removed", kind, name)
+		case !existed:
+			change.Summary = fmt.Sprintf("%s %s is added", kind, name)
+		default:
+			change.Summary = fmt.Sprintf("%s %s changes", kind, name)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// pathListChanges describes how the entries of a colon-separated list
+// changed, giving 1-based positions in the new list.
+func pathListChanges(old, value string) []string {
+	oldEntries, newEntries := strings.Split(old, ":"), strings.Split(value, ":")
+	oldCount, newCount := make(map[string]int), make(map[string]int)
+	for _, entry := range oldEntries {
+		oldCount[entry]++
+	}
+	for _, entry := range newEntries {
+		newCount[entry]++
+	}
+	label := func(entry string) string {
+		if entry == "" {
+			return "an empty entry"
+		}
+		return entry
+	}
+
+	summaries := []string{}
+	d := diff.ComputeContext(strings.Join(oldEntries, "\n")+"\n", strings.Join(newEntries, "\n")+"\n", 0)
+	for _, hunk := range d.Hunks {
+		position := hunk.NewStart
+		for _, line := range hunk.Lines {
+			entry := strings.TrimSuffix(line.Text, "\n")
+			switch line.Op {
+			case diff.Insert:
+				switch {
+				case oldCount[entry] == 0:
+					summaries = append(summaries, fmt.Sprintf("gains %s at position %d", label(entry), position))
+				case newCount[entry] > oldCount[entry]:
+					summaries = append(summaries, fmt.Sprintf("gains a duplicate of %s at position %d", label(entry), position))
+				default:
+					summaries = append(summaries, fmt.Sprintf("moves %s to position %d", label(entry), position))
+				}
+				position++
+			case diff.Delete:
+				switch {
+				case newCount[entry] == 0:
+					summaries = append(summaries, "loses "+label(entry))
+				case newCount[entry] < oldCount[entry]:
+					summaries = append(summaries, "loses a duplicate of "+label(entry))
+				}
+			default:
+				position++
+			}
+		}
+	}
+	return summaries
+}
+
+// unionNames returns the keys of both maps, sorted.
+func unionNames(a, b map[string]string) []string {
+	names := []string{}
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,88 @@
+package shellconfig
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPathListChanges(t *testing.T) {
+	got := pathListChanges("/usr/bin:/bin:/usr/local/bin:/sbin", "/usr/local/bin:/opt/foo/bin:/usr/bin:/bin:/bin")
+	want := []string{
+		"moves /usr/local/bin to position 1",
+		"gains /opt/foo/bin at position 2",
+		"loses /sbin",
+		"gains a duplicate of /bin at position 5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestCompareEnvironments(t *testing.T) {
+	before := &Environment{
+		Vars:      map[string]string{"PATH": "/usr/bin:/bin", "EDITOR": "vim", "PAGER": "less"},
+		Aliases:   map[string]string{"gs": "git status", "ll": "ls -la"},
+		Functions: map[string]string{"mkcd": "mkcd () { mkdir -p $1; }"},
+	}
+	after := &Environment{
+		Vars:      map[string]string{"PATH": "/usr/bin:/opt/foo/bin:/bin", "EDITOR": "nvim", "LANG": "C"},
+		Aliases:   map[string]string{"gs": "git status -sb", "ll": "ls -la"},
+		Functions: map[string]string{},
+	}
+	summaries := []string{}
+	for _, change := range CompareEnvironments(before, after) {
+		summaries = append(summaries, change.Summary)
+	}
+	want := []string{
+		"EDITOR now resolves to nvim",
+		"LANG is now set to C",
+		"PAGER is no longer set",
+		"PATH gains /opt/foo/bin at position 2",
+		"alias gs changes",
+		"function mkcd is removed",
+	}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Expected %q, got %q", want, summaries)
+	}
+}
+
+func TestPreviewEnvironment(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	writeTestFiles(t, home, map[string]string{
+		".bashrc":        "echo welcome\nexport EDITOR=vim\nexport PATH=\"/usr/bin:/bin\"\nsource ~/.bash_aliases\n",
+		".bash_aliases":  "alias gs='git status'\n",
+		".bash_logout":   "",
+		"unrelated/file": "not copied",
+	})
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Exports["EDITOR"] = "nvim"
+	config.Exports["PATH"] = "/usr/bin:$HOME/bin:/bin"
+	config.Aliases["gs"] = "git status -sb"
+
+	changes, err := config.Preview().Run()
+	if err != nil {
+		t.Fatalf("Failed to preview environment: %v", err)
+	}
+	summaries := []string{}
+	for _, change := range changes {
+		summaries = append(summaries, change.Summary)
+	}
+	want := []string{
+		"EDITOR now resolves to nvim",
+		"PATH gains " + filepath.Join(home, "bin") + " at position 2",
+		"alias gs changes",
+	}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("Expected %q, got %q", want, summaries)
+	}
+}
@@ -0,0 +1,213 @@
+package shellconfig
+
+import (
+	"sort"
+	"strings"
+)
+
+// sync applies the typed fields to the documents so that only the nodes
+// whose values changed are re-rendered. Edits land in whichever file defines
+// the entry; new entries go to the root file, or the drop-in file of their
+// kind.
+func (c *Config) sync() {
+	if c.doc == nil {
+		c.doc = c.Dialect.Parse("")
+	}
+	c.syncNamed(NodeExport, c.Exports, "Environment Variables")
+	c.syncNamed(NodeVariable, c.Variables, "Shell Variables")
+	if c.Dialect.Supports(NodeOption) {
+		c.syncOptions()
+	}
+	c.syncNamed(NodeAlias, c.Aliases, "Aliases")
+	c.syncGuarded()
+	if c.OhMyZsh() {
+		c.syncTheme()
+		c.syncPlugins()
+	}
+	c.syncFunctions()
+	c.syncDescriptions()
+}
+
+
+// OhMyZsh reports whether the config edits Oh My Zsh settings. They are
+// only edited in place, since they must be set before oh-my-zsh.sh is
+// sourced.
+func (c *Config) OhMyZsh() bool {
+	return c.Dialect.Supports(NodeTheme) && c.Mode == WriteInPlace
+}
+
+func orderedNames(refs []nodeRef, values map[string]string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if _, ok := values[ref.node.Name]; ok && !seen[ref.node.Name] {
+			names = append(names, ref.node.Name)
+			seen[ref.node.Name] = true
+		}
+	}
+	added := []string{}
+	for name := range values {
+		if !seen[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	return append(names, added...)
+}
+
+func (c *Config) syncNamed(kind NodeKind, values map[string]string, header string) {
+	last := make(map[string]*Node)
+	for _, ref := range c.unguarded(kind) {
+		if _, ok := values[ref.node.Name]; !ok {
+			ref.remove()
+			continue
+		}
+		last[ref.node.Name] = ref.node
+	}
+	added := []*Node{}
+	for _, name := range orderedNames(nil, values) {
+		if node, ok := last[name]; ok {
+			node.set(values[name])
+			continue
+		}
+		added = append(added, &Node{Kind: kind, Name: name, Value: values[name]})
+	}
+	c.appendSection(kind, header, added...)
+}
+
+// syncOptions drops names whose state changed from the line that set them,
+// and writes each new or changed option on a line of its own.
+func (c *Config) syncOptions() {
+	covered := make(map[string]bool)
+	for _, ref := range c.find(NodeOption) {
+		node := ref.node
+		kept := []string{}
+		for _, name := range strings.Fields(node.Name) {
+			if on, ok := c.Options[name]; ok && on == (node.Value == "on") {
+				kept = append(kept, name)
+				covered[name] = true
+			}
+		}
+		if len(kept) == 0 {
+			ref.remove()
+		} else if name := strings.Join(kept, " "); name != node.Name {
+			node.Name = name
+			node.Lines = nil
+		}
+	}
+	names := []string{}
+	for name := range c.Options {
+		if !covered[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	added := []*Node{}
+	for _, name := range names {
+		value := "off"
+		if c.Options[name] {
+			value = "on"
+		}
+		added = append(added, &Node{Kind: NodeOption, Name: name, Value: value})
+	}
+	c.appendSection(NodeOption, "Shell Options", added...)
+}
+
+func (c *Config) syncTheme() {
+	refs := c.find(NodeTheme)
+	if c.OhMyZshTheme == "" {
+		for _, ref := range refs {
+			ref.remove()
+		}
+		return
+	}
+	if len(refs) > 0 {
+		refs[len(refs)-1].node.set(c.OhMyZshTheme)
+		return
+	}
+	c.insertOhMyZsh(&Node{Kind: NodeTheme, Value: c.OhMyZshTheme})
+}
+
+func (c *Config) syncPlugins() {
+	refs := c.find(NodePlugins)
+	if len(c.OhMyZshPlugins) == 0 && len(refs) == 0 {
+		return
+	}
+	value := strings.Join(c.OhMyZshPlugins, " ")
+	if len(refs) > 0 {
+		refs[len(refs)-1].node.set(value)
+		return
+	}
+	c.insertOhMyZsh(&Node{Kind: NodePlugins, Value: value})
+}
+
+// insertOhMyZsh places Oh My Zsh settings before oh-my-zsh.sh is sourced,
+// since they have no effect afterwards.
+func (c *Config) insertOhMyZsh(node *Node) {
+	for i, n := range c.doc.Nodes {
+		if (n.Kind == NodeRaw || n.Kind == NodeSource) && strings.Contains(n.Value, "oh-my-zsh.sh") {
+			c.doc.Insert(i, node)
+			return
+		}
+	}
+	if others := c.doc.Find(NodeTheme); len(others) > 0 {
+		c.doc.Insert(c.doc.indexOf(others[0])+1, node)
+		return
+	}
+	if others := c.doc.Find(NodePlugins); len(others) > 0 {
+		c.doc.Insert(c.doc.indexOf(others[0]), node)
+		return
+	}
+	c.doc.appendSection("Oh My Zsh Configuration", node)
+}
+
+// syncFunctions matches functions by name so that editing, adding or
+// removing one function leaves the others untouched.
+func (c *Config) syncFunctions() {
+	inline, _ := c.splitFunctions()
+	remaining := make(map[string][]string)
+	for _, text := range inline {
+		name := FunctionName(text)
+		remaining[name] = append(remaining[name], text)
+	}
+	for _, ref := range c.find(NodeFunction) {
+		texts := remaining[ref.node.Name]
+		if len(texts) == 0 {
+			ref.remove()
+			continue
+		}
+		ref.node.set(texts[0])
+		remaining[ref.node.Name] = texts[1:]
+	}
+	added := []*Node{}
+	for _, text := range inline {
+		name := FunctionName(text)
+		if texts := remaining[name]; len(texts) > 0 && texts[0] == text {
+			added = append(added, &Node{Kind: NodeFunction, Name: name, Value: text})
+			remaining[name] = texts[1:]
+		}
+	}
+	c.appendSection(NodeFunction, "Custom Functions", added...)
+}
+
+// splitFunctions separates functions defined in the config files from those
+// kept in the dialect's function directory. New functions go to the
+// directory when the dialect has one.
+func (c *Config) splitFunctions() ([]string, map[string]string) {
+	inline := []string{}
+	files := make(map[string]string)
+	_, hasDir := c.Dialect.(functionDir)
+	defined := make(map[string]bool)
+	for _, ref := range c.find(NodeFunction) {
+		defined[ref.node.Name] = true
+	}
+	for _, text := range c.CustomFunctions {
+		name := FunctionName(text)
+		if _, ok := c.functionFiles[name]; ok || (hasDir && !defined[name]) {
+			files[name] = text
+			continue
+		}
+		inline = append(inline, text)
+	}
+	return inline, files
+}
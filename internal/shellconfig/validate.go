@@ -0,0 +1,109 @@
+package shellconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syntaxCheckTimeout bounds how long the shell may take to parse a file.
+const syntaxCheckTimeout = 5 * time.Second
+
+// SyntaxError is returned by Save when the shell rejects a file it would
+// write. Kind and Name identify the entry on the reported line, when one
+// could be found; the file on disk is left untouched.
+type SyntaxError struct {
+	Path    string
+	Line    int
+	Kind    NodeKind
+	Name    string
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s rejected by syntax check in %s %s: %s", e.Path, e.Kind, e.Name, e.Message)
+	}
+	return fmt.Sprintf("%s rejected by syntax check: %s", e.Path, e.Message)
+}
+
+// syntaxErrorLineRegex finds the line number after the file name in the
+// messages of zsh ("file:3: ..."), bash ("file: line 3: ...") and fish
+// ("file (line 3): ...").
+var syntaxErrorLineRegex = regexp.MustCompile(`^(?::|: line | \(line )(\d+)[:)]`)
+
+// checkSyntax runs the shell in no-exec mode over text. A missing shell is
+// not an error, since the structural checks have already passed.
+func checkSyntax(shell, text string) error {
+	return runNoExec(shell, strings.NewReader(text+"\n"))
+}
+
+// checkFile runs the shell in no-exec mode over the file at path.
+func checkFile(shell, path string) error {
+	return runNoExec(shell, nil, path)
+}
+
+func runNoExec(shell string, stdin io.Reader, args ...string) error {
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syntaxCheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, append([]string{"-n"}, args...)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s syntax check timed out", shell)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return fmt.Errorf("%s syntax check failed: %w", shell, err)
+	}
+	return nil
+}
+
+// validateFile checks the temp file holding content, about to replace path.
+// When the shell rejects it, the error names the entry on the reported line
+// or, failing that, the first edited entry the shell rejects on its own.
+func (c *Config) validateFile(path, tempFile, content string, src *Source) error {
+	shell := c.Dialect.Name()
+	err := checkFile(shell, tempFile)
+	if err == nil {
+		return nil
+	}
+
+	message := strings.ReplaceAll(err.Error(), tempFile, path)
+	syntaxErr := &SyntaxError{Path: path, Message: message}
+	first := strings.SplitN(message, "\n", 2)[0]
+	if matches := syntaxErrorLineRegex.FindStringSubmatch(strings.TrimPrefix(first, path)); matches != nil {
+		syntaxErr.Line, _ = strconv.Atoi(matches[1])
+	}
+
+	if node := c.Dialect.Parse(content).NodeAt(syntaxErr.Line); node != nil && describable(node.Kind) {
+		syntaxErr.Kind, syntaxErr.Name = node.Kind, node.Name
+		return syntaxErr
+	}
+	if src != nil {
+		for _, node := range src.Doc.Nodes {
+			if node.Lines != nil || !describable(node.Kind) || node.head() != node {
+				continue
+			}
+			if checkSyntax(shell, src.Doc.Text(node)) != nil {
+				syntaxErr.Kind, syntaxErr.Name = node.Kind, node.Name
+				break
+			}
+		}
+	}
+	return syntaxErr
+}
@@ -0,0 +1,47 @@
+package shellconfig
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveRejectsInvalidSyntax(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	original := "export A=1\nalias ll='ls -la'\n\ngreet() {\n    echo hi\n}\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	config := NewForFile(path)
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	config.Exports["BAD"] = "$(oops"
+	err := config.Save()
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected a syntax error, got %v", err)
+	}
+	if syntaxErr.Kind != NodeExport || syntaxErr.Name != "BAD" || syntaxErr.Line != 2 {
+		t.Errorf("Expected the error on export BAD at line 2, got %s %s at line %d", syntaxErr.Kind, syntaxErr.Name, syntaxErr.Line)
+	}
+	if content, _ := os.ReadFile(path); string(content) != original {
+		t.Errorf("Expected the file to be left alone, got:\n%s", content)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected the temp file to be removed")
+	}
+
+	delete(config.Exports, "BAD")
+	config.CustomFunctions[0] = "greet() {\n    if true; then\n}"
+	err = config.Save()
+	if !errors.As(err, &syntaxErr) || syntaxErr.Kind != NodeFunction || syntaxErr.Name != "greet" {
+		t.Errorf("Expected the error in function greet, got %v", err)
+	}
+}
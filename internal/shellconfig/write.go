@@ -0,0 +1,135 @@
+package shellconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btassone/swiss-linux-knife/internal/logger"
+	"github.com/btassone/swiss-linux-knife/internal/safefile"
+)
+
+// commit replaces a file with its staged content. Tests swap it to make a
+// save fail halfway.
+var commit = (*safefile.Staged).Commit
+
+// stagedWrite is one file of a transaction.
+type stagedWrite struct {
+	change *FileChange
+	// staged is nil when the file is removed.
+	staged  *safefile.Staged
+	old     []byte
+	existed bool
+	done    bool
+}
+
+// transaction replaces the files of a save together. Every file is staged
+// and validated before the first one is replaced, and if replacing one
+// fails, the files already replaced get back the content they had before.
+// Symlinks, mode and owner are kept as described for safefile.Write.
+type transaction struct {
+	writes []*stagedWrite
+}
+
+// stage writes the new content of change to a temp file and validates it.
+func (t *transaction) stage(c *Config, change *FileChange) error {
+	w := &stagedWrite{change: change}
+	old, err := os.ReadFile(change.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", change.Path, err)
+	}
+	w.old, w.existed = old, err == nil
+	t.writes = append(t.writes, w)
+
+	content := change.Content()
+	if change.Remove && content == "" {
+		return nil
+	}
+	// Drop-in and function files may be the first in their directory.
+	if err := os.MkdirAll(filepath.Dir(change.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", change.Path, err)
+	}
+	w.staged, err = safefile.Stage(change.Path, []byte(content))
+	if err != nil {
+		return err
+	}
+	if err := c.validateFile(change.Path, w.staged.Temp, content, change.src); err != nil {
+		logger.Error("Refusing to save %s: %v", change.Path, err)
+		return err
+	}
+	return nil
+}
+
+// commit backs up the files about to be replaced and then replaces them in
+// the order they were staged, rolling back on the first failure.
+func (t *transaction) commit(c *Config) error {
+	for _, w := range t.writes {
+		if !w.existed {
+			continue
+		}
+		if err := c.snapshot(w.change.Path); err != nil {
+			return err
+		}
+		// Keep a copy of the original file next to the path being edited
+		if info, err := os.Stat(w.change.Path); err == nil {
+			if err := os.WriteFile(w.change.Path+".bak", w.old, info.Mode().Perm()); err != nil {
+				logger.Warn("Failed to create backup: %v", err)
+			}
+		}
+	}
+
+	for _, w := range t.writes {
+		var err error
+		if w.staged == nil {
+			err = os.Remove(w.change.Path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = commit(w.staged)
+		}
+		w.done = true
+		if err != nil {
+			logger.Error("Failed to save %s, rolling back: %v", w.change.Path, err)
+			if rollbackErr := t.rollback(); rollbackErr != nil {
+				return fmt.Errorf("failed to save %s and to roll back: %w", w.change.Path, errors.Join(err, rollbackErr))
+			}
+			return fmt.Errorf("failed to save %s, every file was rolled back: %w", w.change.Path, err)
+		}
+	}
+	return nil
+}
+
+// rollback restores the files already replaced to their old content, and
+// removes those that did not exist before.
+func (t *transaction) rollback() error {
+	errs := []error{}
+	for i := len(t.writes) - 1; i >= 0; i-- {
+		w := t.writes[i]
+		if !w.done {
+			continue
+		}
+		var err error
+		if w.existed {
+			err = safefile.Write(w.change.Path, w.old, nil)
+		} else if err = os.Remove(w.change.Path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", w.change.Path, err))
+			continue
+		}
+		logger.Info("Rolled back %s", w.change.Path)
+	}
+	return errors.Join(errs...)
+}
+
+// discard removes the temp files that were never committed.
+func (t *transaction) discard() {
+	for _, w := range t.writes {
+		if w.staged != nil && !w.done {
+			w.staged.Discard()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package shellconfig
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btassone/swiss-linux-knife/internal/safefile"
+)
+
+func TestSaveRollsBackEveryFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	files := map[string]string{
+		".zshrc":           "export PATH=\"$HOME/bin:$PATH\"\nsource ~/.zsh/aliases.zsh\n",
+		".zsh/aliases.zsh": "alias ll='ls -la'\n",
+	}
+	writeTestFiles(t, home, files)
+	config := NewForFile(filepath.Join(home, ".zshrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Exports["EDITOR"] = "nvim"
+	config.Aliases["ll"] = "ls -lah"
+
+	failing := filepath.Join(home, ".zsh/aliases.zsh")
+	commit = func(s *safefile.Staged) error {
+		if s.Path == failing {
+			s.Discard()
+			return errors.New("disk full")
+		}
+		return s.Commit()
+	}
+	defer func() { commit = (*safefile.Staged).Commit }()
+
+	err := config.Save()
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("Expected the save to fail and roll back, got %v", err)
+	}
+	for name, original := range files {
+		if content, _ := os.ReadFile(filepath.Join(home, name)); string(content) != original {
+			t.Errorf("Expected %s to be rolled back, got:\n%s", name, content)
+		}
+	}
+	if !config.Modified() {
+		t.Error("Expected the edits to stay pending after a failed save")
+	}
+	temps, _ := filepath.Glob(filepath.Join(home, ".zsh", ".*.tmp*"))
+	if len(temps) != 0 {
+		t.Errorf("Expected no temp files to be left behind, got %v", temps)
+	}
+
+	commit = (*safefile.Staged).Commit
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if config.Modified() {
+		t.Error("Expected nothing pending after saving")
+	}
+}
+
+func TestSaveValidatesEveryFileFirst(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	files := map[string]string{
+		".bashrc":   "export EDITOR=vim\nsource ~/.bash_env\n",
+		".bash_env": "export A=1\n",
+	}
+	writeTestFiles(t, home, files)
+	config := NewForFile(filepath.Join(home, ".bashrc"))
+	if err := config.Load(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	config.Exports["EDITOR"] = "nvim"
+	config.Exports["A"] = "$(oops"
+
+	var syntaxErr *SyntaxError
+	if err := config.Save(); !errors.As(err, &syntaxErr) || syntaxErr.Name != "A" {
+		t.Fatalf("Expected export A to be rejected, got %v", err)
+	}
+	for name, original := range files {
+		if content, _ := os.ReadFile(filepath.Join(home, name)); string(content) != original {
+			t.Errorf("Expected %s to be left alone, got:\n%s", name, content)
+		}
+	}
+}
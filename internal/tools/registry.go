@@ -6,11 +6,35 @@ import (
 	"github.com/btassone/swiss-linux-knife/internal/gui"
 )
 
+// Editor is implemented by tools that edit files. The main window routes
+// the Edit menu's undo and redo to it, asks it about unsaved edits
+// before reloading, switching tools or quitting, and closes it when it is
+// replaced.
+type Editor interface {
+	Undo()
+	Redo()
+	Reload()
+	// PromptUnsaved calls proceed once unsaved edits are saved or
+	// discarded, and not at all if the user cancels.
+	PromptUnsaved(proceed func())
+	// Close releases what the tool holds, such as file watchers, once
+	// another view replaces it.
+	Close()
+}
+
+// View is an open tool. Editor is nil for tools without undo.
+type View struct {
+	Content fyne.CanvasObject
+	Editor  Editor
+}
+
 type Tool struct {
 	Name        string
 	Description string
 	Icon        fyne.Resource
-	Content     func(window fyne.Window) fyne.CanvasObject
+	Open        func(window fyne.Window) View
+	// OpenFile, if set, shows the tool editing the file at path.
+	OpenFile func(window fyne.Window, path string) View
 }
 
 func GetAvailableTools() []Tool {
@@ -19,9 +43,13 @@ func GetAvailableTools() []Tool {
 			Name:        "Shell Config Manager",
 			Description: "Manage bashrc/zshrc visually",
 			Icon:        theme.SettingsIcon(),
-			Content: func(window fyne.Window) fyne.CanvasObject {
+			Open: func(window fyne.Window) View {
 				shellConfigGUI := gui.NewShellConfigGUI(window)
-				return shellConfigGUI.CreateContent()
+				return View{Content: shellConfigGUI.CreateContent(), Editor: shellConfigGUI}
+			},
+			OpenFile: func(window fyne.Window, path string) View {
+				shellConfigGUI := gui.NewShellConfigGUIForFile(window, path)
+				return View{Content: shellConfigGUI.CreateContent(), Editor: shellConfigGUI}
 			},
 		},
 	}